@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/project-flogo/core/action"
 	"github.com/project-flogo/core/app/resource"
+	"github.com/project-flogo/core/data"
 	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/mapper"
 	"github.com/project-flogo/core/data/metadata"
@@ -22,15 +27,30 @@ func init() {
 }
 
 var manager *pipeline.Manager
+var mapperFactory mapper.Factory
 var actionMd = action.ToMetadata(&Settings{})
 var logger log.Logger
 var idGenerator *support.Generator
 
 type Settings struct {
-	StreamURI     string `md:"streamURI"`
-	PipelineURI   string `md:"pipelineURI"`
-	GroupBy       string `md:"groupBy"`
-	OutputChannel string `md:"outputChannel"`
+	StreamURI          string `md:"streamURI"`
+	PipelineURI        string `md:"pipelineURI"`
+	GroupBy            string `md:"groupBy"`
+	GroupIdleTimeout   int    `md:"groupIdleTimeout"`
+	MaxGroups          int    `md:"maxGroups"`
+	FlushOnEvict       bool   `md:"flushOnEvict"`
+	DeleteStateOnEvict bool   `md:"deleteStateOnEvict"`
+	OutputChannel      string `md:"outputChannel"`
+	StateStore         string `md:"stateStore,allowed(memory,file)"`
+	StateDir           string `md:"stateDir"`
+	CheckpointInterval int    `md:"checkpointInterval"`
+	CheckpointOnEvent  bool   `md:"checkpointOnEvent"`
+	ExecutionMode      string `md:"executionMode,allowed(unbounded,pool,ordered)"`
+	Workers            int    `md:"workers"`
+	QueueSize          int    `md:"queueSize"`
+	QueueFullPolicy    string `md:"queueFullPolicy,allowed(block,dropOldest)"`
+	BatchSize          int    `md:"batchSize"`
+	BatchLinger        int    `md:"batchLinger"`
 }
 
 type ActionFactory struct {
@@ -47,7 +67,7 @@ func (f *ActionFactory) Initialize(ctx action.InitContext) error {
 		return nil
 	}
 
-	mapperFactory := mapper.NewFactory(pipeline.GetDataResolver())
+	mapperFactory = mapper.NewFactory(pipeline.GetDataResolver())
 
 	if idGenerator == nil {
 		idGenerator, _ = support.NewGenerator()
@@ -104,6 +124,18 @@ func (f *ActionFactory) New(config *action.Config) (action.Action, error) {
 
 	streamAction.ioMetadata = streamAction.definition.Metadata()
 
+	if settings.GroupBy != "" {
+		streamAction.groupBy = settings.GroupBy
+
+		if strings.HasPrefix(settings.GroupBy, "=") {
+			//groupBy is an expression evaluated against the action inputs
+			streamAction.groupByMapper, err = mapperFactory.NewMapper(map[string]interface{}{groupByKey: settings.GroupBy})
+			if err != nil {
+				return nil, fmt.Errorf("invalid groupBy expression '%s': %s", settings.GroupBy, err.Error())
+			}
+		}
+	}
+
 	if settings.OutputChannel != "" {
 		ch := channels.Get(settings.OutputChannel)
 
@@ -123,20 +155,106 @@ func (f *ActionFactory) New(config *action.Config) (action.Action, error) {
 		instLogger = log.ChildLoggerWithFields(logger, log.FieldString("pipelineName", streamAction.definition.Name()), log.FieldString("pipelineId", instId))
 	}
 
+	var groupSettings *pipeline.GroupSettings
+	if settings.GroupBy != "" {
+		groupSettings = &pipeline.GroupSettings{
+			IdleTimeout:        time.Duration(settings.GroupIdleTimeout) * time.Millisecond,
+			MaxGroups:          settings.MaxGroups,
+			FlushOnEvict:       settings.FlushOnEvict,
+			DeleteStateOnEvict: settings.DeleteStateOnEvict,
+		}
+	}
+
 	//note: single pipeline instance for the moment
-	inst := pipeline.NewInstance(streamAction.definition, instId, settings.GroupBy == "", streamAction.outChannel, instLogger)
-	streamAction.inst = inst
+	switch settings.StateStore {
+	case "", "memory":
+		streamAction.inst = pipeline.NewInstance(streamAction.definition, instId, groupSettings, streamAction.outChannel, instLogger)
+	case "file":
+		if settings.StateDir == "" {
+			return nil, fmt.Errorf("stateDir must be specified when using a file state store")
+		}
+
+		//the state of each action is kept in its own directory
+		storeName := config.Id
+		if storeName == "" {
+			storeName = streamAction.definition.Id()
+		}
+
+		store, err := pipeline.NewFileStateStore(filepath.Join(settings.StateDir, url.PathEscape(storeName)))
+		if err != nil {
+			return nil, err
+		}
+
+		//saving the state after every event is costly, so it has to be requested explicitly
+		var interval time.Duration
+		if !settings.CheckpointOnEvent {
+			interval = time.Duration(settings.CheckpointInterval) * time.Millisecond
+			if interval <= 0 {
+				interval = defaultCheckpointInterval * time.Millisecond
+			}
+		}
+		streamAction.inst, err = pipeline.NewPersistentInstance(streamAction.definition, instId, groupSettings, store, interval, streamAction.outChannel, instLogger)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported state store: '%s'", settings.StateStore)
+	}
+
+	var dropOldest bool
+	switch settings.QueueFullPolicy {
+	case "", QueueFullBlock:
+	case QueueFullDropOldest:
+		dropOldest = true
+	default:
+		return nil, fmt.Errorf("unsupported queue full policy: '%s'", settings.QueueFullPolicy)
+	}
+
+	workers := settings.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	switch settings.ExecutionMode {
+	case "", ModeUnbounded:
+	case ModePool, ModeOrdered:
+		//the batches of a group are executed in order, so with batching they use the queue of their group
+		ordered := settings.ExecutionMode == ModeOrdered || settings.BatchSize > 1
+		streamAction.pool = newWorkerPool(workers, settings.QueueSize, ordered, dropOldest, streamAction.execute)
+	default:
+		return nil, fmt.Errorf("unsupported execution mode: '%s'", settings.ExecutionMode)
+	}
+
+	if settings.BatchSize > 1 {
+		linger := settings.BatchLinger
+		if linger <= 0 {
+			linger = defaultBatchLinger
+		}
+		//without a pool the batches of a group are executed one at a time, by a goroutine of their own
+		streamAction.batcher = newBatcher(settings.BatchSize, time.Duration(linger)*time.Millisecond, streamAction.dispatch, streamAction.pool == nil)
+	}
 
 	return streamAction, nil
 }
 
+const groupByKey = "groupBy"
+
+// defaultCheckpointInterval is the interval in milliseconds at which the changed state is saved by default
+const defaultCheckpointInterval = 5000
+
 type StreamAction struct {
 	ioMetadata *metadata.IOMetadata
 	definition *pipeline.Definition
 	outChannel channels.Channel
 
-	inst    *pipeline.Instance
-	groupBy string
+	inst          *pipeline.Instance
+	groupBy       string
+	groupByMapper mapper.Mapper
+
+	// pool executes the events, if nil each event is executed in its own goroutine
+	pool *workerPool
+	// batcher collects the events into micro-batches, if nil the events are executed individually
+	batcher *batcher
 }
 
 func (s *StreamAction) Info() *action.Info {
@@ -151,36 +269,120 @@ func (s *StreamAction) IOMetadata() *metadata.IOMetadata {
 	return s.ioMetadata
 }
 
+// Cleanup implements support.NeedsCleanup, it releases the state held by the stream
+func (s *StreamAction) Cleanup() error {
+	if s.batcher != nil {
+		s.batcher.stop()
+	}
+	s.inst.Stop()
+	if s.pool != nil {
+		s.pool.stop()
+	}
+	return nil
+}
+
 func (s *StreamAction) Run(context context.Context, inputs map[string]interface{}, handler action.ResultHandler) error {
 
-	discriminator := ""
+	discriminator, err := s.getDiscriminator(inputs)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("Running pipeline")
+
+	t := &task{ctx: context, discriminator: discriminator, inputs: inputs, handler: handler}
+
+	if s.batcher != nil {
+		err = s.batcher.add(t)
+	} else if s.pool != nil {
+		err = s.pool.submit(t)
+	} else {
+		go s.execute(t)
+	}
 
-	if s.groupBy != "" {
-		//navigate input
-		//note: for now groupings are determined by inputs to the action
-		value, ok := inputs[s.groupBy]
-		if ok {
-			discriminator, _ = coerce.ToString(value)
+	//the handler is done even if the event isn't executed, so the trigger doesn't wait for it
+	if err != nil {
+		t.reject(err)
+		return err
+	}
+
+	return nil
+}
+
+// dispatch executes the micro-batch of the task using the pool, if any, otherwise it is executed right away
+func (s *StreamAction) dispatch(t *task) {
+
+	if s.pool == nil {
+		s.execute(t)
+		return
+	}
+
+	err := s.pool.submit(t)
+	if err != nil {
+		t.reject(err)
+	}
+}
+
+// execute runs the pipeline for the event, or the micro-batch of events, of the task
+func (s *StreamAction) execute(t *task) {
+
+	if t.batch != nil {
+		goCtxs := make([]context.Context, len(t.batch))
+		inputs := make([]map[string]interface{}, len(t.batch))
+		for i, bt := range t.batch {
+			goCtxs[i], inputs[i] = bt.ctx, bt.inputs
 		}
+
+		results := s.inst.RunBatch(goCtxs, t.discriminator, inputs)
+		for i, bt := range t.batch {
+			s.complete(bt, results[i].Output, results[i].Status, results[i].Err)
+		}
+		return
 	}
 
-	logger.Debugf("Running pipeline")
+	retData, status, err := s.inst.RunContext(t.ctx, t.discriminator, t.inputs)
+	s.complete(t, retData, status, err)
+}
+
+// complete hands the result of the execution of the event of the task to its handler
+func (s *StreamAction) complete(t *task, retData map[string]interface{}, status pipeline.ExecutionStatus, err error) {
+
+	defer t.handler.Done()
+
+	if err != nil {
+		t.handler.HandleResult(nil, err)
+	} else {
+		t.handler.HandleResult(retData, err)
+	}
+
+	if s.outChannel != nil && status == pipeline.ExecStatusCompleted {
+		s.outChannel.Publish(retData)
+	}
+}
 
-	go func() {
+// getDiscriminator determines the group the inputs belong to, the group is either
+// the value of the input named by groupBy or the result of the groupBy expression
+func (s *StreamAction) getDiscriminator(inputs map[string]interface{}) (string, error) {
 
-		defer handler.Done()
-		retData, status, err := s.inst.Run(discriminator, inputs)
+	if s.groupBy == "" {
+		return "", nil
+	}
 
+	var value interface{}
+
+	if s.groupByMapper != nil {
+		results, err := s.groupByMapper.Apply(data.NewSimpleScope(inputs, nil))
 		if err != nil {
-			handler.HandleResult(nil, err)
-		} else {
-			handler.HandleResult(retData, err)
+			return "", fmt.Errorf("unable to evaluate groupBy '%s': %s", s.groupBy, err.Error())
 		}
+		value = results[groupByKey]
+	} else {
+		value = inputs[s.groupBy]
+	}
 
-		if s.outChannel != nil && status == pipeline.ExecStatusCompleted {
-			s.outChannel.Publish(retData)
-		}
-	}()
+	if value == nil {
+		return "", nil
+	}
 
-	return nil
+	return coerce.ToString(value)
 }
@@ -1,10 +1,12 @@
 package stream
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
 	"github.com/project-flogo/core/action"
+	"github.com/project-flogo/core/activity"
 	"github.com/project-flogo/core/app/resource"
 	"github.com/project-flogo/core/engine/channels"
 	"github.com/project-flogo/core/support/test"
@@ -62,3 +64,204 @@ func TestActionFactory_New(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, act)
 }
+
+const groupByConfig string = `{
+  "id": "flogo-stream-grouped",
+  "ref": "github.com/project-flogo/stream",
+  "settings": {
+    "streamURI": "res://stream:grouped",
+    "groupBy": "=$.data.deviceId"
+  }
+}
+`
+const groupByResData string = `{
+        "metadata": {
+          "input": [
+            {
+              "name": "data",
+              "type": "object"
+            }
+          ],
+          "output": [
+            {
+              "name": "count",
+              "type": "integer"
+            }
+          ]
+        },
+        "stages": [
+          {
+            "ref": "github.com/project-flogo/stream",
+            "output": {
+              "pipeline.count": "=$.count"
+            }
+          }
+        ]
+      }`
+
+func init() {
+	_ = activity.Register(&countActivity{})
+}
+
+type countOutput struct {
+	Count int `md:"count"`
+}
+
+var countActivityMd = activity.ToMetadata(&countOutput{})
+
+// countActivity counts the samples it has seen using the shared temp data
+type countActivity struct {
+}
+
+func (a *countActivity) Metadata() *activity.Metadata {
+	return countActivityMd
+}
+
+func (a *countActivity) Eval(ctx activity.Context) (done bool, err error) {
+	sharedData := ctx.GetSharedTempData()
+
+	count, _ := sharedData["count"].(int)
+	count++
+	sharedData["count"] = count
+
+	err = ctx.SetOutput("count", count)
+	return true, err
+}
+
+func TestStreamAction_GroupBy(t *testing.T) {
+
+	cfg := &action.Config{}
+	err := json.Unmarshal([]byte(groupByConfig), cfg)
+	assert.Nil(t, err)
+
+	af := ActionFactory{}
+	ctx := test.NewActionInitCtx()
+
+	err = af.Initialize(ctx)
+	assert.Nil(t, err)
+
+	resourceCfg := &resource.Config{ID: "stream:grouped"}
+	resourceCfg.Data = []byte(groupByResData)
+	err = ctx.AddResource(pipeline.ResType, resourceCfg)
+	assert.Nil(t, err)
+
+	act, err := af.New(cfg)
+	assert.Nil(t, err)
+
+	sa := act.(*StreamAction)
+
+	run := func(deviceId string) interface{} {
+		inputs := map[string]interface{}{"data": map[string]interface{}{"deviceId": deviceId}}
+
+		discriminator, err := sa.getDiscriminator(inputs)
+		assert.Nil(t, err)
+		assert.Equal(t, deviceId, discriminator)
+
+		out, status, err := sa.inst.Run(discriminator, inputs)
+		assert.Nil(t, err)
+		assert.Equal(t, pipeline.ExecStatusCompleted, status)
+		return out["count"]
+	}
+
+	assert.Equal(t, 1, run("d1"))
+	assert.Equal(t, 2, run("d1"))
+	assert.Equal(t, 1, run("d2"))
+	assert.Equal(t, 3, run("d1"))
+	assert.Equal(t, 2, run("d2"))
+}
+
+func TestStreamAction_GroupByInput(t *testing.T) {
+
+	sa := &StreamAction{groupBy: "deviceId"}
+
+	discriminator, err := sa.getDiscriminator(map[string]interface{}{"deviceId": 12})
+	assert.Nil(t, err)
+	assert.Equal(t, "12", discriminator)
+
+	discriminator, err = sa.getDiscriminator(map[string]interface{}{"other": "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", discriminator)
+}
+
+const batchConfig string = `{
+  "id": "flogo-stream-batched",
+  "ref": "github.com/project-flogo/stream",
+  "settings": {
+    "streamURI": "res://stream:batched",
+    "groupBy": "=$.data.deviceId",
+    "executionMode": "ordered",
+    "batchSize": 2,
+    "batchLinger": 20
+  }
+}
+`
+
+func TestStreamAction_Batch(t *testing.T) {
+
+	cfg := &action.Config{}
+	err := json.Unmarshal([]byte(batchConfig), cfg)
+	assert.Nil(t, err)
+
+	af := ActionFactory{}
+	ctx := test.NewActionInitCtx()
+
+	err = af.Initialize(ctx)
+	assert.Nil(t, err)
+
+	resourceCfg := &resource.Config{ID: "stream:batched"}
+	resourceCfg.Data = []byte(groupByResData)
+	err = ctx.AddResource(pipeline.ResType, resourceCfg)
+	assert.Nil(t, err)
+
+	act, err := af.New(cfg)
+	assert.Nil(t, err)
+
+	sa := act.(*StreamAction)
+	defer sa.Cleanup()
+
+	devices := []string{"d1", "d1", "d2", "d1"}
+	handlers := make([]*testHandler, len(devices))
+
+	for i, deviceId := range devices {
+		handlers[i] = &testHandler{done: make(chan struct{})}
+		inputs := map[string]interface{}{"data": map[string]interface{}{"deviceId": deviceId}}
+
+		err = sa.Run(context.Background(), inputs, handlers[i])
+		assert.Nil(t, err)
+	}
+
+	//the last events are executed once their batches have lingered
+	var counts []interface{}
+	for _, handler := range handlers {
+		<-handler.done
+		assert.Nil(t, handler.err)
+		counts = append(counts, handler.results["count"])
+	}
+
+	assert.Equal(t, []interface{}{1, 2, 1, 3}, counts)
+
+	//once stopped the events are rejected
+	err = sa.Cleanup()
+	assert.Nil(t, err)
+
+	handler := &testHandler{done: make(chan struct{})}
+	err = sa.Run(context.Background(), map[string]interface{}{"data": map[string]interface{}{"deviceId": "d1"}}, handler)
+	assert.Equal(t, errPoolStopped, err)
+	assert.Equal(t, errPoolStopped, waitTask(t, &task{handler: handler}))
+
+	sa.batcher = nil
+
+	handler = &testHandler{done: make(chan struct{})}
+	err = sa.Run(context.Background(), map[string]interface{}{"data": map[string]interface{}{"deviceId": "d1"}}, handler)
+	assert.Equal(t, errPoolStopped, err)
+	assert.Equal(t, errPoolStopped, waitTask(t, &task{handler: handler}))
+
+	//in pool mode the batches are queued by group, so the batches of a group are executed in order
+	cfg.Settings["executionMode"] = ModePool
+	act, err = af.New(cfg)
+	assert.Nil(t, err)
+
+	sa = act.(*StreamAction)
+	defer sa.Cleanup()
+	assert.True(t, sa.pool.ordered)
+}
@@ -1,45 +1,81 @@
 package aggregate
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/metadata"
 	"github.com/project-flogo/stream/activity/aggregate/window"
 	"github.com/project-flogo/stream/pipeline/support"
 )
 
 const (
-	ivValue = "value"
-
-	ovResult = "result"
-	ovReport = "report"
-
-	sdWindow = "window"
+	ivValue     = "value"
+	ivTimestamp = "timestamp"
+
+	ovResult      = "result"
+	ovCount       = "count"
+	ovReport      = "report"
+	ovWindowStart = "windowStart"
+	ovWindowEnd   = "windowEnd"
+	ovWindows     = "windows"
+	ovLate        = "late"
+	ovLateCount   = "lateCount"
+
+	sdWindow   = "window"
+	sdSnapshot = "snapshot"
 )
 
-//we can generate json from this! - we could also create a "validate-able" object from this
+// we can generate json from this! - we could also create a "validate-able" object from this
 type Settings struct {
-	Function           string `md:"function,required,allowed(avg,sum,min,max,count,accumulate)"`
-	WindowType         string `md:"windowType,required,allowed(tumbling,sliding,timeTumbling,timeSliding)"`
-	WindowSize         int    `md:"windowSize,required"`
-	Resolution         int    `md:"resolution"`
-	ProceedOnlyOnEmit  bool   `md:"proceedOnlyOnEmit"`
-	AdditionalSettings string `md:"additionalSettings"`
+	Function           string        `md:"function"`
+	Aggregations       []interface{} `md:"aggregations"`
+	WindowType         string        `md:"windowType,required,allowed(tumbling,sliding,timeTumbling,timeSliding,hopping,timeHopping,session)"`
+	WindowSize         int           `md:"windowSize,required"`
+	Resolution         int           `md:"resolution"`
+	Hop                int           `md:"hop"`
+	ProceedOnlyOnEmit  bool          `md:"proceedOnlyOnEmit"`
+	AdditionalSettings string        `md:"additionalSettings"`
+	EventTime          bool          `md:"eventTime"`
+	MaxOutOfOrderness  int           `md:"maxOutOfOrderness"`
+	AllowedLateness    int           `md:"allowedLateness"`
+	LateEvents         string        `md:"lateEvents"`
+	SampleType         string        `md:"sampleType"`
 }
 
 type Input struct {
-	Value interface{} `md:"value"`
+	Value     interface{} `md:"value"`
+	Timestamp interface{} `md:"timestamp"`
 }
 
 type Output struct {
-	Report bool        `md:"report"`
-	Result interface{} `md:"result"`
+	Report      bool          `md:"report"`
+	Result      interface{}   `md:"result"`
+	Count       int           `md:"count"`
+	WindowStart int64         `md:"windowStart"`
+	WindowEnd   int64         `md:"windowEnd"`
+	Windows     []interface{} `md:"windows"`
+	Late        bool          `md:"late"`
+	LateCount   int           `md:"lateCount"`
 }
 
+const (
+	lateEventsDrop       = "drop"
+	lateEventsCount      = "count"
+	lateEventsSideOutput = "sideOutput"
+
+	// sampleTypeAny uses the generic windows, same as not specifying a sample type
+	sampleTypeAny = "any"
+	// sampleTypeAuto uses a typed window for the type of the first value
+	sampleTypeAuto = "auto"
+)
+
 func init() {
 	_ = activity.Register(&Activity{}, New)
 }
@@ -47,7 +83,7 @@ func init() {
 var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
 
 func New(ctx activity.InitContext) (activity.Activity, error) {
-	s := &Settings{ProceedOnlyOnEmit: true, Resolution: 1}
+	s := &Settings{ProceedOnlyOnEmit: true, Resolution: 1, LateEvents: lateEventsDrop}
 
 	//settings.Function = "avg" // default function
 	//settings.WindowType = "tumbling" // default window type
@@ -58,12 +94,42 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 		return nil, err
 	}
 
+	switch s.LateEvents {
+	case "":
+		s.LateEvents = lateEventsDrop
+	case lateEventsDrop, lateEventsCount, lateEventsSideOutput:
+	default:
+		return nil, fmt.Errorf("unsupported lateEvents policy: '%s'", s.LateEvents)
+	}
+
+	switch s.SampleType {
+	case "", sampleTypeAny, sampleTypeAuto:
+	default:
+		if _, err = window.ParseSampleType(s.SampleType); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregations, err := toAggregations(s.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(aggregations) == 0 {
+		if s.Function == "" {
+			return nil, fmt.Errorf("either function or aggregations must be specified")
+		}
+		if _, _, _, err = mergeableFunctions(s.Function, &window.Settings{}); err != nil {
+			return nil, err
+		}
+	}
+
 	additionalSettings, err := toParams(s.AdditionalSettings)
 	if err != nil {
 		return nil, err
 	}
 
-	act := &Activity{settings: s, additionalSettings: additionalSettings}
+	act := &Activity{settings: s, aggregations: aggregations, additionalSettings: additionalSettings}
 
 	return act, nil
 }
@@ -71,6 +137,7 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 // Activity is an Activity that is used to Aggregate a message to the console
 type Activity struct {
 	settings           *Settings
+	aggregations       []*Aggregation
 	additionalSettings map[string]string
 	mutex              sync.Mutex
 }
@@ -83,43 +150,88 @@ func (a *Activity) Metadata() *activity.Metadata {
 // Eval implements api.Activity.Eval - Aggregates the Message
 func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 
+	w, err := a.getWindow(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return a.evalSample(ctx, w)
+}
+
+// EvalBatch implements support.BatchActivity.EvalBatch - Aggregates the Messages of a micro-batch in order,
+// the contexts belong to the same group so they share its window
+func (a *Activity) EvalBatch(ctxs []activity.Context) (done []bool, err error) {
+
+	//the timestamps are checked first, so a batch that fails doesn't add any of its samples
+	if a.settings.EventTime {
+		for _, ctx := range ctxs {
+			if _, err = toMillis(ctx.GetInput(ivTimestamp)); err != nil {
+				return nil, fmt.Errorf("invalid event timestamp: %s", err.Error())
+			}
+		}
+	}
+
+	w, err := a.getWindow(ctxs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	done = make([]bool, len(ctxs))
+	for i, ctx := range ctxs {
+		done[i], err = a.evalSample(ctx, w)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return done, nil
+}
+
+// getWindow gets the window of the group, creating it and its timer if necessary
+func (a *Activity) getWindow(ctx activity.Context) (w window.Window, err error) {
+
 	sharedData := ctx.GetSharedTempData()
 	wv, defined := sharedData[sdWindow]
 
-	timerSupport, timerSupported := support.GetTimerSupport(ctx)
+	if defined {
+		return wv.(window.Window), nil
+	}
 
-	var w window.Window
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 
-	//create the window & associated timer if necessary
+	wv, defined = sharedData[sdWindow]
+	if defined {
+		return wv.(window.Window), nil
+	}
 
-	if !defined {
+	w, err = a.createWindow(ctx)
 
-		a.mutex.Lock()
+	if err == nil {
+		err = a.restoreWindow(w, sharedData)
+	}
 
-		wv, defined = sharedData[sdWindow]
-		if defined {
-			w = wv.(window.Window)
-		} else {
-			w, err = a.createWindow(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-			if err != nil {
-				a.mutex.Unlock()
-				return false, err
-			}
+	sharedData[sdWindow] = w
 
-			sharedData[sdWindow] = w
-		}
+	return w, nil
+}
 
-		a.mutex.Unlock()
-	} else {
-		w = wv.(window.Window)
-	}
+// evalSample adds the input of the event to the window
+func (a *Activity) evalSample(ctx activity.Context, w window.Window) (done bool, err error) {
 
 	in := ctx.GetInput(ivValue)
 
+	if ew, ok := w.(window.EventTimeWindow); ok {
+		return a.evalEvent(ctx, ew, in)
+	}
+
 	emit, result := w.AddSample(in)
 
-	if timerSupported {
+	if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported {
 		timerSupport.UpdateTimer(true)
 	}
 
@@ -138,12 +250,110 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	return done, nil
 }
 
+// evalEvent adds the sample to an event time or session window, the sample is timestamped using the
+// timestamp input if event time is enabled
+func (a *Activity) evalEvent(ctx activity.Context, w window.EventTimeWindow, in interface{}) (done bool, err error) {
+
+	var timestamp int64
+
+	if a.settings.EventTime {
+		timestamp, err = toMillis(ctx.GetInput(ivTimestamp))
+		if err != nil {
+			return false, fmt.Errorf("invalid event timestamp: %s", err.Error())
+		}
+	} else {
+		timestamp = nowMillis()
+	}
+
+	results, late := w.AddEvent(in, timestamp)
+
+	if !a.settings.EventTime {
+		//restart the inactivity timer of the session
+		if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported {
+			timerSupport.CancelTimer(false)
+			err = timerSupport.CreateTimer(time.Duration(a.settings.WindowSize)*time.Millisecond, a.closeSessions, false)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if a.settings.LateEvents != lateEventsDrop {
+		err = ctx.SetOutput(ovLateCount, w.LateCount())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = ctx.SetOutput(ovLate, late)
+	if err != nil {
+		return false, err
+	}
+
+	if late {
+		ctx.Logger().Debugf("Late event with timestamp %d", timestamp)
+
+		if a.settings.LateEvents == lateEventsSideOutput {
+			//pass the late sample on, so it can be handled downstream
+			err = ctx.SetOutput(ovResult, in)
+			if err != nil {
+				return false, err
+			}
+
+			err = ctx.SetOutput(ovReport, false)
+			return err == nil, err
+		}
+	}
+
+	if len(results) == 0 {
+		err = ctx.SetOutput(ovReport, false)
+		if err != nil {
+			return false, err
+		}
+
+		return !a.settings.ProceedOnlyOnEmit, nil
+	}
+
+	err = a.setResults(ctx, results)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// setResults sets the outputs for the results of event time windows, result contains the value of the
+// latest window, windows contains all the windows in case the watermark closed more than one
+func (a *Activity) setResults(ctx activity.Context, results []*window.Result) error {
+
+	windows := make([]interface{}, len(results))
+	for i, result := range results {
+		windows[i] = map[string]interface{}{"start": result.Start, "end": result.End, "count": result.Count,
+			"result": result.Value, "update": result.Update}
+	}
+
+	last := results[len(results)-1]
+
+	outputs := map[string]interface{}{ovResult: last.Value, ovReport: true, ovCount: last.Count,
+		ovWindowStart: last.Start, ovWindowEnd: last.End, ovWindows: windows}
+
+	for name, value := range outputs {
+		err := ctx.SetOutput(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (a *Activity) createWindow(ctx activity.Context) (w window.Window, err error) {
 
 	settings := a.settings
 	timerSupport, timerSupported := support.GetTimerSupport(ctx)
 
-	windowSettings := &window.Settings{Size: settings.WindowSize, ExternalTimer: timerSupported, Resolution: settings.Resolution}
+	windowSettings := &window.Settings{Size: settings.WindowSize, ExternalTimer: timerSupported, Resolution: settings.Resolution, Hop: settings.Hop,
+		MaxOutOfOrderness: settings.MaxOutOfOrderness, AllowedLateness: settings.AllowedLateness, Quantile: 0.5}
 	err = windowSettings.SetAdditionalSettings(a.additionalSettings)
 	if err != nil {
 		return nil, err
@@ -151,26 +361,85 @@ func (a *Activity) createWindow(ctx activity.Context) (w window.Window, err erro
 
 	wType := strings.ToLower(settings.WindowType)
 
+	if settings.EventTime && windowSettings.NameKey != "" {
+		return nil, fmt.Errorf("nameKey is not supported by event time windows")
+	} else if wType == "session" && windowSettings.NameKey != "" {
+		return nil, fmt.Errorf("nameKey is not supported by session windows")
+	}
+
+	if len(a.aggregations) > 0 {
+		w, err = NewCompositeWindow(wType, settings.EventTime, a.aggregations, windowSettings)
+	} else {
+		w, err = newWindow(wType, settings, windowSettings, ctx.GetInput(ivValue))
+	}
+
+	if err != nil || !timerSupported || settings.EventTime {
+		return w, err
+	}
+
+	switch wType {
+	case "timetumbling":
+		err = timerSupport.CreateTimer(time.Duration(settings.WindowSize)*time.Millisecond, a.moveWindow, true)
+	case "timesliding":
+		err = timerSupport.CreateTimer(time.Duration(settings.Resolution)*time.Millisecond, a.moveWindow, true)
+	case "timehopping":
+		err = timerSupport.CreateTimer(w.(*window.HoppingTimeWindow).PaneInterval(), a.moveWindow, true)
+	}
+
+	return w, err
+}
+
+// newWindow creates a window of the specified type that aggregates the samples using the function, if a sample
+// type is specified numeric samples are aggregated by a typed window if the function and window type support it
+func newWindow(wType string, settings *Settings, windowSettings *window.Settings, sample interface{}) (window.Window, error) {
+
+	if !settings.EventTime && settings.SampleType != "" && settings.SampleType != sampleTypeAny {
+		sampleType := settings.SampleType
+		if sampleType == sampleTypeAuto {
+			sampleType = ""
+		}
+
+		w, typed, err := NewTypedWindow(settings.Function, wType, sampleType, sample, windowSettings)
+		if err != nil || typed {
+			return w, err
+		}
+	}
+
+	if settings.EventTime {
+		switch wType {
+		case "timetumbling":
+			return NewEventTimeWindow(settings.Function, false, windowSettings)
+		case "timesliding":
+			return NewEventTimeWindow(settings.Function, true, windowSettings)
+		case "session":
+			return NewSessionWindow(settings.Function, windowSettings)
+		default:
+			return nil, fmt.Errorf("event time is not supported by window type: '%s'", settings.WindowType)
+		}
+	}
+
 	switch wType {
 	case "tumbling":
-		w, err = NewTumblingWindow(settings.Function, windowSettings)
+		return NewTumblingWindow(settings.Function, windowSettings)
 	case "sliding":
-		w, err = NewSlidingWindow(settings.Function, windowSettings)
+		return NewSlidingWindow(settings.Function, windowSettings)
 	case "timetumbling":
-		w, err = NewTumblingTimeWindow(settings.Function, windowSettings)
-		if err == nil && timerSupported {
-			err = timerSupport.CreateTimer(time.Duration(settings.WindowSize)*time.Millisecond, a.moveWindow, true)
-		}
+		return NewTumblingTimeWindow(settings.Function, windowSettings)
 	case "timesliding":
-		w, err = NewSlidingTimeWindow(settings.Function, windowSettings)
-		if err == nil && timerSupported {
-			err = timerSupport.CreateTimer(time.Duration(settings.Resolution)*time.Millisecond, a.moveWindow, true)
+		return NewSlidingTimeWindow(settings.Function, windowSettings)
+	case "hopping":
+		return NewHoppingWindow(settings.Function, windowSettings)
+	case "timehopping":
+		hw, err := NewHoppingTimeWindow(settings.Function, windowSettings)
+		if err != nil {
+			return nil, err
 		}
+		return hw, nil
+	case "session":
+		return NewSessionWindow(settings.Function, windowSettings)
 	default:
 		return nil, fmt.Errorf("unsupported window type: '%s'", settings.WindowType)
 	}
-
-	return w, err
 }
 
 func (a *Activity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
@@ -200,6 +469,214 @@ func (a *Activity) moveWindow(ctx activity.Context) bool {
 	return !(a.settings.ProceedOnlyOnEmit && !emit)
 }
 
+// closeSessions is the callback of the inactivity timer of a session window
+func (a *Activity) closeSessions(ctx activity.Context) bool {
+
+	sharedData := ctx.GetSharedTempData()
+
+	wv, _ := sharedData[sdWindow]
+
+	w, ok := wv.(*window.SessionWindow)
+	if !ok {
+		return false
+	}
+
+	results := w.Advance(nowMillis())
+	if len(results) == 0 {
+		return false
+	}
+
+	err := a.setResults(ctx, results)
+	if err != nil {
+		ctx.Logger().Errorf("unable to set session results: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Flush implements support.Flusher.Flush, emits the partial result of the window
+func (a *Activity) Flush(ctx activity.Context) bool {
+
+	sharedData := ctx.GetSharedTempData()
+
+	wv, defined := sharedData[sdWindow]
+	if !defined {
+		return false
+	}
+
+	if ew, ok := wv.(window.EventTimeWindow); ok {
+		results := ew.CloseAll()
+		if len(results) == 0 {
+			return false
+		}
+
+		err := a.setResults(ctx, results)
+		if err != nil {
+			ctx.Logger().Errorf("unable to set window results: %v", err)
+			return false
+		}
+
+		return true
+	}
+
+	w, ok := wv.(window.FlushableWindow)
+	if !ok {
+		return false
+	}
+
+	emit, result := w.Flush()
+	if !emit {
+		return false
+	}
+
+	err := ctx.SetOutput(ovResult, result)
+	if err != nil {
+		ctx.Logger().Errorf("unable to set output '%s': %v", ovResult, err)
+		return false
+	}
+
+	err = ctx.SetOutput(ovReport, emit)
+	if err != nil {
+		ctx.Logger().Errorf("unable to set output '%s': %v", ovReport, err)
+		return false
+	}
+
+	return true
+}
+
+// SaveState implements support.Stateful.SaveState, saves the snapshot of the window
+func (a *Activity) SaveState(sharedData map[string]interface{}) ([]byte, error) {
+
+	a.mutex.Lock()
+	wv, defined := sharedData[sdWindow]
+	sv, restoring := sharedData[sdSnapshot]
+	a.mutex.Unlock()
+
+	var snapshot *window.Snapshot
+
+	if defined {
+		w, ok := wv.(window.SnapshotWindow)
+		if !ok {
+			return nil, nil
+		}
+		snapshot = w.Snapshot()
+	} else if restoring {
+		//window hasn't been recreated since the state was restored
+		snapshot = sv.(*window.Snapshot)
+	} else {
+		return nil, nil
+	}
+
+	return json.Marshal(snapshot)
+}
+
+// RestoreState implements support.Stateful.RestoreState, if the window doesn't exist yet
+// it is restored from the snapshot when it is created on the next evaluation
+func (a *Activity) RestoreState(sharedData map[string]interface{}, state []byte) error {
+
+	snapshot := &window.Snapshot{}
+	err := json.Unmarshal(state, snapshot)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	sharedData[sdSnapshot] = snapshot
+
+	if wv, defined := sharedData[sdWindow]; defined {
+		return a.restoreWindow(wv.(window.Window), sharedData)
+	}
+
+	return nil
+}
+
+func (a *Activity) restoreWindow(w window.Window, sharedData map[string]interface{}) error {
+
+	sv, restoring := sharedData[sdSnapshot]
+	if !restoring {
+		return nil
+	}
+
+	delete(sharedData, sdSnapshot)
+
+	sw, ok := w.(window.SnapshotWindow)
+	if !ok {
+		return fmt.Errorf("unable to restore window of type '%s'", a.settings.WindowType)
+	}
+
+	return sw.Restore(sv.(*window.Snapshot))
+}
+
+// toMillis converts an event timestamp to millis since the epoch, the timestamp can be a time,
+// an RFC3339 string or a number of millis
+func toMillis(val interface{}) (int64, error) {
+
+	switch t := val.(type) {
+	case nil:
+		return 0, fmt.Errorf("timestamp not specified")
+	case time.Time:
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case string:
+		if millis, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return millis, nil
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return 0, err
+		}
+		return ts.UnixNano() / int64(time.Millisecond), nil
+	}
+
+	return coerce.ToInt64(val)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// toAggregations converts the aggregations setting, each aggregation is an object with a function,
+// an optional field and an optional name, the name defaults to the function
+func toAggregations(values []interface{}) ([]*Aggregation, error) {
+
+	aggregations := make([]*Aggregation, 0, len(values))
+	names := make(map[string]bool, len(values))
+
+	for _, value := range values {
+		obj, err := coerce.ToObject(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregation: %v", value)
+		}
+
+		aggregation := &Aggregation{}
+		aggregation.Function, _ = coerce.ToString(obj["function"])
+		aggregation.Field, _ = coerce.ToString(obj["field"])
+		aggregation.Name, _ = coerce.ToString(obj["name"])
+
+		if aggregation.Function == "" {
+			return nil, fmt.Errorf("function not specified for aggregation: %v", value)
+		}
+		if _, _, _, err = mergeableFunctions(aggregation.Function, &window.Settings{}); err != nil {
+			return nil, err
+		}
+
+		if aggregation.Name == "" {
+			aggregation.Name = aggregation.Function
+		}
+		if names[aggregation.Name] {
+			return nil, fmt.Errorf("duplicate aggregation name: '%s'", aggregation.Name)
+		}
+		names[aggregation.Name] = true
+
+		aggregations = append(aggregations, aggregation)
+	}
+
+	return aggregations, nil
+}
+
 func toParams(values string) (map[string]string, error) {
 
 	if values == "" {
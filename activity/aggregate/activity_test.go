@@ -2,9 +2,11 @@ package aggregate
 
 import (
 	"testing"
+	"time"
 
 	"github.com/project-flogo/core/activity"
 	"github.com/project-flogo/core/support/test"
+	"github.com/project-flogo/stream/activity/aggregate/window"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -63,3 +65,403 @@ func TestPOOEFalse(t *testing.T) {
 	assert.Equal(t, true, tc.GetOutput(ovReport))
 	assert.Equal(t, 3, tc.GetOutput(ovResult))
 }
+
+func TestEvalBatch(t *testing.T) {
+
+	settings := &Settings{Function: "avg", WindowType: "tumbling", WindowSize: 2, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	ctxs := make([]activity.Context, 3)
+	for i := range ctxs {
+		tc := test.NewActivityContext(act.Metadata())
+		tc.SetInput(ivValue, 2*(i+1))
+		ctxs[i] = tc
+	}
+
+	//the samples of the batch are added to the window of the group in order
+	done, err := act.(*Activity).EvalBatch(ctxs)
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true, false}, done)
+	assert.Equal(t, true, ctxs[1].(*test.TestActivityContext).GetOutput(ovReport))
+	assert.Equal(t, 3, ctxs[1].(*test.TestActivityContext).GetOutput(ovResult))
+
+	//a batch with an invalid timestamp doesn't add any of its samples
+	settings = &Settings{Function: "sum", WindowType: "timeTumbling", WindowSize: 1000, ProceedOnlyOnEmit: true, EventTime: true}
+	act, err = New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivValue, 2)
+	tc.SetInput(ivTimestamp, 1200)
+	invalid := test.NewActivityContext(act.Metadata())
+	invalid.SetInput(ivValue, 3)
+
+	_, err = act.(*Activity).EvalBatch([]activity.Context{tc, invalid})
+	assert.NotNil(t, err)
+	_, defined := tc.GetSharedTempData()[sdWindow]
+	assert.False(t, defined)
+}
+
+func TestFlush(t *testing.T) {
+
+	settings := &Settings{Function: "sum", WindowType: "tumbling", WindowSize: 5, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	tc.SetInput(ivValue, 2)
+	done, err := act.Eval(tc)
+	assert.False(t, done)
+	assert.Nil(t, err)
+
+	tc.SetInput(ivValue, 3)
+	done, err = act.Eval(tc)
+	assert.False(t, done)
+	assert.Nil(t, err)
+
+	proceed := act.(*Activity).Flush(tc)
+	assert.True(t, proceed)
+	assert.Equal(t, true, tc.GetOutput(ovReport))
+	assert.Equal(t, 5, tc.GetOutput(ovResult))
+
+	//nothing left to flush
+	proceed = act.(*Activity).Flush(tc)
+	assert.False(t, proceed)
+}
+
+func TestSaveRestoreState(t *testing.T) {
+
+	settings := &Settings{Function: "sum", WindowType: "tumbling", WindowSize: 3, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	tc.SetInput(ivValue, 2)
+	_, err = act.Eval(tc)
+	assert.Nil(t, err)
+	tc.SetInput(ivValue, 3)
+	_, err = act.Eval(tc)
+	assert.Nil(t, err)
+
+	state, err := act.(*Activity).SaveState(tc.GetSharedTempData())
+	assert.Nil(t, err)
+	assert.NotNil(t, state)
+
+	//restore into a new activity instance
+	act2, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc2 := test.NewActivityContext(act2.Metadata())
+	err = act2.(*Activity).RestoreState(tc2.GetSharedTempData(), state)
+	assert.Nil(t, err)
+
+	//state is still available before the window is recreated
+	state2, err := act2.(*Activity).SaveState(tc2.GetSharedTempData())
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(state), string(state2))
+
+	tc2.SetInput(ivValue, 4)
+	done, err := act2.Eval(tc2)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 9, tc2.GetOutput(ovResult))
+}
+
+func TestEvalEventTime(t *testing.T) {
+
+	settings := &Settings{Function: "sum", WindowType: "timeTumbling", WindowSize: 1000, ProceedOnlyOnEmit: true,
+		EventTime: true, MaxOutOfOrderness: 500, LateEvents: "sideOutput"}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	tc.SetInput(ivValue, 2)
+	tc.SetInput(ivTimestamp, 1200)
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+
+	tc.SetInput(ivValue, 3)
+	tc.SetInput(ivTimestamp, "1970-01-01T00:00:01.900Z")
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+
+	tc.SetInput(ivValue, 4)
+	tc.SetInput(ivTimestamp, "2600")
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, true, tc.GetOutput(ovReport))
+	assert.Equal(t, 5, tc.GetOutput(ovResult))
+	assert.Equal(t, int64(1000), tc.GetOutput(ovWindowStart))
+	assert.Equal(t, int64(2000), tc.GetOutput(ovWindowEnd))
+
+	//late event is passed on as a side output
+	tc.SetInput(ivValue, 6)
+	tc.SetInput(ivTimestamp, 1500)
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, true, tc.GetOutput(ovLate))
+	assert.Equal(t, false, tc.GetOutput(ovReport))
+	assert.Equal(t, 6, tc.GetOutput(ovResult))
+	assert.Equal(t, 1, tc.GetOutput(ovLateCount))
+
+	//timestamp is required
+	tc.SetInput(ivTimestamp, nil)
+	_, err = act.Eval(tc)
+	assert.NotNil(t, err)
+}
+
+func TestEventTimeUnsupportedWindow(t *testing.T) {
+
+	settings := &Settings{Function: "sum", WindowType: "tumbling", WindowSize: 2, EventTime: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivValue, 2)
+	tc.SetInput(ivTimestamp, 1200)
+	_, err = act.Eval(tc)
+	assert.NotNil(t, err)
+}
+
+func TestEvalSession(t *testing.T) {
+
+	settings := &Settings{Function: "count", WindowType: "session", WindowSize: 20, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	tc.SetInput(ivValue, 1)
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+
+	tc.SetInput(ivValue, 1)
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+
+	//without timer support the session is closed by the next sample after the gap
+	time.Sleep(50 * time.Millisecond)
+
+	tc.SetInput(ivValue, 1)
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 2, tc.GetOutput(ovResult))
+	assert.Equal(t, 2, tc.GetOutput(ovCount))
+
+	start := tc.GetOutput(ovWindowStart).(int64)
+	end := tc.GetOutput(ovWindowEnd).(int64)
+	assert.True(t, end >= start)
+
+	//the open session is emitted on flush
+	proceed := act.(*Activity).Flush(tc)
+	assert.True(t, proceed)
+	assert.Equal(t, 1, tc.GetOutput(ovResult))
+}
+
+func TestEvalHopping(t *testing.T) {
+
+	settings := &Settings{Function: "max", WindowType: "hopping", WindowSize: 3, Hop: 2, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, nil)
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	var results []interface{}
+	for _, val := range []int{5, 1, 2, 3, 1, 1, 4} {
+		tc.SetInput(ivValue, val)
+		done, err := act.Eval(tc)
+		assert.Nil(t, err)
+		if done {
+			results = append(results, tc.GetOutput(ovResult))
+		}
+	}
+
+	assert.Equal(t, []interface{}{5, 3, 4}, results)
+}
+
+func TestEvalStats(t *testing.T) {
+
+	tests := []struct {
+		settings *Settings
+		expected interface{}
+	}{
+		{&Settings{Function: "stddev", WindowType: "tumbling", WindowSize: 4}, 0.957},
+		{&Settings{Function: "median", WindowType: "tumbling", WindowSize: 4}, 3.5},
+		{&Settings{Function: "quantile", WindowType: "tumbling", WindowSize: 4, AdditionalSettings: "quantile=1"}, 5.0},
+		{&Settings{Function: "distinctCount", WindowType: "sliding", WindowSize: 4}, 3},
+		{&Settings{Function: "first", WindowType: "hopping", WindowSize: 4, Hop: 2}, 3},
+		{&Settings{Function: "range", WindowType: "tumbling", WindowSize: 4}, 2},
+	}
+
+	for _, tt := range tests {
+		tt.settings.ProceedOnlyOnEmit = true
+		act, err := New(test.NewActivityInitContext(tt.settings, nil))
+		assert.Nil(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+
+		var done bool
+		for _, val := range []int{3, 4, 3, 5} {
+			tc.SetInput(ivValue, val)
+			done, err = act.Eval(tc)
+			assert.Nil(t, err)
+		}
+
+		assert.True(t, done, tt.settings.Function)
+		assert.InDelta(t, tt.expected, tc.GetOutput(ovResult), 0.01, tt.settings.Function)
+	}
+
+	//quantile must be between 0 and 1
+	act, err := New(test.NewActivityInitContext(&Settings{Function: "quantile", WindowType: "tumbling", WindowSize: 4, AdditionalSettings: "quantile=90"}, nil))
+	assert.Nil(t, err)
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivValue, 1)
+	_, err = act.Eval(tc)
+	assert.NotNil(t, err)
+}
+
+func TestEvalAggregations(t *testing.T) {
+
+	aggregations := []interface{}{
+		map[string]interface{}{"name": "min", "function": "min", "field": "temp"},
+		map[string]interface{}{"name": "max", "function": "max", "field": "temp"},
+		map[string]interface{}{"function": "avg", "field": "temp"},
+		map[string]interface{}{"name": "devices", "function": "distinctCount", "field": "device"},
+	}
+
+	for _, wType := range []string{"tumbling", "sliding", "hopping"} {
+		settings := &Settings{Aggregations: aggregations, WindowType: wType, WindowSize: 3, Hop: 3, ProceedOnlyOnEmit: true}
+		act, err := New(test.NewActivityInitContext(settings, nil))
+		assert.Nil(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+
+		var done bool
+		for i, val := range []float64{3, 9, 6} {
+			tc.SetInput(ivValue, map[string]interface{}{"temp": val, "device": i % 2})
+			done, err = act.Eval(tc)
+			assert.Nil(t, err)
+		}
+
+		assert.True(t, done, wType)
+		assert.Equal(t, map[string]interface{}{"min": 3.0, "max": 9.0, "avg": 6.0, "devices": 2}, tc.GetOutput(ovResult), wType)
+	}
+
+	//an aggregation requires a supported function
+	_, err := New(test.NewActivityInitContext(&Settings{Aggregations: []interface{}{map[string]interface{}{"function": "mode"}}, WindowType: "tumbling", WindowSize: 3}, nil))
+	assert.NotNil(t, err)
+
+	//names must be unique
+	_, err = New(test.NewActivityInitContext(&Settings{Aggregations: []interface{}{map[string]interface{}{"function": "min"}, map[string]interface{}{"function": "min", "field": "x"}}, WindowType: "tumbling", WindowSize: 3}, nil))
+	assert.NotNil(t, err)
+
+	//either a function or aggregations are required
+	_, err = New(test.NewActivityInitContext(&Settings{WindowType: "tumbling", WindowSize: 3}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestEvalTyped(t *testing.T) {
+
+	tests := []struct {
+		sampleType string
+		samples    []interface{}
+		expected   interface{}
+	}{
+		{"auto", []interface{}{1, 2, 3}, 2},
+		{"auto", []interface{}{1.0, 2.0, 4.0}, 2.3333333333333335},
+		{"auto", []interface{}{[]int{1, 2}, []int{3, 4}, []int{5, 6}}, []int{3, 4}},
+		{"int64", []interface{}{1, 2.0, "3"}, int64(2)},
+		{"[]float64", []interface{}{[]int{1, 2}, []float64{3, 4}, []interface{}{5, 6}}, []float64{3, 4}},
+		{"any", []interface{}{1, 2, 3}, 2},
+		{"", []interface{}{1, 2, 3}, 2},
+	}
+
+	for _, tt := range tests {
+		act, err := New(test.NewActivityInitContext(&Settings{Function: "avg", WindowType: "tumbling", WindowSize: 3, SampleType: tt.sampleType}, nil))
+		assert.Nil(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+
+		for _, sample := range tt.samples {
+			tc.SetInput(ivValue, sample)
+			_, err = act.Eval(tc)
+			assert.Nil(t, err)
+		}
+
+		assert.Equal(t, tt.expected, tc.GetOutput(ovResult), tt.sampleType)
+	}
+
+	_, err := New(test.NewActivityInitContext(&Settings{Function: "avg", WindowType: "tumbling", WindowSize: 3, SampleType: "int8"}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestEvalTopK(t *testing.T) {
+
+	settings := &Settings{Function: "topK", WindowType: "tumbling", WindowSize: 5, AdditionalSettings: "k=2,topKKey=device", ProceedOnlyOnEmit: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	var done bool
+	for _, device := range []string{"a", "b", "c", "b", "a"} {
+		tc.SetInput(ivValue, map[string]interface{}{"device": device})
+		done, err = act.Eval(tc)
+		assert.Nil(t, err)
+	}
+
+	assert.True(t, done)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "a", "count": 2},
+		map[string]interface{}{"key": "b", "count": 2},
+	}, tc.GetOutput(ovResult))
+
+	//sliding time windows merge the keys of their blocks
+	windowSettings := &window.Settings{Size: 20, Resolution: 10, ExternalTimer: true}
+	err = windowSettings.SetAdditionalSettings(map[string]string{"k": "1", "topKMode": "sketch", "topKKey": "device"})
+	assert.Nil(t, err)
+
+	tw, err := NewTumblingTimeWindow("topK", windowSettings)
+	assert.Nil(t, err)
+	sw, err := NewSlidingTimeWindow("topK", windowSettings)
+	assert.Nil(t, err)
+
+	for w, count := range map[window.TimeWindow]int{tw: 1, sw: 2} {
+		w.AddSample(map[string]interface{}{"device": "x"})
+		w.AddSample(map[string]interface{}{"device": "y"})
+		w.NextBlock()
+		w.AddSample(map[string]interface{}{"device": "y"})
+		emit, result := w.NextBlock()
+		assert.True(t, emit)
+		assert.Equal(t, []interface{}{map[string]interface{}{"key": "y", "count": count}}, result)
+	}
+
+	//the mode must be exact or sketch
+	err = windowSettings.SetAdditionalSettings(map[string]string{"topKMode": "approx"})
+	assert.NotNil(t, err)
+}
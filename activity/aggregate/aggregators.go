@@ -22,6 +22,9 @@ func NewTumblingWindow(function string, settings *window.Settings) (window.Windo
 	case "accumulate":
 		return window.NewTumblingWindow(functions.AddSampleAccum, functions.AggregateSingleNoopFunc, settings), nil
 	default:
+		if addFunc, _, aggFunc, ok := statFunctions(function, settings); ok {
+			return window.NewTumblingWindow(addFunc, aggFunc, settings), nil
+		}
 		return nil, fmt.Errorf("unsupported function: %s", function)
 	}
 }
@@ -43,6 +46,9 @@ func NewTumblingTimeWindow(function string, settings *window.Settings) (window.T
 	case "accumulate":
 		return window.NewTumblingTimeWindow(functions.AddSampleAccum, functions.AggregateSingleNoopFunc, settings), nil
 	default:
+		if addFunc, _, aggFunc, ok := statFunctions(function, settings); ok {
+			return window.NewTumblingTimeWindow(addFunc, aggFunc, settings), nil
+		}
 		return nil, fmt.Errorf("unsupported function: %s", function)
 	}
 }
@@ -62,6 +68,10 @@ func NewSlidingWindow(function string, settings *window.Settings) (window.Window
 	case "accumulate":
 		return window.NewSlidingWindow(functions.AggregateBlocksAccumulate, settings), nil
 	default:
+		if addFunc, _, aggFunc, ok := statFunctions(function, settings); ok {
+			//the blocks of a sliding window are the samples
+			return window.NewSlidingWindow(functions.NewSampleBlocksFunc(addFunc, aggFunc), settings), nil
+		}
 		return nil, fmt.Errorf("unsupported function: %s", function)
 	}
 }
@@ -81,6 +91,231 @@ func NewSlidingTimeWindow(function string, settings *window.Settings) (window.Ti
 	case "count":
 		return window.NewSlidingTimeWindow(functions.AddSampleCount, functions.AggregateBlocksSum, settings), nil
 	default:
+		if addFunc, mergeFunc, aggFunc, ok := statFunctions(function, settings); ok {
+			return window.NewSlidingTimeWindow(addFunc, functions.NewMergeBlocksFunc(mergeFunc, aggFunc), settings), nil
+		}
 		return nil, fmt.Errorf("unsupported function: %s", function)
 	}
 }
+
+// NewEventTimeWindow creates a new tumbling or sliding event time window, event time windows are
+// progressed by the timestamps of the samples
+func NewEventTimeWindow(function string, sliding bool, settings *window.Settings) (window.EventTimeWindow, error) {
+
+	addFunc, mergeFunc, aggFunc, err := mergeableFunctions(function, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sliding {
+		return window.NewTumblingEventTimeWindow(addFunc, mergeFunc, aggFunc, settings), nil
+	}
+
+	if settings.Resolution <= 0 || settings.Size%settings.Resolution != 0 {
+		return nil, fmt.Errorf("window size must be a multiple of the resolution")
+	}
+
+	return window.NewSlidingEventTimeWindow(addFunc, mergeFunc, aggFunc, settings), nil
+}
+
+// NewSessionWindow creates a new session window, the size of the window is the inactivity gap that closes a session
+func NewSessionWindow(function string, settings *window.Settings) (*window.SessionWindow, error) {
+
+	addFunc, mergeFunc, aggFunc, err := mergeableFunctions(function, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return window.NewSessionWindow(addFunc, mergeFunc, aggFunc, settings), nil
+}
+
+// NewHoppingWindow creates a new count based hopping window
+func NewHoppingWindow(function string, settings *window.Settings) (window.Window, error) {
+
+	addFunc, mergeFunc, aggFunc, err := mergeableFunctions(function, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return window.NewHoppingWindow(addFunc, mergeFunc, aggFunc, settings)
+}
+
+// NewHoppingTimeWindow creates a new time based hopping window, the window is progressed using the NextBlock() method
+func NewHoppingTimeWindow(function string, settings *window.Settings) (*window.HoppingTimeWindow, error) {
+
+	addFunc, mergeFunc, aggFunc, err := mergeableFunctions(function, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return window.NewHoppingTimeWindow(addFunc, mergeFunc, aggFunc, settings)
+}
+
+// mergeableFunctions returns the functions of windows that aggregate samples into partial results,
+// the merge function combines two partial results
+func mergeableFunctions(function string, settings *window.Settings) (addFunc, mergeFunc window.AddSampleFunc, aggFunc window.AggregateSingleFunc, err error) {
+	switch function {
+	case "avg":
+		return functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleAvg, nil
+	case "sum":
+		return functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, nil
+	case "min":
+		return functions.AddSampleMin, functions.AddSampleMin, functions.AggregateSingleNoopFunc, nil
+	case "max":
+		return functions.AddSampleMax, functions.AddSampleMax, functions.AggregateSingleNoopFunc, nil
+	case "count":
+		return functions.AddSampleCount, functions.AddSampleSum, functions.AggregateSingleNoopFunc, nil
+	case "accumulate":
+		return functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, nil
+	default:
+		if addFunc, mergeFunc, aggFunc, ok := statFunctions(function, settings); ok {
+			return addFunc, mergeFunc, aggFunc, nil
+		}
+		return nil, nil, nil, fmt.Errorf("unsupported function: %s", function)
+	}
+}
+
+// statFunctions returns the functions of the statistical aggregates, these accumulate the samples into
+// an intermediate state from which the result is computed
+func statFunctions(function string, settings *window.Settings) (addFunc, mergeFunc window.AddSampleFunc, aggFunc window.AggregateSingleFunc, ok bool) {
+	switch function {
+	case "variance":
+		return functions.AddSampleMoments, functions.MergeMoments, functions.AggregateSingleVariance, true
+	case "stddev":
+		return functions.AddSampleMoments, functions.MergeMoments, functions.AggregateSingleStdDev, true
+	case "median", "p50":
+		return functions.AddSampleDigest, functions.MergeDigest, functions.NewAggregateSingleQuantile(0.5), true
+	case "p90":
+		return functions.AddSampleDigest, functions.MergeDigest, functions.NewAggregateSingleQuantile(0.9), true
+	case "p95":
+		return functions.AddSampleDigest, functions.MergeDigest, functions.NewAggregateSingleQuantile(0.95), true
+	case "p99":
+		return functions.AddSampleDigest, functions.MergeDigest, functions.NewAggregateSingleQuantile(0.99), true
+	case "quantile":
+		return functions.AddSampleDigest, functions.MergeDigest, functions.NewAggregateSingleQuantile(settings.Quantile), true
+	case "first":
+		return functions.AddSampleFirst, functions.MergeFirst, functions.AggregateSingleFirst, true
+	case "last":
+		return functions.AddSampleLast, functions.MergeLast, functions.AggregateSingleLast, true
+	case "distinctCount":
+		return functions.AddSampleDistinct, functions.MergeDistinct, functions.AggregateSingleDistinctCount, true
+	case "range":
+		return functions.AddSampleRange, functions.MergeRange, functions.AggregateSingleRange, true
+	case "topK":
+		addFunc, mergeFunc, aggFunc := functions.NewTopKFuncs(settings.K, settings.TopKCapacity, settings.TopKSketch, settings.TopKKey, settings.TopKValue)
+		return addFunc, mergeFunc, aggFunc, true
+	default:
+		return nil, nil, nil, false
+	}
+}
+
+// Aggregation is a named aggregation of a field of the samples
+type Aggregation struct {
+	Name     string
+	Function string
+	Field    string
+}
+
+// NewCompositeWindow creates a window that computes several named aggregations of the samples, the result
+// of the window is a map of the result of each aggregation by name
+func NewCompositeWindow(windowType string, eventTime bool, aggregations []*Aggregation, settings *window.Settings) (window.Window, error) {
+
+	parts := make([]*functions.Part, len(aggregations))
+	for i, aggregation := range aggregations {
+		addFunc, mergeFunc, aggFunc, err := mergeableFunctions(aggregation.Function, settings)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = &functions.Part{Name: aggregation.Name, Field: aggregation.Field, AddFunc: addFunc, MergeFunc: mergeFunc, AggFunc: aggFunc}
+	}
+
+	addFunc, mergeFunc, aggFunc := functions.NewCompositeFuncs(parts)
+
+	if eventTime {
+		switch windowType {
+		case "timetumbling":
+			return window.NewTumblingEventTimeWindow(addFunc, mergeFunc, aggFunc, settings), nil
+		case "timesliding":
+			if settings.Resolution <= 0 || settings.Size%settings.Resolution != 0 {
+				return nil, fmt.Errorf("window size must be a multiple of the resolution")
+			}
+			return window.NewSlidingEventTimeWindow(addFunc, mergeFunc, aggFunc, settings), nil
+		case "session":
+			return window.NewSessionWindow(addFunc, mergeFunc, aggFunc, settings), nil
+		default:
+			return nil, fmt.Errorf("event time is not supported by window type: '%s'", windowType)
+		}
+	}
+
+	switch windowType {
+	case "tumbling":
+		return window.NewTumblingWindow(addFunc, aggFunc, settings), nil
+	case "sliding":
+		return window.NewSlidingWindow(functions.NewSampleBlocksFunc(addFunc, aggFunc), settings), nil
+	case "timetumbling":
+		return window.NewTumblingTimeWindow(addFunc, aggFunc, settings), nil
+	case "timesliding":
+		return window.NewSlidingTimeWindow(addFunc, functions.NewMergeBlocksFunc(mergeFunc, aggFunc), settings), nil
+	case "hopping":
+		return window.NewHoppingWindow(addFunc, mergeFunc, aggFunc, settings)
+	case "timehopping":
+		hw, err := window.NewHoppingTimeWindow(addFunc, mergeFunc, aggFunc, settings)
+		if err != nil {
+			return nil, err
+		}
+		return hw, nil
+	case "session":
+		return window.NewSessionWindow(addFunc, mergeFunc, aggFunc, settings), nil
+	default:
+		return nil, fmt.Errorf("unsupported window type: '%s'", windowType)
+	}
+}
+
+// NewTypedWindow creates a window for numeric samples that aggregates them without boxing them, the format
+// of the samples is the sample type if specified, otherwise the format of the first sample. Returns false
+// if the function, the window type or the sample isn't supported by typed windows.
+func NewTypedWindow(function, windowType, sampleType string, sample interface{}, settings *window.Settings) (window.Window, bool, error) {
+
+	var format window.Format
+
+	if sampleType != "" {
+		var err error
+		format, err = window.ParseSampleType(sampleType)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		var ok bool
+		format, ok = window.FormatOf(sample)
+		if !ok {
+			return nil, false, nil
+		}
+	}
+
+	if format.Float {
+		return newTypedWindow[float64](function, windowType, format, settings)
+	}
+
+	return newTypedWindow[int64](function, windowType, format, settings)
+}
+
+func newTypedWindow[T functions.Number](function, windowType string, format window.Format, settings *window.Settings) (window.Window, bool, error) {
+
+	fn, ok := functions.NewFunc[T](function)
+	if !ok || settings.NameKey != "" {
+		return nil, false, nil
+	}
+
+	switch windowType {
+	case "tumbling":
+		return window.NewTypedTumblingWindow(fn, format, settings), true, nil
+	case "sliding":
+		return window.NewTypedSlidingWindow(fn, format, settings), true, nil
+	case "timetumbling":
+		return window.NewTypedTumblingTimeWindow(fn, format, settings), true, nil
+	case "timesliding":
+		return window.NewTypedSlidingTimeWindow(fn, format, settings), true, nil
+	default:
+		return nil, false, nil
+	}
+}
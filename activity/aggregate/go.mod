@@ -6,4 +6,13 @@ require (
 	github.com/stretchr/testify v1.4.0
 )
 
-go 1.12
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.5.1 // indirect
+	go.uber.org/multierr v1.4.0 // indirect
+	go.uber.org/zap v1.9.1 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
+
+go 1.18
@@ -0,0 +1,299 @@
+package window
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/stream/activity/aggregate/window/functions"
+)
+
+// EventTimeWindow a time window whose boundaries are determined by the timestamps of the samples instead
+// of the time they are received. Windows are aligned to the epoch and are closed by a watermark that trails
+// the highest timestamp seen by the configured out-of-orderness bound.
+type EventTimeWindow interface {
+	Window
+
+	// AddEvent adds a sample that occurred at the specified time (millis since the epoch), it returns the
+	// results of the windows closed or updated by the sample and if the sample was too late to be added
+	AddEvent(sample interface{}, timestamp int64) (results []*Result, late bool)
+
+	// CloseAll closes all the open windows regardless of the watermark
+	CloseAll() []*Result
+
+	// LateCount returns the number of samples that were too late to be added
+	LateCount() int
+}
+
+// Result is the result of an event time window
+type Result struct {
+	Start int64
+	End   int64
+	Count int
+	Value interface{}
+
+	// Update indicates that the result replaces a previous result of the window because of a late sample
+	Update bool
+}
+
+// NewTumblingEventTimeWindow creates a tumbling event time window, the size of the window is in millis
+func NewTumblingEventTimeWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) EventTimeWindow {
+	return newEventTimeWindow(addFunc, mergeFunc, aggFunc, settings, int64(settings.Size))
+}
+
+// NewSlidingEventTimeWindow creates a sliding event time window, the window slides by the resolution,
+// the size of the window must be a multiple of the resolution
+func NewSlidingEventTimeWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) EventTimeWindow {
+	return newEventTimeWindow(addFunc, mergeFunc, aggFunc, settings, int64(settings.Resolution))
+}
+
+func newEventTimeWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings, slide int64) *SlidingEventTimeWindow {
+
+	w := &SlidingEventTimeWindow{addFunc: addFunc, mergeFunc: mergeFunc, aggFunc: aggFunc, settings: settings}
+	w.size = int64(settings.Size)
+	w.slide = slide
+	w.panes = make(map[int64]*pane)
+
+	return w
+}
+
+// SlidingEventTimeWindow - An event time window that slides by a fixed interval, a tumbling window is
+// a sliding window whose interval matches its size. The samples are aggregated into panes, one per interval,
+// and the panes of a window are merged when the window is closed.
+type SlidingEventTimeWindow struct {
+	addFunc   AddSampleFunc
+	mergeFunc AddSampleFunc
+	aggFunc   AggregateSingleFunc
+	settings  *Settings
+
+	size  int64
+	slide int64
+
+	panes        map[int64]*pane
+	maxTimestamp int64
+	started      bool
+	lateCount    int
+
+	mutex sync.Mutex
+}
+
+type pane struct {
+	count int
+	value interface{}
+}
+
+// AddSample implements window.Window.AddSample, the sample is timestamped with the current time
+func (w *SlidingEventTimeWindow) AddSample(sample interface{}) (bool, interface{}) {
+
+	results, _ := w.AddEvent(sample, time.Now().UnixNano()/int64(time.Millisecond))
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	return true, results[len(results)-1].Value
+}
+
+// AddEvent implements window.EventTimeWindow.AddEvent
+func (w *SlidingEventTimeWindow) AddEvent(sample interface{}, timestamp int64) (results []*Result, late bool) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if s, ok := sample.(string); ok {
+		sample, _ = coerce.ToFloat64(s)
+		//warn
+	}
+
+	paneStart := floorMillis(timestamp, w.slide)
+
+	if w.started {
+		watermark := w.watermark()
+
+		//the last window containing the sample starts with its pane
+		if paneStart+w.size+w.lateness() <= watermark {
+			w.lateCount++
+			return nil, true
+		}
+	}
+
+	p := w.panes[paneStart]
+	if p == nil {
+		p = &pane{}
+		w.panes[paneStart] = p
+	}
+	p.value = w.addFunc(p.value, sample)
+	p.count++
+
+	if w.started {
+		//re-emit the closed windows that still accept late samples
+		watermark := w.watermark()
+		for _, start := range w.windowStarts(paneStart) {
+			end := start + w.size
+			if end <= watermark && end+w.lateness() > watermark {
+				result := w.result(start)
+				result.Update = true
+				results = append(results, result)
+			}
+		}
+	}
+
+	if !w.started || timestamp > w.maxTimestamp {
+
+		oldWatermark := w.watermark()
+		started := w.started
+
+		w.maxTimestamp = timestamp
+		w.started = true
+
+		results = append(results, w.closeWindows(started, oldWatermark, w.watermark())...)
+	}
+
+	return results, false
+}
+
+// CloseAll implements window.EventTimeWindow.CloseAll
+func (w *SlidingEventTimeWindow) CloseAll() []*Result {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	results := w.closeWindows(w.started, w.watermark(), maxMillis)
+	w.panes = make(map[int64]*pane)
+
+	return results
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *SlidingEventTimeWindow) Flush() (bool, interface{}) {
+
+	results := w.CloseAll()
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	return true, results[len(results)-1].Value
+}
+
+// LateCount implements window.EventTimeWindow.LateCount
+func (w *SlidingEventTimeWindow) LateCount() int {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.lateCount
+}
+
+func (w *SlidingEventTimeWindow) watermark() int64 {
+	return w.maxTimestamp - int64(w.settings.MaxOutOfOrderness)
+}
+
+func (w *SlidingEventTimeWindow) lateness() int64 {
+	return int64(w.settings.AllowedLateness)
+}
+
+// closeWindows emits the windows that end after from (if bounded) and no later than to,
+// the panes that are no longer part of a window that accepts late samples are discarded
+func (w *SlidingEventTimeWindow) closeWindows(bounded bool, from, to int64) []*Result {
+
+	closing := make(map[int64]bool)
+
+	for paneStart := range w.panes {
+		for _, start := range w.windowStarts(paneStart) {
+			end := start + w.size
+			if (!bounded || end > from) && end <= to {
+				closing[start] = true
+			}
+		}
+	}
+
+	starts := make([]int64, 0, len(closing))
+	for start := range closing {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	results := make([]*Result, 0, len(starts))
+	for _, start := range starts {
+		results = append(results, w.result(start))
+	}
+
+	for paneStart := range w.panes {
+		if paneStart+w.size+w.lateness() <= to {
+			delete(w.panes, paneStart)
+		}
+	}
+
+	return results
+}
+
+// windowStarts returns the start of the windows that contain the pane
+func (w *SlidingEventTimeWindow) windowStarts(paneStart int64) []int64 {
+
+	starts := make([]int64, 0, w.size/w.slide)
+	for start := paneStart; start > paneStart-w.size; start -= w.slide {
+		starts = append(starts, start)
+	}
+
+	return starts
+}
+
+// result merges the panes of the window that starts at the specified time
+func (w *SlidingEventTimeWindow) result(start int64) *Result {
+
+	result := &Result{Start: start, End: start + w.size}
+
+	var value interface{}
+	for paneStart := start; paneStart < result.End; paneStart += w.slide {
+		p := w.panes[paneStart]
+		if p == nil {
+			continue
+		}
+
+		if value == nil {
+			//the merge functions update their first argument
+			value = clone(p.value)
+		} else {
+			value = w.mergeFunc(value, p.value)
+		}
+		result.Count += p.count
+	}
+
+	result.Value = w.aggFunc(value, result.Count)
+
+	return result
+}
+
+const maxMillis = int64(^uint64(0) >> 1)
+
+// floorMillis aligns the timestamp to the epoch based interval that contains it
+func floorMillis(timestamp, interval int64) int64 {
+
+	start := timestamp - timestamp%interval
+	if timestamp < 0 && start != timestamp {
+		start -= interval
+	}
+
+	return start
+}
+
+func clone(a interface{}) interface{} {
+	switch x := a.(type) {
+	case functions.Accumulator:
+		return x.Clone()
+	case []int:
+		ret := make([]int, len(x))
+		copy(ret, x)
+		return ret
+	case []float64:
+		ret := make([]float64, len(x))
+		copy(ret, x)
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(x))
+		copy(ret, x)
+		return ret
+	}
+
+	return a
+}
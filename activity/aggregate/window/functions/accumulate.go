@@ -26,3 +26,14 @@ func AggregateBlocksAccumulate(blocks []interface{}, start int, size int) interf
 
 	return accum
 }
+
+func MergeAccum(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	return append(a.([]interface{}), b.([]interface{})...)
+}
@@ -0,0 +1,204 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Accumulator is the intermediate state of a function that can't be represented by a simple value,
+// accumulators are serialized as json using their exported fields
+type Accumulator interface {
+	// Type returns the type of the accumulator, used to recreate it
+	Type() string
+
+	// Clone returns a copy of the accumulator
+	Clone() Accumulator
+}
+
+var accumulatorFactories = make(map[string]func() Accumulator)
+
+func registerAccumulator(accType string, factory func() Accumulator) {
+	accumulatorFactories[accType] = factory
+}
+
+// NewAccumulator creates an empty accumulator of the specified type
+func NewAccumulator(accType string) (Accumulator, error) {
+
+	factory, exists := accumulatorFactories[accType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported accumulator type: %s", accType)
+	}
+
+	return factory(), nil
+}
+
+// NewSampleBlocksFunc creates a blocks function for windows whose blocks contain the individual samples,
+// the samples are added to a new accumulator starting with the block after start (the oldest)
+func NewSampleBlocksFunc(addFunc func(a, b interface{}) interface{}, aggFunc func(a interface{}, count int) interface{}) func(blocks []interface{}, start int, size int) interface{} {
+
+	return func(blocks []interface{}, start int, size int) interface{} {
+
+		var value interface{}
+		count := 0
+
+		for i := 1; i <= len(blocks); i++ {
+			sample := blocks[(start+i)%len(blocks)]
+			if sample == nil {
+				continue
+			}
+			value = addFunc(value, sample)
+			count++
+		}
+
+		return aggFunc(value, count)
+	}
+}
+
+// NewMergeBlocksFunc creates a blocks function for windows whose blocks contain accumulated values,
+// the blocks are merged starting with the block at start (the oldest)
+func NewMergeBlocksFunc(mergeFunc func(a, b interface{}) interface{}, aggFunc func(a interface{}, count int) interface{}) func(blocks []interface{}, start int, size int) interface{} {
+
+	return func(blocks []interface{}, start int, size int) interface{} {
+
+		var value interface{}
+
+		for i := 0; i < len(blocks); i++ {
+			block := blocks[(start+i)%len(blocks)]
+			if block == nil {
+				continue
+			}
+
+			if value == nil {
+				//merge functions update their first argument
+				value = cloneValue(block)
+			} else {
+				value = mergeFunc(value, block)
+			}
+		}
+
+		return aggFunc(value, size)
+	}
+}
+
+// toFloats converts a numeric sample to its dimensions, vector indicates if the sample is an array
+func toFloats(sample interface{}) (values []float64, vector bool, err error) {
+
+	switch t := sample.(type) {
+	case int:
+		return []float64{float64(t)}, false, nil
+	case float64:
+		return []float64{t}, false, nil
+	case []int:
+		values = make([]float64, len(t))
+		for i, v := range t {
+			values[i] = float64(v)
+		}
+		return values, true, nil
+	case []float64:
+		values = make([]float64, len(t))
+		copy(values, t)
+		return values, true, nil
+	}
+
+	return nil, false, fmt.Errorf("unsupported sample type: %T", sample)
+}
+
+// fromFloats converts the dimensions of a result back to a scalar or an array
+func fromFloats(values []float64, vector bool) interface{} {
+
+	if vector {
+		return values
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	return values[0]
+}
+
+func cloneValue(a interface{}) interface{} {
+
+	switch x := a.(type) {
+	case Accumulator:
+		return x.Clone()
+	case []int:
+		ret := make([]int, len(x))
+		copy(ret, x)
+		return ret
+	case []float64:
+		ret := make([]float64, len(x))
+		copy(ret, x)
+		return ret
+	}
+
+	return a
+}
+
+// Sample is a sample whose type is preserved when it is serialized
+type Sample struct {
+	Value interface{}
+}
+
+type typedSample struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler.MarshalJSON
+func (s Sample) MarshalJSON() ([]byte, error) {
+
+	value, err := json.Marshal(s.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleType := "any"
+	switch s.Value.(type) {
+	case int:
+		sampleType = "int"
+	case float64:
+		sampleType = "float64"
+	case []int:
+		sampleType = "[]int"
+	case []float64:
+		sampleType = "[]float64"
+	}
+
+	return json.Marshal(&typedSample{Type: sampleType, Value: value})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.UnmarshalJSON
+func (s *Sample) UnmarshalJSON(data []byte) error {
+
+	ts := &typedSample{}
+	err := json.Unmarshal(data, ts)
+	if err != nil {
+		return err
+	}
+
+	switch ts.Type {
+	case "int":
+		var v int
+		err = json.Unmarshal(ts.Value, &v)
+		s.Value = v
+	case "float64":
+		var v float64
+		err = json.Unmarshal(ts.Value, &v)
+		s.Value = v
+	case "[]int":
+		var v []int
+		err = json.Unmarshal(ts.Value, &v)
+		s.Value = v
+	case "[]float64":
+		var v []float64
+		err = json.Unmarshal(ts.Value, &v)
+		s.Value = v
+	default:
+		var v interface{}
+		err = json.Unmarshal(ts.Value, &v)
+		s.Value = v
+	}
+
+	return err
+}
@@ -0,0 +1,232 @@
+package functions
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+const accComposite = "composite"
+
+func init() {
+	registerAccumulator(accComposite, func() Accumulator { return &Composite{} })
+}
+
+// Part is a named aggregation of a composite, the part aggregates the value of a field of the samples
+type Part struct {
+	Name string
+	// Field is the field of the sample that is aggregated, nested fields are separated by dots,
+	// if empty the sample itself is aggregated
+	Field string
+
+	AddFunc   func(a, b interface{}) interface{}
+	MergeFunc func(a, b interface{}) interface{}
+	AggFunc   func(a interface{}, count int) interface{}
+}
+
+// value returns the value of the field of the sample
+func (p *Part) value(sample interface{}) (interface{}, bool) {
+
+	val, ok := fieldValue(sample, p.Field)
+	if !ok {
+		return nil, false
+	}
+
+	if s, ok := val.(string); ok {
+		if f, err := coerce.ToFloat64(s); err == nil {
+			return f, true
+		}
+	}
+
+	return val, true
+}
+
+// fieldValue returns the value of the field of the sample, nested fields are separated by dots,
+// if the field is empty the sample itself is returned
+func fieldValue(sample interface{}, field string) (interface{}, bool) {
+
+	val := sample
+
+	if field != "" {
+		for _, key := range strings.Split(field, ".") {
+			m, ok := val.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			val, ok = m[key]
+			if !ok {
+				return nil, false
+			}
+		}
+	}
+
+	return val, val != nil
+}
+
+// Composite tracks the values of several aggregations of the same samples, each part counts
+// its own samples since samples that don't contain the field of a part are skipped
+type Composite struct {
+	Values []interface{}
+	Counts []int
+}
+
+// Type implements functions.Accumulator.Type
+func (c *Composite) Type() string {
+	return accComposite
+}
+
+// Clone implements functions.Accumulator.Clone
+func (c *Composite) Clone() Accumulator {
+	clone := &Composite{Values: make([]interface{}, len(c.Values)), Counts: append([]int(nil), c.Counts...)}
+	for i, value := range c.Values {
+		clone.Values[i] = cloneValue(value)
+	}
+	return clone
+}
+
+type compositeValue struct {
+	Accumulator string          `json:"accumulator,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Sample      *Sample         `json:"sample,omitempty"`
+}
+
+type compositeJSON struct {
+	Values []*compositeValue `json:"values"`
+	Counts []int             `json:"counts"`
+}
+
+// MarshalJSON implements json.Marshaler.MarshalJSON
+func (c *Composite) MarshalJSON() ([]byte, error) {
+
+	values := make([]*compositeValue, len(c.Values))
+	for i, value := range c.Values {
+		switch t := value.(type) {
+		case nil:
+		case Accumulator:
+			data, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = &compositeValue{Accumulator: t.Type(), Data: data}
+		default:
+			values[i] = &compositeValue{Sample: &Sample{Value: t}}
+		}
+	}
+
+	return json.Marshal(&compositeJSON{Values: values, Counts: c.Counts})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.UnmarshalJSON
+func (c *Composite) UnmarshalJSON(data []byte) error {
+
+	cj := &compositeJSON{}
+	err := json.Unmarshal(data, cj)
+	if err != nil {
+		return err
+	}
+
+	c.Values = make([]interface{}, len(cj.Values))
+	c.Counts = cj.Counts
+
+	for i, value := range cj.Values {
+		switch {
+		case value == nil:
+		case value.Accumulator != "":
+			acc, err := NewAccumulator(value.Accumulator)
+			if err != nil {
+				return err
+			}
+			err = json.Unmarshal(value.Data, acc)
+			if err != nil {
+				return err
+			}
+			c.Values[i] = acc
+		case value.Sample != nil:
+			c.Values[i] = value.Sample.Value
+		}
+	}
+
+	return nil
+}
+
+// NewCompositeFuncs creates the functions of a composite aggregation, the aggregated result
+// is a map of the result of each part by name
+func NewCompositeFuncs(parts []*Part) (addFunc, mergeFunc func(a, b interface{}) interface{}, aggFunc func(a interface{}, count int) interface{}) {
+
+	newComposite := func() *Composite {
+		return &Composite{Values: make([]interface{}, len(parts)), Counts: make([]int, len(parts))}
+	}
+
+	addFunc = func(a, b interface{}) interface{} {
+
+		c, ok := a.(*Composite)
+		if !ok {
+			c = newComposite()
+		}
+
+		for i, part := range parts {
+			val, ok := part.value(b)
+			if !ok {
+				continue
+			}
+
+			if c.Values[i] == nil {
+				//add functions may return the sample as the value
+				val = cloneValue(val)
+			}
+
+			c.Values[i] = part.AddFunc(c.Values[i], val)
+			c.Counts[i]++
+		}
+
+		return c
+	}
+
+	mergeFunc = func(a, b interface{}) interface{} {
+
+		if a == nil {
+			return b
+		} else if b == nil {
+			return a
+		}
+
+		c := a.(*Composite)
+		o := b.(*Composite)
+
+		for i, part := range parts {
+			if i >= len(o.Values) || o.Values[i] == nil {
+				continue
+			}
+
+			if c.Values[i] == nil {
+				c.Values[i] = cloneValue(o.Values[i])
+			} else {
+				c.Values[i] = part.MergeFunc(c.Values[i], o.Values[i])
+			}
+			c.Counts[i] += o.Counts[i]
+		}
+
+		return c
+	}
+
+	aggFunc = func(a interface{}, count int) interface{} {
+
+		results := make(map[string]interface{}, len(parts))
+
+		c, ok := a.(*Composite)
+
+		for i, part := range parts {
+			if !ok || c.Counts[i] == 0 {
+				results[part.Name] = nil
+				continue
+			}
+
+			results[part.Name] = part.AggFunc(c.Values[i], c.Counts[i])
+		}
+
+		return results
+	}
+
+	return addFunc, mergeFunc, aggFunc
+}
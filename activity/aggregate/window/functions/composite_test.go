@@ -0,0 +1,69 @@
+package functions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compositeParts() []*Part {
+	return []*Part{
+		{Name: "min", Field: "temp", AddFunc: AddSampleMin, MergeFunc: AddSampleMin, AggFunc: AggregateSingleNoopFunc},
+		{Name: "avg", Field: "temp", AddFunc: AddSampleSum, MergeFunc: AddSampleSum, AggFunc: AggregateSingleAvg},
+		{Name: "stddev", Field: "temp", AddFunc: AddSampleMoments, MergeFunc: MergeMoments, AggFunc: AggregateSingleStdDev},
+		{Name: "last", Field: "device.id", AddFunc: AddSampleLast, MergeFunc: MergeLast, AggFunc: AggregateSingleLast},
+	}
+}
+
+func TestComposite(t *testing.T) {
+
+	addFunc, _, aggFunc := NewCompositeFuncs(compositeParts())
+
+	var c interface{}
+	c = addFunc(c, map[string]interface{}{"temp": 3.0, "device": map[string]interface{}{"id": "a"}})
+	c = addFunc(c, map[string]interface{}{"temp": "5", "device": map[string]interface{}{"id": "b"}})
+	//samples without the field are skipped by the part
+	c = addFunc(c, map[string]interface{}{"device": map[string]interface{}{"id": "c"}})
+
+	result := aggFunc(c, 3).(map[string]interface{})
+	assert.Equal(t, 3.0, result["min"])
+	assert.Equal(t, 4.0, result["avg"])
+	assert.InDelta(t, 1.414, result["stddev"], 0.001)
+	assert.Equal(t, "c", result["last"])
+
+	empty := aggFunc(nil, 0).(map[string]interface{})
+	assert.Len(t, empty, 4)
+	assert.Nil(t, empty["avg"])
+}
+
+func TestMergeComposite(t *testing.T) {
+
+	addFunc, mergeFunc, aggFunc := NewCompositeFuncs(compositeParts())
+
+	a := addFunc(nil, map[string]interface{}{"temp": 2.0})
+	b := addFunc(nil, map[string]interface{}{"temp": 6.0, "device": map[string]interface{}{"id": "b"}})
+
+	result := aggFunc(mergeFunc(a, b), 2).(map[string]interface{})
+	assert.Equal(t, 2.0, result["min"])
+	assert.Equal(t, 4.0, result["avg"])
+	assert.Equal(t, "b", result["last"])
+}
+
+func TestCompositeJSON(t *testing.T) {
+
+	addFunc, _, aggFunc := NewCompositeFuncs(compositeParts())
+
+	c := addFunc(nil, map[string]interface{}{"temp": 3.0})
+	c = addFunc(c, map[string]interface{}{"temp": 5.0})
+
+	data, err := json.Marshal(c)
+	assert.Nil(t, err)
+
+	acc, err := NewAccumulator(accComposite)
+	assert.Nil(t, err)
+	err = json.Unmarshal(data, acc)
+	assert.Nil(t, err)
+
+	assert.Equal(t, aggFunc(c, 2), aggFunc(acc, 2))
+}
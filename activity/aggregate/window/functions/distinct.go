@@ -0,0 +1,145 @@
+package functions
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	accDistinct = "distinct"
+
+	// hllPrecision is the number of bits of the hash used to select a register, 2^12 registers
+	// gives a standard error of about 1.6%
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+)
+
+func init() {
+	registerAccumulator(accDistinct, func() Accumulator { return &HyperLogLog{} })
+}
+
+// HyperLogLog estimates the number of distinct samples, small cardinalities are counted
+// using linear counting which is close to exact
+type HyperLogLog struct {
+	Registers []byte `json:"registers"`
+}
+
+// Type implements functions.Accumulator.Type
+func (h *HyperLogLog) Type() string {
+	return accDistinct
+}
+
+// Clone implements functions.Accumulator.Clone
+func (h *HyperLogLog) Clone() Accumulator {
+	return &HyperLogLog{Registers: append([]byte(nil), h.Registers...)}
+}
+
+// Add adds a sample, samples are compared using their string representation
+func (h *HyperLogLog) Add(sample interface{}) {
+
+	if h.Registers == nil {
+		h.Registers = make([]byte, hllRegisters)
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(fmt.Sprint(sample)))
+	x := mix64(hash.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	rank := byte(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	if rank > h.Registers[idx] {
+		h.Registers[idx] = rank
+	}
+}
+
+// Merge merges the registers of another HyperLogLog
+func (h *HyperLogLog) Merge(o *HyperLogLog) {
+
+	if h.Registers == nil {
+		h.Registers = make([]byte, hllRegisters)
+	}
+
+	for i, rank := range o.Registers {
+		if rank > h.Registers[i] {
+			h.Registers[i] = rank
+		}
+	}
+}
+
+// Count returns the estimated number of distinct samples
+func (h *HyperLogLog) Count() int {
+
+	if h.Registers == nil {
+		return 0
+	}
+
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+
+	for _, rank := range h.Registers {
+		sum += math.Pow(2, -float64(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	if estimate <= 2.5*m && zeros > 0 {
+		//linear counting
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int(math.Round(estimate))
+}
+
+// mix64 is the murmur3 finalizer, it spreads the bits of the fnv hash
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func AddSampleDistinct(a, b interface{}) interface{} {
+
+	h, ok := a.(*HyperLogLog)
+	if !ok {
+		h = &HyperLogLog{}
+	}
+
+	h.Add(b)
+
+	return h
+}
+
+func MergeDistinct(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	h := a.(*HyperLogLog)
+	h.Merge(b.(*HyperLogLog))
+
+	return h
+}
+
+func AggregateSingleDistinctCount(a interface{}, count int) interface{} {
+
+	h, ok := a.(*HyperLogLog)
+	if !ok {
+		return 0
+	}
+
+	return h.Count()
+}
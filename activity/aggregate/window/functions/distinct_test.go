@@ -0,0 +1,29 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSampleDistinct(t *testing.T) {
+
+	var x interface{}
+	for _, val := range []interface{}{1, 2, 2, 3, 1, "a"} {
+		x = AddSampleDistinct(x, val)
+	}
+
+	assert.Equal(t, 4, AggregateSingleDistinctCount(x, 6))
+}
+
+func TestDistinctEstimate(t *testing.T) {
+
+	var x, y interface{}
+	for i := 0; i < 60000; i++ {
+		x = AddSampleDistinct(x, i)
+		y = AddSampleDistinct(y, i+40000)
+	}
+	x = MergeDistinct(x, y)
+
+	assert.InEpsilon(t, 100000, AggregateSingleDistinctCount(x, 0), 0.05)
+}
@@ -0,0 +1,243 @@
+package functions
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	accDigests = "digests"
+
+	// digestCompression bounds the number of centroids kept by a digest
+	digestCompression = 100
+)
+
+func init() {
+	registerAccumulator(accDigests, func() Accumulator { return &Digests{} })
+}
+
+// Digests tracks the distribution of the samples using a t-digest per dimension, quantiles are exact
+// until the number of samples exceeds the capacity of the digest, after which they are estimated
+type Digests struct {
+	Digests []*Digest `json:"digests"`
+	Vector  bool      `json:"vector,omitempty"`
+}
+
+// Type implements functions.Accumulator.Type
+func (d *Digests) Type() string {
+	return accDigests
+}
+
+// Clone implements functions.Accumulator.Clone
+func (d *Digests) Clone() Accumulator {
+	c := &Digests{Vector: d.Vector, Digests: make([]*Digest, len(d.Digests))}
+	for i, digest := range d.Digests {
+		c.Digests[i] = digest.clone()
+	}
+	return c
+}
+
+// Quantile returns the estimated quantile of each dimension
+func (d *Digests) Quantile(q float64) []float64 {
+
+	quantiles := make([]float64, len(d.Digests))
+	for i, digest := range d.Digests {
+		quantiles[i] = digest.Quantile(q)
+	}
+
+	return quantiles
+}
+
+// Digest is a merging t-digest, the centroids are kept sorted by mean once compressed
+type Digest struct {
+	Means   []float64 `json:"means"`
+	Weights []float64 `json:"weights"`
+	Count   float64   `json:"count"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+}
+
+func (d *Digest) clone() *Digest {
+	c := &Digest{Count: d.Count, Min: d.Min, Max: d.Max}
+	c.Means = append([]float64(nil), d.Means...)
+	c.Weights = append([]float64(nil), d.Weights...)
+	return c
+}
+
+// Add adds a sample to the digest
+func (d *Digest) Add(value float64) {
+	d.add(value, 1)
+}
+
+// Merge merges another digest
+func (d *Digest) Merge(o *Digest) {
+	for i, mean := range o.Means {
+		d.add(mean, o.Weights[i])
+	}
+	if o.Count > 0 {
+		d.Min = math.Min(d.Min, o.Min)
+		d.Max = math.Max(d.Max, o.Max)
+	}
+}
+
+func (d *Digest) add(mean, weight float64) {
+
+	if d.Count == 0 {
+		d.Min, d.Max = mean, mean
+	} else {
+		d.Min = math.Min(d.Min, mean)
+		d.Max = math.Max(d.Max, mean)
+	}
+
+	d.Means = append(d.Means, mean)
+	d.Weights = append(d.Weights, weight)
+	d.Count += weight
+
+	if len(d.Means) > 10*digestCompression {
+		d.compress()
+	}
+}
+
+// compress sorts the centroids and merges neighbouring centroids while they stay within the size
+// limit of their quantile, the limit is smaller at the tails to keep the extreme quantiles accurate
+func (d *Digest) compress() {
+
+	sort.Sort(centroids{d})
+
+	if len(d.Means) <= 1 {
+		return
+	}
+
+	means := make([]float64, 0, len(d.Means))
+	weights := make([]float64, 0, len(d.Weights))
+
+	cumulative := 0.0
+	mean, weight := d.Means[0], d.Weights[0]
+
+	for i := 1; i < len(d.Means); i++ {
+		proposed := weight + d.Weights[i]
+		q := (cumulative + proposed/2) / d.Count
+		limit := 4 * d.Count * q * (1 - q) / digestCompression
+
+		if proposed <= limit {
+			mean += (d.Means[i] - mean) * d.Weights[i] / proposed
+			weight = proposed
+		} else {
+			means = append(means, mean)
+			weights = append(weights, weight)
+			cumulative += weight
+			mean, weight = d.Means[i], d.Weights[i]
+		}
+	}
+
+	d.Means = append(means, mean)
+	d.Weights = append(weights, weight)
+}
+
+// Quantile returns the estimated value at the quantile q (0 <= q <= 1)
+func (d *Digest) Quantile(q float64) float64 {
+
+	if d.Count == 0 {
+		return math.NaN()
+	}
+
+	sort.Sort(centroids{d})
+
+	if len(d.Means) == 1 {
+		return d.Means[0]
+	}
+
+	target := q * d.Count
+
+	//interpolate between the centers of the centroids, the tails are interpolated to the min and the max
+	prevCenter, prevMean := 0.0, d.Min
+	cumulative := 0.0
+
+	for i, mean := range d.Means {
+		center := cumulative + d.Weights[i]/2
+		if target < center {
+			if center == prevCenter {
+				return mean
+			}
+			return prevMean + (mean-prevMean)*(target-prevCenter)/(center-prevCenter)
+		}
+		prevCenter, prevMean = center, mean
+		cumulative += d.Weights[i]
+	}
+
+	if d.Count == prevCenter {
+		return d.Max
+	}
+
+	return prevMean + (d.Max-prevMean)*(target-prevCenter)/(d.Count-prevCenter)
+}
+
+type centroids struct {
+	d *Digest
+}
+
+func (c centroids) Len() int {
+	return len(c.d.Means)
+}
+
+func (c centroids) Less(i, j int) bool {
+	return c.d.Means[i] < c.d.Means[j]
+}
+
+func (c centroids) Swap(i, j int) {
+	c.d.Means[i], c.d.Means[j] = c.d.Means[j], c.d.Means[i]
+	c.d.Weights[i], c.d.Weights[j] = c.d.Weights[j], c.d.Weights[i]
+}
+
+func AddSampleDigest(a, b interface{}) interface{} {
+
+	values, vector, err := toFloats(b)
+	if err != nil {
+		//todo handle error
+		return a
+	}
+
+	d, ok := a.(*Digests)
+	if !ok {
+		d = &Digests{Vector: vector, Digests: make([]*Digest, len(values))}
+		for i := range d.Digests {
+			d.Digests[i] = &Digest{}
+		}
+	}
+
+	for i := 0; i < len(values) && i < len(d.Digests); i++ {
+		d.Digests[i].Add(values[i])
+	}
+
+	return d
+}
+
+func MergeDigest(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	d := a.(*Digests)
+	o := b.(*Digests)
+	for i := 0; i < len(d.Digests) && i < len(o.Digests); i++ {
+		d.Digests[i].Merge(o.Digests[i])
+	}
+
+	return d
+}
+
+// NewAggregateSingleQuantile creates a function that returns the quantile q (0 <= q <= 1) of the samples
+func NewAggregateSingleQuantile(q float64) func(a interface{}, count int) interface{} {
+
+	return func(a interface{}, count int) interface{} {
+		d, ok := a.(*Digests)
+		if !ok {
+			return nil
+		}
+
+		return fromFloats(d.Quantile(q), d.Vector)
+	}
+}
@@ -0,0 +1,49 @@
+package functions
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSampleDigest(t *testing.T) {
+
+	var x interface{}
+	for _, val := range []int{5, 1, 4, 2, 3} {
+		x = AddSampleDigest(x, val)
+	}
+
+	assert.Equal(t, 3.0, NewAggregateSingleQuantile(0.5)(x, 5))
+	assert.Equal(t, 1.0, NewAggregateSingleQuantile(0)(x, 5))
+	assert.Equal(t, 5.0, NewAggregateSingleQuantile(1)(x, 5))
+
+	x = AddSampleDigest(x, 6)
+	assert.Equal(t, 3.5, NewAggregateSingleQuantile(0.5)(x, 6))
+}
+
+func TestDigestEstimate(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+
+	var x, y interface{}
+	for i := 0; i < 50000; i++ {
+		x = AddSampleDigest(x, r.Float64()*1000)
+		y = AddSampleDigest(y, r.Float64()*1000)
+	}
+	x = MergeDigest(x, y)
+
+	//the digest is compressed, but remains accurate
+	assert.True(t, len(x.(*Digests).Digests[0].Means) <= 10*digestCompression)
+	assert.InDelta(t, 500, NewAggregateSingleQuantile(0.5)(x, 0), 10)
+	assert.InDelta(t, 990, NewAggregateSingleQuantile(0.99)(x, 0), 2)
+
+	data, err := json.Marshal(x)
+	assert.Nil(t, err)
+
+	restored, _ := NewAccumulator(accDigests)
+	err = json.Unmarshal(data, restored)
+	assert.Nil(t, err)
+	assert.Equal(t, NewAggregateSingleQuantile(0.9)(x, 0), NewAggregateSingleQuantile(0.9)(restored, 0))
+}
@@ -0,0 +1,204 @@
+package functions
+
+const (
+	accFirst = "first"
+	accLast  = "last"
+	accRange = "range"
+)
+
+func init() {
+	registerAccumulator(accFirst, func() Accumulator { return &First{} })
+	registerAccumulator(accLast, func() Accumulator { return &Last{} })
+	registerAccumulator(accRange, func() Accumulator { return &Range{} })
+}
+
+// First tracks the first sample
+type First struct {
+	Sample Sample `json:"sample"`
+}
+
+// Type implements functions.Accumulator.Type
+func (f *First) Type() string {
+	return accFirst
+}
+
+// Clone implements functions.Accumulator.Clone
+func (f *First) Clone() Accumulator {
+	return &First{Sample: f.Sample}
+}
+
+// Last tracks the last sample
+type Last struct {
+	Sample Sample `json:"sample"`
+}
+
+// Type implements functions.Accumulator.Type
+func (l *Last) Type() string {
+	return accLast
+}
+
+// Clone implements functions.Accumulator.Clone
+func (l *Last) Clone() Accumulator {
+	return &Last{Sample: l.Sample}
+}
+
+// Range tracks the minimum and the maximum of the samples
+type Range struct {
+	Min []float64 `json:"min"`
+	Max []float64 `json:"max"`
+	// Int indicates the samples are integers, so the range is an integer
+	Int    bool `json:"int,omitempty"`
+	Vector bool `json:"vector,omitempty"`
+}
+
+// Type implements functions.Accumulator.Type
+func (r *Range) Type() string {
+	return accRange
+}
+
+// Clone implements functions.Accumulator.Clone
+func (r *Range) Clone() Accumulator {
+	c := &Range{Int: r.Int, Vector: r.Vector}
+	c.Min = append([]float64(nil), r.Min...)
+	c.Max = append([]float64(nil), r.Max...)
+	return c
+}
+
+func (r *Range) add(min, max []float64) {
+
+	if r.Min == nil {
+		r.Min = append([]float64(nil), min...)
+		r.Max = append([]float64(nil), max...)
+		return
+	}
+
+	for i := 0; i < len(r.Min) && i < len(min); i++ {
+		if min[i] < r.Min[i] {
+			r.Min[i] = min[i]
+		}
+		if max[i] > r.Max[i] {
+			r.Max[i] = max[i]
+		}
+	}
+}
+
+func AddSampleFirst(a, b interface{}) interface{} {
+
+	if f, ok := a.(*First); ok {
+		return f
+	}
+
+	return &First{Sample: Sample{Value: cloneValue(b)}}
+}
+
+func MergeFirst(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	}
+
+	return a
+}
+
+func AggregateSingleFirst(a interface{}, count int) interface{} {
+
+	if f, ok := a.(*First); ok {
+		return f.Sample.Value
+	}
+
+	return nil
+}
+
+func AddSampleLast(a, b interface{}) interface{} {
+
+	l, ok := a.(*Last)
+	if !ok {
+		l = &Last{}
+	}
+
+	l.Sample.Value = cloneValue(b)
+
+	return l
+}
+
+func MergeLast(a, b interface{}) interface{} {
+
+	if b == nil {
+		return a
+	}
+
+	return b
+}
+
+func AggregateSingleLast(a interface{}, count int) interface{} {
+
+	if l, ok := a.(*Last); ok {
+		return l.Sample.Value
+	}
+
+	return nil
+}
+
+func AddSampleRange(a, b interface{}) interface{} {
+
+	values, vector, err := toFloats(b)
+	if err != nil {
+		//todo handle error
+		return a
+	}
+
+	r, ok := a.(*Range)
+	if !ok {
+		r = &Range{Vector: vector}
+		switch b.(type) {
+		case int, []int:
+			r.Int = true
+		}
+	}
+
+	r.add(values, values)
+
+	return r
+}
+
+func MergeRange(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	r := a.(*Range)
+	o := b.(*Range)
+	r.add(o.Min, o.Max)
+	r.Int = r.Int && o.Int
+
+	return r
+}
+
+func AggregateSingleRange(a interface{}, count int) interface{} {
+
+	r, ok := a.(*Range)
+	if !ok {
+		return nil
+	}
+
+	if r.Int {
+		ranges := make([]int, len(r.Min))
+		for i := range ranges {
+			ranges[i] = int(r.Max[i] - r.Min[i])
+		}
+		if r.Vector {
+			return ranges
+		}
+		return ranges[0]
+	}
+
+	ranges := make([]float64, len(r.Min))
+	for i := range ranges {
+		ranges[i] = r.Max[i] - r.Min[i]
+	}
+
+	return fromFloats(ranges, r.Vector)
+}
@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSampleFirstLast(t *testing.T) {
+
+	var first, last interface{}
+	for _, val := range []int{3, 1, 2} {
+		first = AddSampleFirst(first, val)
+		last = AddSampleLast(last, val)
+	}
+
+	assert.Equal(t, 3, AggregateSingleFirst(first, 3))
+	assert.Equal(t, 2, AggregateSingleLast(last, 3))
+
+	//type is preserved when serialized
+	data, err := json.Marshal(first)
+	assert.Nil(t, err)
+	restored := &First{}
+	err = json.Unmarshal(data, restored)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, AggregateSingleFirst(restored, 3))
+}
+
+func TestAddSampleRange(t *testing.T) {
+
+	var x interface{}
+	for _, val := range []int{3, 1, 7} {
+		x = AddSampleRange(x, val)
+	}
+	assert.Equal(t, 6, AggregateSingleRange(x, 3))
+
+	var y interface{}
+	y = AddSampleRange(y, 2.5)
+	y = AddSampleRange(y, 0.5)
+	assert.Equal(t, 2.0, AggregateSingleRange(y, 2))
+
+	var z interface{}
+	z = AddSampleRange(z, []int{1, 5})
+	z = AddSampleRange(z, []int{4, 2})
+	assert.Equal(t, []int{3, 3}, AggregateSingleRange(z, 2))
+}
@@ -3,7 +3,8 @@ package functions
 func AddSampleSum(a, b interface{}) interface{} {
 
 	if a == nil {
-		return b
+		//the sum is a copy of the first sample, so adding the following samples never changes it
+		return copySample(b)
 	} else if b == nil {
 		return a
 	}
@@ -15,16 +16,18 @@ func AddSampleSum(a, b interface{}) interface{} {
 		return x + b.(float64)
 	case []int:
 		y := b.([]int)
+		sum := make([]int, len(x))
 		for idx, value := range x {
-			x[idx] = value + y[idx]
+			sum[idx] = value + y[idx]
 		}
-		return x
+		return sum
 	case []float64:
 		y := b.([]float64)
+		sum := make([]float64, len(x))
 		for idx, value := range x {
-			x[idx] = value + y[idx]
+			sum[idx] = value + y[idx]
 		}
-		return x
+		return sum
 	}
 
 	//todo handle error
@@ -32,6 +35,17 @@ func AddSampleSum(a, b interface{}) interface{} {
 	return nil
 }
 
+// copySample copies the array samples, other samples are values
+func copySample(s interface{}) interface{} {
+	switch x := s.(type) {
+	case []int:
+		return append([]int(nil), x...)
+	case []float64:
+		return append([]float64(nil), x...)
+	}
+	return s
+}
+
 func AggregateBlocksSum(blocks []interface{}, start int, size int) interface{} {
 
 	switch blocks[0].(type) {
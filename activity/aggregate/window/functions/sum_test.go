@@ -26,6 +26,23 @@ func TestAddSampleSumFloat(t *testing.T) {
 	assert.Equal(t, 6, x)
 }
 
+func TestAddSampleSumArray(t *testing.T) {
+
+	a := []int{1, 2}
+	b := []int{3, 4}
+	x := AddSampleSum(a, b)
+
+	assert.Equal(t, []int{4, 6}, x)
+	//the samples are left untouched
+	assert.Equal(t, []int{1, 2}, a)
+
+	f := []float64{1.5, 2}
+	y := AddSampleSum(f, []float64{1, 1})
+
+	assert.Equal(t, []float64{2.5, 3}, y)
+	assert.Equal(t, []float64{1.5, 2}, f)
+}
+
 func TestAggregateBlocksSum(t *testing.T) {
 
 	//values - 5 samples/block
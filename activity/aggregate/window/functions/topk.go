@@ -0,0 +1,237 @@
+package functions
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+const (
+	accTopK = "topK"
+
+	// defaultTopK is the number of entries returned by default
+	defaultTopK = 10
+)
+
+func init() {
+	registerAccumulator(accTopK, func() Accumulator { return &TopK{} })
+}
+
+// TopK tracks the keys with the highest counts, or with the highest values if ranked by value. Counts are
+// exact unless the number of keys is bounded by a capacity, in which case the keys are tracked using the
+// space-saving algorithm and the counts of the top keys are upper bounds. Keys ranked by value only need
+// the k highest values to be tracked, so they are always exact.
+type TopK struct {
+	K        int                `json:"k"`
+	Capacity int                `json:"capacity,omitempty"`
+	ByValue  bool               `json:"byValue,omitempty"`
+	Counts   map[string]float64 `json:"counts"`
+}
+
+// Type implements functions.Accumulator.Type
+func (t *TopK) Type() string {
+	return accTopK
+}
+
+// Clone implements functions.Accumulator.Clone
+func (t *TopK) Clone() Accumulator {
+	c := &TopK{K: t.K, Capacity: t.Capacity, ByValue: t.ByValue, Counts: make(map[string]float64, len(t.Counts))}
+	for key, count := range t.Counts {
+		c.Counts[key] = count
+	}
+	return c
+}
+
+// Add adds a key with its weight, the weight is added to the count of the key or replaces
+// its value if it is higher when ranked by value
+func (t *TopK) Add(key string, weight float64) {
+
+	if t.Counts == nil {
+		t.Counts = make(map[string]float64)
+	}
+
+	current, exists := t.Counts[key]
+
+	switch {
+	case t.ByValue && exists:
+		if weight > current {
+			t.Counts[key] = weight
+		}
+	case t.ByValue:
+		if len(t.Counts) < t.K {
+			t.Counts[key] = weight
+		} else if minKey, min := t.min(); weight > min {
+			delete(t.Counts, minKey)
+			t.Counts[key] = weight
+		}
+	case exists:
+		t.Counts[key] = current + weight
+	case t.Capacity > 0 && len(t.Counts) >= t.Capacity:
+		//the new key replaces the key with the lowest count and inherits its count
+		minKey, min := t.min()
+		delete(t.Counts, minKey)
+		t.Counts[key] = min + weight
+	default:
+		t.Counts[key] = weight
+	}
+}
+
+// Merge merges the keys of another TopK, the counts of bounded keys are summed and the keys
+// with the lowest counts are dropped
+func (t *TopK) Merge(o *TopK) {
+
+	if t.ByValue {
+		for key, value := range o.Counts {
+			t.Add(key, value)
+		}
+		return
+	}
+
+	if t.Counts == nil {
+		t.Counts = make(map[string]float64)
+	}
+
+	for key, count := range o.Counts {
+		t.Counts[key] += count
+	}
+
+	if t.Capacity > 0 && len(t.Counts) > t.Capacity {
+		for _, e := range t.sorted()[t.Capacity:] {
+			delete(t.Counts, e.key)
+		}
+	}
+}
+
+// Top returns the top k keys in descending order, each with its key and its count or value
+func (t *TopK) Top() []interface{} {
+
+	entries := t.sorted()
+	if len(entries) > t.K {
+		entries = entries[:t.K]
+	}
+
+	top := make([]interface{}, len(entries))
+	for i, e := range entries {
+		if t.ByValue {
+			top[i] = map[string]interface{}{"key": e.key, "value": e.count}
+		} else {
+			top[i] = map[string]interface{}{"key": e.key, "count": int(e.count)}
+		}
+	}
+
+	return top
+}
+
+type topKEntry struct {
+	key   string
+	count float64
+}
+
+// sorted returns the keys by descending count, keys with the same count are sorted by key
+func (t *TopK) sorted() []topKEntry {
+
+	entries := make([]topKEntry, 0, len(t.Counts))
+	for key, count := range t.Counts {
+		entries = append(entries, topKEntry{key: key, count: count})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	return entries
+}
+
+// min returns the key that ranks last
+func (t *TopK) min() (string, float64) {
+
+	var minKey string
+	var min float64
+	first := true
+
+	for key, count := range t.Counts {
+		if first || count < min || (count == min && key > minKey) {
+			minKey, min = key, count
+			first = false
+		}
+	}
+
+	return minKey, min
+}
+
+// NewTopKFuncs creates the functions of the topK aggregate, the samples are ranked by the number of times
+// the key occurs or by the highest value of the key if the value field is set. The key is the key field of
+// the samples if set, otherwise the sample itself, keys are compared using their string representation.
+// If sketch is set the number of counted keys is bounded by the capacity, 10 times k by default.
+func NewTopKFuncs(k, capacity int, sketch bool, keyField, valueField string) (addFunc, mergeFunc func(a, b interface{}) interface{}, aggFunc func(a interface{}, count int) interface{}) {
+
+	if k <= 0 {
+		k = defaultTopK
+	}
+	if !sketch {
+		capacity = 0
+	} else if capacity < k {
+		capacity = 10 * k
+	}
+
+	addFunc = func(a, b interface{}) interface{} {
+
+		t, ok := a.(*TopK)
+		if !ok {
+			t = &TopK{K: k, Capacity: capacity, ByValue: valueField != ""}
+		}
+
+		key, ok := fieldValue(b, keyField)
+		if !ok {
+			return t
+		}
+
+		weight := 1.0
+		if valueField != "" {
+			val, ok := fieldValue(b, valueField)
+			if !ok {
+				return t
+			}
+			var err error
+			weight, err = coerce.ToFloat64(val)
+			if err != nil {
+				//todo handle error
+				return t
+			}
+		}
+
+		t.Add(fmt.Sprint(key), weight)
+
+		return t
+	}
+
+	mergeFunc = func(a, b interface{}) interface{} {
+
+		if a == nil {
+			return b
+		} else if b == nil {
+			return a
+		}
+
+		t := a.(*TopK)
+		t.Merge(b.(*TopK))
+
+		return t
+	}
+
+	aggFunc = func(a interface{}, count int) interface{} {
+
+		t, ok := a.(*TopK)
+		if !ok {
+			return nil
+		}
+
+		return t.Top()
+	}
+
+	return addFunc, mergeFunc, aggFunc
+}
@@ -0,0 +1,78 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopK(t *testing.T) {
+
+	addFunc, mergeFunc, aggFunc := NewTopKFuncs(2, 0, false, "", "")
+
+	var x, y interface{}
+	for _, val := range []interface{}{"a", "b", "a", "c", "b", "a"} {
+		x = addFunc(x, val)
+	}
+	for _, val := range []interface{}{"c", "c", "c"} {
+		y = addFunc(y, val)
+	}
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "a", "count": 3},
+		map[string]interface{}{"key": "b", "count": 2},
+	}, aggFunc(x, 6))
+
+	x = mergeFunc(x, y)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "c", "count": 4},
+		map[string]interface{}{"key": "a", "count": 3},
+	}, aggFunc(x, 9))
+}
+
+func TestTopK_ByValue(t *testing.T) {
+
+	addFunc, _, aggFunc := NewTopKFuncs(2, 0, false, "device.id", "temp")
+
+	var x interface{}
+	for _, val := range []interface{}{
+		map[string]interface{}{"device": map[string]interface{}{"id": 1}, "temp": 80},
+		map[string]interface{}{"device": map[string]interface{}{"id": 2}, "temp": 70},
+		map[string]interface{}{"device": map[string]interface{}{"id": 3}, "temp": 75},
+		map[string]interface{}{"device": map[string]interface{}{"id": 2}, "temp": 90},
+		map[string]interface{}{"temp": 100},
+	} {
+		x = addFunc(x, val)
+	}
+
+	//only the k highest values are tracked, samples without a key are skipped
+	assert.Len(t, x.(*TopK).Counts, 2)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "2", "value": 90.0},
+		map[string]interface{}{"key": "1", "value": 80.0},
+	}, aggFunc(x, 5))
+}
+
+func TestTopK_Sketch(t *testing.T) {
+
+	addFunc, _, aggFunc := NewTopKFuncs(3, 30, true, "", "")
+
+	//heavy hitters are found among many keys that occur once
+	var x interface{}
+	for i := 0; i < 10000; i++ {
+		x = addFunc(x, i)
+		if i%10 == 0 {
+			x = addFunc(x, "heavy")
+		}
+		if i%20 == 0 {
+			x = addFunc(x, "hitter")
+		}
+	}
+
+	assert.Len(t, x.(*TopK).Counts, 30)
+
+	top := aggFunc(x, 0).([]interface{})
+	assert.Equal(t, "heavy", top[0].(map[string]interface{})["key"])
+	assert.Equal(t, "hitter", top[1].(map[string]interface{})["key"])
+	assert.InEpsilon(t, 1000, top[0].(map[string]interface{})["count"], 0.05)
+}
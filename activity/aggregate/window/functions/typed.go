@@ -0,0 +1,149 @@
+package functions
+
+// Number is the element type of the samples aggregated by typed functions
+type Number interface {
+	~int64 | ~float64
+}
+
+// Op is the operation a typed function applies to the elements of the samples
+type Op int
+
+const (
+	OpSum Op = iota
+	OpMin
+	OpMax
+)
+
+// Func is an aggregate function for typed samples, the function is applied to each element of
+// a sample, a scalar sample being a single element. Partial results are merged using Add.
+type Func[T Number] struct {
+	Op Op
+	// Avg indicates the result is the accumulated sum divided by the number of samples
+	Avg bool
+	// Count indicates the function counts the samples, so each sample is the single element 1
+	Count bool
+}
+
+// NewFunc returns the typed implementation of the function, false if the function isn't supported
+func NewFunc[T Number](function string) (*Func[T], bool) {
+	switch function {
+	case "avg":
+		return &Func[T]{Op: OpSum, Avg: true}, true
+	case "sum":
+		return &Func[T]{Op: OpSum}, true
+	case "min":
+		return &Func[T]{Op: OpMin}, true
+	case "max":
+		return &Func[T]{Op: OpMax}, true
+	case "count":
+		return &Func[T]{Op: OpSum, Count: true}, true
+	default:
+		return nil, false
+	}
+}
+
+// Add adds the elements of v to the accumulated elements, the elements of acc are updated in place
+func (f *Func[T]) Add(acc, v []T) {
+
+	if len(v) < len(acc) {
+		acc = acc[:len(v)]
+	}
+	v = v[:len(acc)]
+
+	switch f.Op {
+	case OpSum:
+		for i := range acc {
+			acc[i] += v[i]
+		}
+	case OpMin:
+		for i := range acc {
+			if v[i] < acc[i] {
+				acc[i] = v[i]
+			}
+		}
+	case OpMax:
+		for i := range acc {
+			if v[i] > acc[i] {
+				acc[i] = v[i]
+			}
+		}
+	}
+}
+
+// Fold adds consecutive samples of len(acc) elements each to the accumulated elements
+func (f *Func[T]) Fold(acc, samples []T) {
+
+	dims := len(acc)
+	if dims == 0 {
+		return
+	}
+
+	if dims == 1 {
+		acc[0] = f.fold(acc[0], samples)
+		return
+	}
+
+	for ; len(samples) >= dims; samples = samples[dims:] {
+		s := samples[:dims]
+		switch f.Op {
+		case OpSum:
+			for i := range s {
+				acc[i] += s[i]
+			}
+		case OpMin:
+			for i := range s {
+				if s[i] < acc[i] {
+					acc[i] = s[i]
+				}
+			}
+		case OpMax:
+			for i := range s {
+				if s[i] > acc[i] {
+					acc[i] = s[i]
+				}
+			}
+		}
+	}
+}
+
+// fold adds scalar samples to the accumulated value
+func (f *Func[T]) fold(a T, samples []T) T {
+
+	switch f.Op {
+	case OpSum:
+		for _, v := range samples {
+			a += v
+		}
+	case OpMin:
+		for _, v := range samples {
+			if v < a {
+				a = v
+			}
+		}
+	case OpMax:
+		for _, v := range samples {
+			if v > a {
+				a = v
+			}
+		}
+	}
+
+	return a
+}
+
+// Result appends the result of the accumulated elements of count samples to dst
+func (f *Func[T]) Result(dst, acc []T, count int) []T {
+
+	dst = append(dst[:0], acc...)
+
+	if f.Avg {
+		if count == 0 {
+			return dst[:0]
+		}
+		for i := range dst {
+			dst[i] /= T(count)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedFuncs(t *testing.T) {
+
+	tests := []struct {
+		function string
+		expected []float64
+	}{
+		{"sum", []float64{9, 12}},
+		{"avg", []float64{3, 4}},
+		{"min", []float64{1, 2}},
+		{"max", []float64{5, 6}},
+	}
+
+	for _, tt := range tests {
+		fn, ok := NewFunc[float64](tt.function)
+		assert.True(t, ok)
+
+		acc := []float64{1, 2}
+		fn.Add(acc, []float64{3, 4})
+		fn.Fold(acc, []float64{5, 6})
+
+		assert.Equal(t, tt.expected, fn.Result(nil, acc, 3), tt.function)
+	}
+
+	fn, _ := NewFunc[int64]("max")
+	acc := []int64{1}
+	fn.Fold(acc, []int64{4, 9, 2})
+	assert.Equal(t, []int64{9}, acc)
+
+	fn, _ = NewFunc[int64]("avg")
+	assert.Empty(t, fn.Result(nil, []int64{4}, 0))
+
+	_, ok := NewFunc[int64]("stddev")
+	assert.False(t, ok)
+}
@@ -0,0 +1,142 @@
+package functions
+
+import (
+	"math"
+)
+
+const accMoments = "moments"
+
+func init() {
+	registerAccumulator(accMoments, func() Accumulator { return &Moments{} })
+}
+
+// Moments tracks the mean and the sum of squared differences from the mean of the samples using
+// Welford's online algorithm, each dimension of an array sample is tracked separately
+type Moments struct {
+	Count  int       `json:"count"`
+	Mean   []float64 `json:"mean"`
+	M2     []float64 `json:"m2"`
+	Vector bool      `json:"vector,omitempty"`
+}
+
+// Type implements functions.Accumulator.Type
+func (m *Moments) Type() string {
+	return accMoments
+}
+
+// Clone implements functions.Accumulator.Clone
+func (m *Moments) Clone() Accumulator {
+	c := &Moments{Count: m.Count, Vector: m.Vector}
+	c.Mean = append([]float64(nil), m.Mean...)
+	c.M2 = append([]float64(nil), m.M2...)
+	return c
+}
+
+// Add adds a sample
+func (m *Moments) Add(values []float64) {
+
+	if m.Mean == nil {
+		m.Mean = make([]float64, len(values))
+		m.M2 = make([]float64, len(values))
+	}
+
+	m.Count++
+	for i := 0; i < len(values) && i < len(m.Mean); i++ {
+		delta := values[i] - m.Mean[i]
+		m.Mean[i] += delta / float64(m.Count)
+		m.M2[i] += delta * (values[i] - m.Mean[i])
+	}
+}
+
+// Merge merges the moments of another set of samples, using Chan's parallel algorithm
+func (m *Moments) Merge(o *Moments) {
+
+	if o.Count == 0 {
+		return
+	}
+
+	if m.Count == 0 {
+		*m = *o.Clone().(*Moments)
+		return
+	}
+
+	total := float64(m.Count + o.Count)
+	for i := 0; i < len(m.Mean) && i < len(o.Mean); i++ {
+		delta := o.Mean[i] - m.Mean[i]
+		m.M2[i] += o.M2[i] + delta*delta*float64(m.Count)*float64(o.Count)/total
+		m.Mean[i] += delta * float64(o.Count) / total
+	}
+	m.Count += o.Count
+}
+
+// Variance returns the sample variance of each dimension
+func (m *Moments) Variance() []float64 {
+
+	variance := make([]float64, len(m.M2))
+	if m.Count < 2 {
+		return variance
+	}
+
+	for i, m2 := range m.M2 {
+		variance[i] = m2 / float64(m.Count-1)
+	}
+
+	return variance
+}
+
+func AddSampleMoments(a, b interface{}) interface{} {
+
+	values, vector, err := toFloats(b)
+	if err != nil {
+		//todo handle error
+		return a
+	}
+
+	m, ok := a.(*Moments)
+	if !ok {
+		m = &Moments{Vector: vector}
+	}
+
+	m.Add(values)
+
+	return m
+}
+
+func MergeMoments(a, b interface{}) interface{} {
+
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	m := a.(*Moments)
+	m.Merge(b.(*Moments))
+
+	return m
+}
+
+func AggregateSingleVariance(a interface{}, count int) interface{} {
+
+	m, ok := a.(*Moments)
+	if !ok {
+		return nil
+	}
+
+	return fromFloats(m.Variance(), m.Vector)
+}
+
+func AggregateSingleStdDev(a interface{}, count int) interface{} {
+
+	m, ok := a.(*Moments)
+	if !ok {
+		return nil
+	}
+
+	stddev := m.Variance()
+	for i, variance := range stddev {
+		stddev[i] = math.Sqrt(variance)
+	}
+
+	return fromFloats(stddev, m.Vector)
+}
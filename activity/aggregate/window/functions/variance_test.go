@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSampleMoments(t *testing.T) {
+
+	var x interface{}
+	for _, val := range []int{2, 4, 4, 4, 5, 5, 7, 9} {
+		x = AddSampleMoments(x, val)
+	}
+
+	assert.InDelta(t, 32.0/7, AggregateSingleVariance(x, 8), 1e-9)
+	assert.InDelta(t, math.Sqrt(32.0/7), AggregateSingleStdDev(x, 8), 1e-9)
+}
+
+func TestMergeMoments(t *testing.T) {
+
+	var x, y interface{}
+	for _, val := range []float64{2, 4, 4, 4} {
+		x = AddSampleMoments(x, val)
+	}
+	for _, val := range []float64{5, 5, 7, 9} {
+		y = AddSampleMoments(y, val)
+	}
+
+	x = MergeMoments(x, y)
+	assert.InDelta(t, 32.0/7, AggregateSingleVariance(x, 8), 1e-9)
+}
+
+func TestAddSampleMomentsArray(t *testing.T) {
+
+	var x interface{}
+	x = AddSampleMoments(x, []int{1, 10})
+	x = AddSampleMoments(x, []int{3, 10})
+
+	assert.Equal(t, []float64{2, 0}, AggregateSingleVariance(x, 2))
+}
@@ -0,0 +1,259 @@
+package window
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// NewHoppingWindow creates a count based hopping window, the window contains the last Size samples
+// and emits every Hop samples once it is full
+func NewHoppingWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) (Window, error) {
+
+	ring, err := newPaneRing(mergeFunc, aggFunc, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HoppingWindow{addFunc: addFunc, settings: settings, ring: ring}, nil
+}
+
+// HoppingWindow - A count based window whose size and hop are independent, the samples are aggregated into
+// panes of gcd(size, hop) samples, so the window doesn't have to keep the individual samples
+type HoppingWindow struct {
+	addFunc  AddSampleFunc
+	settings *Settings
+
+	ring *paneRing
+
+	mutex sync.Mutex
+}
+
+// AddSample implements window.Window.AddSample
+func (w *HoppingWindow) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if s, ok := sample.(string); ok {
+		sample, _ = coerce.ToFloat64(s)
+		//warn
+	}
+
+	p := w.ring.add(w.addFunc, sample)
+	if p.count == w.ring.paneSize {
+		return w.ring.next()
+	}
+
+	return false, nil
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *HoppingWindow) Flush() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.flush()
+}
+
+// NewHoppingTimeWindow creates a time based hopping window, the window contains the samples of the last Size millis
+// and emits every Hop millis once it is full. The window has to be progressed every PaneInterval millis.
+func NewHoppingTimeWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) (*HoppingTimeWindow, error) {
+
+	ring, err := newPaneRing(mergeFunc, aggFunc, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &HoppingTimeWindow{addFunc: addFunc, settings: settings, ring: ring}
+	w.nextPaneTime = time.Now().Add(w.PaneInterval())
+
+	return w, nil
+}
+
+// HoppingTimeWindow - A time based window whose size and hop are independent. Relies on external entity
+// moving window along by calling NextBlock every PaneInterval.
+type HoppingTimeWindow struct {
+	addFunc  AddSampleFunc
+	settings *Settings
+
+	ring         *paneRing
+	nextPaneTime time.Time
+
+	mutex sync.Mutex
+}
+
+// PaneInterval returns the interval at which the window has to be progressed
+func (w *HoppingTimeWindow) PaneInterval() time.Duration {
+	return time.Duration(w.ring.paneSize) * time.Millisecond
+}
+
+// AddSample implements window.Window.AddSample
+func (w *HoppingTimeWindow) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var emit bool
+	var val interface{}
+
+	if !w.settings.ExternalTimer {
+		//catch up with the panes that have elapsed since the last sample
+		for now := time.Now(); !now.Before(w.nextPaneTime); w.nextPaneTime = w.nextPaneTime.Add(w.PaneInterval()) {
+			if e, v := w.ring.next(); e {
+				emit, val = e, v
+			}
+		}
+	}
+
+	if s, ok := sample.(string); ok {
+		sample, _ = coerce.ToFloat64(s)
+		//warn
+	}
+
+	w.ring.add(w.addFunc, sample)
+
+	return emit, val
+}
+
+// NextBlock implements window.TimeWindow.NextBlock
+func (w *HoppingTimeWindow) NextBlock() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.next()
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *HoppingTimeWindow) Flush() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.flush()
+}
+
+// paneRing is a ring of panes that covers a window, the window hops by a multiple of the panes
+type paneRing struct {
+	mergeFunc AddSampleFunc
+	aggFunc   AggregateSingleFunc
+
+	paneSize int
+	hopPanes int
+
+	panes     []*pane
+	current   int
+	filled    bool
+	sinceEmit int
+}
+
+func newPaneRing(mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) (*paneRing, error) {
+
+	if settings.Size <= 0 || settings.Hop <= 0 {
+		return nil, fmt.Errorf("window size and hop must be greater than 0")
+	}
+
+	paneSize := gcd(settings.Size, settings.Hop)
+
+	r := &paneRing{mergeFunc: mergeFunc, aggFunc: aggFunc, paneSize: paneSize, hopPanes: settings.Hop / paneSize}
+	r.panes = make([]*pane, settings.Size/paneSize)
+	r.panes[0] = &pane{}
+
+	return r, nil
+}
+
+// add adds the sample to the current pane
+func (r *paneRing) add(addFunc AddSampleFunc, sample interface{}) *pane {
+
+	p := r.panes[r.current]
+	p.value = addFunc(p.value, sample)
+	p.count++
+
+	return p
+}
+
+// next completes the current pane, the window is emitted when it has hopped
+func (r *paneRing) next() (bool, interface{}) {
+
+	r.current++
+	if r.current == len(r.panes) {
+		r.current = 0
+		if !r.filled {
+			r.filled = true
+			//the first emit is when the window is full
+			r.sinceEmit = r.hopPanes - 1
+		}
+	}
+
+	var emit bool
+	var val interface{}
+
+	if r.filled {
+		r.sinceEmit++
+		if r.sinceEmit == r.hopPanes {
+			r.sinceEmit = 0
+			emit = true
+			val, _ = r.aggregate(r.current)
+		}
+	}
+
+	r.panes[r.current] = &pane{}
+
+	return emit, val
+}
+
+// flush emits the aggregate of the panes and empties the window
+func (r *paneRing) flush() (bool, interface{}) {
+
+	val, count := r.aggregate(r.current + 1)
+	if count == 0 {
+		return false, nil
+	}
+
+	r.panes = make([]*pane, len(r.panes))
+	r.panes[0] = &pane{}
+	r.current = 0
+	r.filled = false
+	r.sinceEmit = 0
+
+	return true, val
+}
+
+// aggregate merges the panes starting with the oldest
+func (r *paneRing) aggregate(oldest int) (interface{}, int) {
+
+	var value interface{}
+	count := 0
+
+	for i := range r.panes {
+		p := r.panes[(oldest+i)%len(r.panes)]
+		if p == nil || p.count == 0 {
+			continue
+		}
+
+		if value == nil {
+			//the merge functions update their first argument
+			value = clone(p.value)
+		} else {
+			value = r.mergeFunc(value, p.value)
+		}
+		count += p.count
+	}
+
+	if count == 0 {
+		return nil, 0
+	}
+
+	return r.aggFunc(value, count), count
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,185 @@
+package window
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// NewSessionWindow creates a session window, a session is closed once no samples have been added
+// for the gap specified by the size of the window (in millis)
+func NewSessionWindow(addFunc, mergeFunc AddSampleFunc, aggFunc AggregateSingleFunc, settings *Settings) *SessionWindow {
+	return &SessionWindow{addFunc: addFunc, mergeFunc: mergeFunc, aggFunc: aggFunc, settings: settings, gap: int64(settings.Size)}
+}
+
+// SessionWindow - A window that groups samples into sessions of activity separated by a gap of inactivity.
+// Sessions are closed by a watermark that trails the latest timestamp by the configured out-of-orderness
+// bound, a sample that falls between two sessions merges them.
+type SessionWindow struct {
+	addFunc   AddSampleFunc
+	mergeFunc AddSampleFunc
+	aggFunc   AggregateSingleFunc
+	settings  *Settings
+
+	gap int64
+
+	// sessions ordered by start
+	sessions     []*session
+	maxTimestamp int64
+	started      bool
+	lateCount    int
+
+	mutex sync.Mutex
+}
+
+type session struct {
+	start int64
+	end   int64
+	count int
+	value interface{}
+}
+
+// AddSample implements window.Window.AddSample, the sample is timestamped with the current time
+func (w *SessionWindow) AddSample(sample interface{}) (bool, interface{}) {
+
+	results, _ := w.AddEvent(sample, time.Now().UnixNano()/int64(time.Millisecond))
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	return true, results[len(results)-1].Value
+}
+
+// AddEvent implements window.EventTimeWindow.AddEvent
+func (w *SessionWindow) AddEvent(sample interface{}, timestamp int64) (results []*Result, late bool) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if s, ok := sample.(string); ok {
+		sample, _ = coerce.ToFloat64(s)
+		//warn
+	}
+
+	//sessions within the gap of the sample are merged with it
+	merged := &session{start: timestamp, end: timestamp}
+	var remaining []*session
+
+	for _, s := range w.sessions {
+		if s.start < timestamp+w.gap && timestamp < s.end+w.gap {
+			merged.start = min64(merged.start, s.start)
+			merged.end = max64(merged.end, s.end)
+			merged.count += s.count
+			if merged.value == nil {
+				//the merge functions update their first argument
+				merged.value = clone(s.value)
+			} else {
+				merged.value = w.mergeFunc(merged.value, s.value)
+			}
+		} else {
+			remaining = append(remaining, s)
+		}
+	}
+
+	if w.started && merged.count == 0 && timestamp+w.gap <= w.watermark() {
+		w.lateCount++
+		return nil, true
+	}
+
+	merged.value = w.addFunc(merged.value, sample)
+	merged.count++
+
+	w.sessions = append(remaining, merged)
+	sort.Slice(w.sessions, func(i, j int) bool { return w.sessions[i].start < w.sessions[j].start })
+
+	return w.advance(timestamp), false
+}
+
+// Advance moves the watermark based on the specified time, it returns the results of the sessions that were closed
+func (w *SessionWindow) Advance(timestamp int64) []*Result {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.advance(timestamp)
+}
+
+// CloseAll implements window.EventTimeWindow.CloseAll
+func (w *SessionWindow) CloseAll() []*Result {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.closeSessions(maxMillis)
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *SessionWindow) Flush() (bool, interface{}) {
+
+	results := w.CloseAll()
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	return true, results[len(results)-1].Value
+}
+
+// LateCount implements window.EventTimeWindow.LateCount
+func (w *SessionWindow) LateCount() int {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.lateCount
+}
+
+func (w *SessionWindow) watermark() int64 {
+	return w.maxTimestamp - int64(w.settings.MaxOutOfOrderness)
+}
+
+func (w *SessionWindow) advance(timestamp int64) []*Result {
+
+	if w.started && timestamp <= w.maxTimestamp {
+		return nil
+	}
+
+	w.maxTimestamp = timestamp
+	w.started = true
+
+	return w.closeSessions(w.watermark())
+}
+
+// closeSessions emits the sessions that have been inactive for the gap at the watermark
+func (w *SessionWindow) closeSessions(watermark int64) []*Result {
+
+	var results []*Result
+	var open []*session
+
+	for _, s := range w.sessions {
+		if s.end+w.gap <= watermark {
+			results = append(results, &Result{Start: s.start, End: s.end, Count: s.count, Value: w.aggFunc(s.value, s.count)})
+		} else {
+			open = append(open, s)
+		}
+	}
+
+	w.sessions = open
+
+	return results
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,680 @@
+package window
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/project-flogo/stream/activity/aggregate/window/functions"
+)
+
+// Snapshot is the serializable state of a window
+type Snapshot struct {
+	Data         *Value                     `json:"data,omitempty"`
+	Blocks       []*Value                   `json:"blocks,omitempty"`
+	NumSamples   int                        `json:"numSamples,omitempty"`
+	MaxSamples   int                        `json:"maxSamples,omitempty"`
+	CurrentBlock int                        `json:"currentBlock,omitempty"`
+	CanEmit      bool                       `json:"canEmit,omitempty"`
+	NextEmit     int                        `json:"nextEmit,omitempty"`
+	DataMap      map[string]*CountedValue   `json:"dataMap,omitempty"`
+	BlockDataMap map[string][]*CountedValue `json:"blockDataMap,omitempty"`
+	Panes        map[int64]*CountedValue    `json:"panes,omitempty"`
+	MaxTimestamp int64                      `json:"maxTimestamp,omitempty"`
+	Started      bool                       `json:"started,omitempty"`
+	LateCount    int                        `json:"lateCount,omitempty"`
+	Sessions     []*SessionValue            `json:"sessions,omitempty"`
+}
+
+// SessionValue is the serializable state of a session in a session window
+type SessionValue struct {
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Count int    `json:"count"`
+	Value *Value `json:"value,omitempty"`
+}
+
+// CountedValue is the serializable state of a named value in a window
+type CountedValue struct {
+	Count int    `json:"count"`
+	Value *Value `json:"value,omitempty"`
+}
+
+const (
+	valueTypeInt         = "int"
+	valueTypeFloat       = "float64"
+	valueTypeIntArray    = "[]int"
+	valueTypeFloatArray  = "[]float64"
+	valueTypeSamples     = "samples"
+	valueTypeAccumulator = "accumulator"
+	valueTypeAny         = "any"
+)
+
+// Value is a type preserving representation of a window value, values that aren't
+// numeric are stored as is, so their type is only preserved if the encoding supports it
+type Value struct {
+	Type   string      `json:"type"`
+	Int    int         `json:"int,omitempty"`
+	Float  float64     `json:"float,omitempty"`
+	Ints   []int       `json:"ints,omitempty"`
+	Floats []float64   `json:"floats,omitempty"`
+	Values []*Value    `json:"values,omitempty"`
+	Any    interface{} `json:"any,omitempty"`
+
+	Accumulator string          `json:"accumulator,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+// NewValue creates the serializable representation of a window value
+func NewValue(val interface{}) *Value {
+
+	switch t := val.(type) {
+	case nil:
+		return nil
+	case int:
+		return &Value{Type: valueTypeInt, Int: t}
+	case float64:
+		return &Value{Type: valueTypeFloat, Float: t}
+	case []int:
+		ints := make([]int, len(t))
+		copy(ints, t)
+		return &Value{Type: valueTypeIntArray, Ints: ints}
+	case []float64:
+		floats := make([]float64, len(t))
+		copy(floats, t)
+		return &Value{Type: valueTypeFloatArray, Floats: floats}
+	case []interface{}:
+		values := make([]*Value, len(t))
+		for i, v := range t {
+			values[i] = NewValue(v)
+		}
+		return &Value{Type: valueTypeSamples, Values: values}
+	case functions.Accumulator:
+		data, err := json.Marshal(t)
+		if err == nil {
+			return &Value{Type: valueTypeAccumulator, Accumulator: t.Type(), Data: data}
+		}
+	}
+
+	return &Value{Type: valueTypeAny, Any: val}
+}
+
+// Get returns the window value
+func (v *Value) Get() (interface{}, error) {
+
+	if v == nil {
+		return nil, nil
+	}
+
+	switch v.Type {
+	case valueTypeInt:
+		return v.Int, nil
+	case valueTypeFloat:
+		return v.Float, nil
+	case valueTypeIntArray:
+		if v.Ints == nil {
+			return []int{}, nil
+		}
+		return v.Ints, nil
+	case valueTypeFloatArray:
+		if v.Floats == nil {
+			return []float64{}, nil
+		}
+		return v.Floats, nil
+	case valueTypeSamples:
+		samples := make([]interface{}, len(v.Values))
+		for i, value := range v.Values {
+			sample, err := value.Get()
+			if err != nil {
+				return nil, err
+			}
+			samples[i] = sample
+		}
+		return samples, nil
+	case valueTypeAccumulator:
+		acc, err := functions.NewAccumulator(v.Accumulator)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(v.Data, acc)
+		if err != nil {
+			return nil, err
+		}
+		return acc, nil
+	case valueTypeAny:
+		return v.Any, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value type: %s", v.Type)
+}
+
+func newValues(vals []interface{}) []*Value {
+	values := make([]*Value, len(vals))
+	for i, val := range vals {
+		values[i] = NewValue(val)
+	}
+	return values
+}
+
+func getValues(values []*Value, size int) ([]interface{}, error) {
+
+	if len(values) != size {
+		return nil, fmt.Errorf("snapshot has %d blocks, window has %d", len(values), size)
+	}
+
+	vals := make([]interface{}, size)
+	for i, value := range values {
+		val, err := value.Get()
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+
+	return vals, nil
+}
+
+/////////////////////
+// Window snapshots
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *TumblingWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := &Snapshot{Data: NewValue(w.data), NumSamples: w.numSamples}
+	if w.dataMap != nil {
+		snapshot.DataMap = w.dataMap.snapshot()
+	}
+
+	return snapshot
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TumblingWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	data, err := snapshot.Data.Get()
+	if err != nil {
+		return err
+	}
+
+	if w.dataMap != nil {
+		err = w.dataMap.restore(snapshot.DataMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.data = data
+	w.numSamples = snapshot.NumSamples
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *TumblingTimeWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := &Snapshot{Data: NewValue(w.data), NumSamples: w.numSamples, MaxSamples: w.maxSamples, NextEmit: w.nextEmit}
+	if w.dataMap != nil {
+		snapshot.DataMap = w.dataMap.snapshot()
+	}
+
+	return snapshot
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TumblingTimeWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	data, err := snapshot.Data.Get()
+	if err != nil {
+		return err
+	}
+
+	if w.dataMap != nil {
+		err = w.dataMap.restore(snapshot.DataMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.data = data
+	w.numSamples = snapshot.NumSamples
+	w.maxSamples = snapshot.MaxSamples
+	w.nextEmit = snapshot.NextEmit
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *SlidingWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return &Snapshot{Blocks: newValues(w.blocks), NumSamples: w.numSamples, CurrentBlock: w.currentBlock, CanEmit: w.canEmit}
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *SlidingWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	blocks, err := getValues(snapshot.Blocks, len(w.blocks))
+	if err != nil {
+		return err
+	}
+
+	w.blocks = blocks
+	w.numSamples = snapshot.NumSamples
+	w.currentBlock = snapshot.CurrentBlock
+	w.canEmit = snapshot.CanEmit
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *SlidingTimeWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := &Snapshot{Blocks: newValues(w.blocks), NumSamples: w.numSamples, MaxSamples: w.maxSamples,
+		CurrentBlock: w.currentBlock, CanEmit: w.canEmit, NextEmit: w.nextBlockTime}
+	if w.dataMap != nil {
+		snapshot.BlockDataMap = w.dataMap.snapshot()
+	}
+
+	return snapshot
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *SlidingTimeWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	blocks, err := getValues(snapshot.Blocks, len(w.blocks))
+	if err != nil {
+		return err
+	}
+
+	if w.dataMap != nil {
+		err = w.dataMap.restore(snapshot.BlockDataMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.blocks = blocks
+	w.numSamples = snapshot.NumSamples
+	w.maxSamples = snapshot.MaxSamples
+	w.currentBlock = snapshot.CurrentBlock
+	w.canEmit = snapshot.CanEmit
+	w.nextBlockTime = snapshot.NextEmit
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *SlidingEventTimeWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := &Snapshot{MaxTimestamp: w.maxTimestamp, Started: w.started, LateCount: w.lateCount}
+	if len(w.panes) > 0 {
+		snapshot.Panes = make(map[int64]*CountedValue, len(w.panes))
+		for start, p := range w.panes {
+			snapshot.Panes[start] = &CountedValue{Count: p.count, Value: NewValue(p.value)}
+		}
+	}
+
+	return snapshot
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *SlidingEventTimeWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	panes := make(map[int64]*pane, len(snapshot.Panes))
+	for start, cv := range snapshot.Panes {
+		val, err := cv.Value.Get()
+		if err != nil {
+			return err
+		}
+		panes[start] = &pane{count: cv.Count, value: val}
+	}
+
+	w.panes = panes
+	w.maxTimestamp = snapshot.MaxTimestamp
+	w.started = snapshot.Started
+	w.lateCount = snapshot.LateCount
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *SessionWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := &Snapshot{MaxTimestamp: w.maxTimestamp, Started: w.started, LateCount: w.lateCount}
+	for _, s := range w.sessions {
+		snapshot.Sessions = append(snapshot.Sessions, &SessionValue{Start: s.start, End: s.end, Count: s.count, Value: NewValue(s.value)})
+	}
+
+	return snapshot
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *SessionWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	sessions := make([]*session, 0, len(snapshot.Sessions))
+	for _, sv := range snapshot.Sessions {
+		val, err := sv.Value.Get()
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, &session{start: sv.Start, end: sv.End, count: sv.Count, value: val})
+	}
+
+	w.sessions = sessions
+	w.maxTimestamp = snapshot.MaxTimestamp
+	w.started = snapshot.Started
+	w.lateCount = snapshot.LateCount
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *HoppingWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.snapshot()
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *HoppingWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.restore(snapshot)
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *HoppingTimeWindow) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.snapshot()
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *HoppingTimeWindow) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.ring.restore(snapshot)
+}
+
+func (r *paneRing) snapshot() *Snapshot {
+
+	snapshot := &Snapshot{MaxSamples: len(r.panes), CurrentBlock: r.current, CanEmit: r.filled, NextEmit: r.sinceEmit}
+	snapshot.Panes = make(map[int64]*CountedValue, len(r.panes))
+	for id, p := range r.panes {
+		if p != nil {
+			snapshot.Panes[int64(id)] = &CountedValue{Count: p.count, Value: NewValue(p.value)}
+		}
+	}
+
+	return snapshot
+}
+
+func (r *paneRing) restore(snapshot *Snapshot) error {
+
+	if snapshot.MaxSamples != len(r.panes) || snapshot.CurrentBlock >= len(r.panes) {
+		return fmt.Errorf("snapshot has %d panes, window has %d", snapshot.MaxSamples, len(r.panes))
+	}
+
+	panes := make([]*pane, len(r.panes))
+	for id, cv := range snapshot.Panes {
+		if id < 0 || id >= int64(len(panes)) {
+			return fmt.Errorf("invalid pane in snapshot: %d", id)
+		}
+
+		val, err := cv.Value.Get()
+		if err != nil {
+			return err
+		}
+		panes[id] = &pane{count: cv.Count, value: val}
+	}
+
+	if panes[snapshot.CurrentBlock] == nil {
+		panes[snapshot.CurrentBlock] = &pane{}
+	}
+
+	r.panes = panes
+	r.current = snapshot.CurrentBlock
+	r.filled = snapshot.CanEmit
+	r.sinceEmit = snapshot.NextEmit
+
+	return nil
+}
+
+func (md *MapData) snapshot() map[string]*CountedValue {
+
+	snapshot := make(map[string]*CountedValue, len(md.dataMap))
+	for key, info := range md.dataMap {
+		snapshot[key] = &CountedValue{Count: info.count, Value: NewValue(info.value)}
+	}
+
+	return snapshot
+}
+
+func (md *MapData) restore(snapshot map[string]*CountedValue) error {
+
+	dataMap := make(map[string]*DataInfo, len(snapshot))
+	for key, cv := range snapshot {
+		val, err := cv.Value.Get()
+		if err != nil {
+			return err
+		}
+		dataMap[key] = &DataInfo{count: cv.Count, value: val}
+	}
+
+	md.dataMap = dataMap
+	return nil
+}
+
+func (md *BlockMapData) snapshot() map[string][]*CountedValue {
+
+	snapshot := make(map[string][]*CountedValue, len(md.dataMap))
+	for key, blockInfos := range md.dataMap {
+		blocks := make([]*CountedValue, len(blockInfos))
+		for id, block := range blockInfos {
+			if block != nil {
+				blocks[id] = &CountedValue{Count: block.count, Value: NewValue(block.value)}
+			}
+		}
+		snapshot[key] = blocks
+	}
+
+	return snapshot
+}
+
+func (md *BlockMapData) restore(snapshot map[string][]*CountedValue) error {
+
+	dataMap := make(map[string][]*BlockInfo, len(snapshot))
+	for key, blocks := range snapshot {
+		if len(blocks) != md.numBlocks {
+			return fmt.Errorf("snapshot has %d blocks, window has %d", len(blocks), md.numBlocks)
+		}
+
+		blockInfos := make([]*BlockInfo, md.numBlocks)
+		for id, cv := range blocks {
+			if cv == nil {
+				continue
+			}
+
+			val, err := cv.Value.Get()
+			if err != nil {
+				return err
+			}
+			blockInfos[id] = &BlockInfo{count: cv.Count, value: val}
+		}
+		dataMap[key] = blockInfos
+	}
+
+	md.dataMap = dataMap
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *TypedTumblingWindow[T]) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return &Snapshot{Data: NewValue(w.value(w.acc, w.numSamples)), NumSamples: w.numSamples}
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TypedTumblingWindow[T]) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	acc, _, err := w.restore(w.acc, snapshot.Data)
+	if err != nil {
+		return err
+	}
+
+	w.acc = acc
+	w.numSamples = snapshot.NumSamples
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *TypedTumblingTimeWindow[T]) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return &Snapshot{Data: NewValue(w.value(w.acc, w.numSamples)), NumSamples: w.numSamples, MaxSamples: w.maxSamples,
+		NextEmit: int(w.nextEmit)}
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TypedTumblingTimeWindow[T]) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	acc, _, err := w.restore(w.acc, snapshot.Data)
+	if err != nil {
+		return err
+	}
+
+	w.acc = acc
+	w.numSamples = snapshot.NumSamples
+	w.maxSamples = snapshot.MaxSamples
+	w.nextEmit = int64(snapshot.NextEmit)
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot
+func (w *TypedSlidingWindow[T]) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	blocks := make([]*Value, w.settings.Size)
+	for i := 0; i < w.filled; i++ {
+		blocks[i] = NewValue(w.value(w.ring[i*w.dims:(i+1)*w.dims], 1))
+	}
+
+	return &Snapshot{Blocks: blocks, NumSamples: w.numSamples, CurrentBlock: w.currentBlock, CanEmit: w.canEmit}
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TypedSlidingWindow[T]) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(snapshot.Blocks) != w.settings.Size {
+		return fmt.Errorf("snapshot has %d blocks, window has %d", len(snapshot.Blocks), w.settings.Size)
+	}
+
+	w.filled = 0
+
+	for i, value := range snapshot.Blocks {
+		block, count, err := w.restore(w.sample, value)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+
+		if w.ring == nil {
+			w.dims = len(block)
+			w.ring = make([]T, w.settings.Size*w.dims)
+		}
+		copy(w.ring[i*w.dims:(i+1)*w.dims], block)
+		w.filled++
+	}
+
+	if w.ring != nil {
+		w.resum()
+	}
+
+	w.numSamples = snapshot.NumSamples
+	w.currentBlock = snapshot.CurrentBlock
+	w.canEmit = snapshot.CanEmit
+
+	return nil
+}
+
+// Snapshot implements window.SnapshotWindow.Snapshot, the number of samples of a block isn't
+// retained, only whether it's empty
+func (w *TypedSlidingTimeWindow[T]) Snapshot() *Snapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	blocks := make([]*Value, len(w.blocks))
+	for i, block := range w.blocks {
+		blocks[i] = NewValue(w.value(block, w.counts[i]))
+	}
+
+	return &Snapshot{Blocks: blocks, NumSamples: w.numSamples, MaxSamples: w.maxSamples,
+		CurrentBlock: w.currentBlock, CanEmit: w.canEmit, NextEmit: int(w.nextBlockTime)}
+}
+
+// Restore implements window.SnapshotWindow.Restore
+func (w *TypedSlidingTimeWindow[T]) Restore(snapshot *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(snapshot.Blocks) != len(w.blocks) {
+		return fmt.Errorf("snapshot has %d blocks, window has %d", len(snapshot.Blocks), len(w.blocks))
+	}
+
+	for i, value := range snapshot.Blocks {
+		block, count, err := w.restore(w.blocks[i], value)
+		if err != nil {
+			return err
+		}
+		w.blocks[i] = block
+		w.counts[i] = count
+	}
+
+	w.numSamples = snapshot.NumSamples
+	w.maxSamples = snapshot.MaxSamples
+	w.currentBlock = snapshot.CurrentBlock
+	w.canEmit = snapshot.CanEmit
+	w.nextBlockTime = int64(snapshot.NextEmit)
+
+	return nil
+}
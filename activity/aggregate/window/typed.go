@@ -0,0 +1,640 @@
+package window
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/stream/activity/aggregate/window/functions"
+)
+
+// Sample types of typed windows
+const (
+	SampleTypeInt64         = "int64"
+	SampleTypeFloat64       = "float64"
+	SampleTypeInt64Vector   = "[]int64"
+	SampleTypeFloat64Vector = "[]float64"
+)
+
+// Format is the format of the samples of a typed window, results are returned in the same format
+type Format struct {
+	// Float indicates the elements of the samples are float64, otherwise they are int64
+	Float bool
+	// Vector indicates the samples are arrays
+	Vector bool
+	// Native indicates integer results are returned as int instead of int64
+	Native bool
+}
+
+// ParseSampleType returns the format of a sample type
+func ParseSampleType(sampleType string) (Format, error) {
+	switch sampleType {
+	case SampleTypeInt64:
+		return Format{}, nil
+	case SampleTypeFloat64:
+		return Format{Float: true}, nil
+	case SampleTypeInt64Vector:
+		return Format{Vector: true}, nil
+	case SampleTypeFloat64Vector:
+		return Format{Float: true, Vector: true}, nil
+	}
+
+	return Format{}, fmt.Errorf("unsupported sample type: '%s'", sampleType)
+}
+
+// FormatOf returns the format of a numeric sample, false if the sample isn't numeric
+func FormatOf(sample interface{}) (Format, bool) {
+	switch sample.(type) {
+	case int:
+		return Format{Native: true}, true
+	case int32, int64:
+		return Format{}, true
+	case float32, float64, string:
+		return Format{Float: true}, true
+	case []int:
+		return Format{Vector: true, Native: true}, true
+	case []int64:
+		return Format{Vector: true}, true
+	case []float64:
+		return Format{Float: true, Vector: true}, true
+	}
+
+	return Format{}, false
+}
+
+// typedState is the state shared by the typed windows, the current sample is converted into a
+// buffer that is reused, so adding a sample doesn't allocate
+type typedState[T functions.Number] struct {
+	fn     *functions.Func[T]
+	format Format
+
+	sample []T
+	acc    []T
+	out    []T
+}
+
+// load converts the sample into the sample buffer, false if the sample isn't numeric
+func (s *typedState[T]) load(sample interface{}) bool {
+
+	if s.fn.Count {
+		s.set(1)
+		return true
+	}
+
+	//common scalars are set directly
+	switch t := sample.(type) {
+	case float64:
+		s.set(T(t))
+		return true
+	case int:
+		s.set(T(t))
+		return true
+	case int64:
+		s.set(T(t))
+		return true
+	}
+
+	var ok bool
+	s.sample, ok = toElements(sample, s.sample[:0])
+
+	return ok
+}
+
+// set sets a scalar sample in the sample buffer
+func (s *typedState[T]) set(v T) {
+
+	if cap(s.sample) == 0 {
+		s.sample = make([]T, 1)
+	}
+
+	s.sample = s.sample[:1]
+	s.sample[0] = v
+}
+
+// add adds the current sample to the accumulated elements of n samples
+func (s *typedState[T]) add(acc *[]T, n int) {
+	s.merge(acc, n, s.sample)
+}
+
+// merge merges the accumulated elements o into the accumulated elements of n samples, the
+// accumulated elements are updated in place
+func (s *typedState[T]) merge(acc *[]T, n int, o []T) {
+
+	if n == 0 {
+		*acc = append((*acc)[:0], o...)
+		return
+	}
+
+	s.fn.Add(*acc, o)
+}
+
+// result computes the result of the accumulated elements of count samples
+func (s *typedState[T]) result(acc []T, count int) interface{} {
+
+	if s.fn.Count {
+		if len(acc) == 0 {
+			return 0
+		}
+		return int(acc[0])
+	}
+
+	s.out = s.fn.Result(s.out, acc, count)
+	if len(s.out) == 0 {
+		return nil
+	}
+
+	return fromElements(s.out, s.format)
+}
+
+// value returns the accumulated elements of n samples as a snapshot value
+func (s *typedState[T]) value(acc []T, n int) interface{} {
+
+	if n == 0 {
+		return nil
+	}
+
+	format := s.format
+	format.Native = true
+	if s.fn.Count {
+		format.Vector = false
+	}
+
+	return fromElements(acc, format)
+}
+
+// restore converts a snapshot value into accumulated elements, returns 0 if the value is empty
+func (s *typedState[T]) restore(acc []T, value *Value) ([]T, int, error) {
+
+	val, err := value.Get()
+	if err != nil || val == nil {
+		return acc[:0], 0, err
+	}
+
+	acc, ok := toElements(val, acc[:0])
+	if !ok {
+		return acc, 0, fmt.Errorf("unsupported snapshot value: %v", val)
+	}
+
+	return acc, 1, nil
+}
+
+// toElements appends the elements of a numeric sample to dst
+func toElements[T functions.Number](sample interface{}, dst []T) ([]T, bool) {
+
+	switch t := sample.(type) {
+	case int:
+		return append(dst, T(t)), true
+	case int64:
+		return append(dst, T(t)), true
+	case float64:
+		return append(dst, T(t)), true
+	case int32:
+		return append(dst, T(t)), true
+	case float32:
+		return append(dst, T(t)), true
+	case []int:
+		for _, v := range t {
+			dst = append(dst, T(v))
+		}
+		return dst, true
+	case []int64:
+		for _, v := range t {
+			dst = append(dst, T(v))
+		}
+		return dst, true
+	case []float64:
+		for _, v := range t {
+			dst = append(dst, T(v))
+		}
+		return dst, true
+	case []interface{}:
+		for _, v := range t {
+			f, err := coerce.ToFloat64(v)
+			if err != nil {
+				return dst, false
+			}
+			dst = append(dst, T(f))
+		}
+		return dst, true
+	}
+
+	f, err := coerce.ToFloat64(sample)
+	if err != nil {
+		return dst, false
+	}
+
+	return append(dst, T(f)), true
+}
+
+// fromElements converts elements to a result of the specified format
+func fromElements[T functions.Number](elements []T, format Format) interface{} {
+
+	switch t := any(elements).(type) {
+	case []float64:
+		if !format.Vector {
+			return t[0]
+		}
+		return append([]float64(nil), t...)
+	case []int64:
+		if format.Native {
+			if !format.Vector {
+				return int(t[0])
+			}
+			ints := make([]int, len(t))
+			for i, v := range t {
+				ints[i] = int(v)
+			}
+			return ints
+		}
+		if !format.Vector {
+			return t[0]
+		}
+		return append([]int64(nil), t...)
+	}
+
+	return nil
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+//////////////////////////
+// Typed Tumbling Window
+
+// NewTypedTumblingWindow creates a tumbling window for numeric samples
+func NewTypedTumblingWindow[T functions.Number](fn *functions.Func[T], format Format, settings *Settings) *TypedTumblingWindow[T] {
+	return &TypedTumblingWindow[T]{typedState: typedState[T]{fn: fn, format: format}, settings: settings}
+}
+
+// TypedTumblingWindow is a tumbling window whose samples are aggregated without boxing them
+type TypedTumblingWindow[T functions.Number] struct {
+	typedState[T]
+	settings *Settings
+
+	numSamples int
+
+	mutex sync.Mutex
+}
+
+// AddSample implements window.Window.AddSample
+func (w *TypedTumblingWindow[T]) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.load(sample) {
+		return false, nil
+	}
+
+	w.add(&w.acc, w.numSamples)
+	w.numSamples++
+
+	if w.numSamples == w.settings.Size {
+		val := w.result(w.acc, w.numSamples)
+		w.numSamples = 0
+
+		return true, val
+	}
+
+	return false, nil
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *TypedTumblingWindow[T]) Flush() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.numSamples == 0 {
+		return false, nil
+	}
+
+	val := w.result(w.acc, w.numSamples)
+	w.numSamples = 0
+
+	return true, val
+}
+
+///////////////////////////////
+// Typed Tumbling Time Window
+
+// NewTypedTumblingTimeWindow creates a tumbling time window for numeric samples
+func NewTypedTumblingTimeWindow[T functions.Number](fn *functions.Func[T], format Format, settings *Settings) *TypedTumblingTimeWindow[T] {
+	return &TypedTumblingTimeWindow[T]{typedState: typedState[T]{fn: fn, format: format}, settings: settings}
+}
+
+// TypedTumblingTimeWindow is a tumbling time window whose samples are aggregated without boxing them,
+// like TumblingTimeWindow the average is computed using the maximum number of samples of a window
+type TypedTumblingTimeWindow[T functions.Number] struct {
+	typedState[T]
+	settings *Settings
+
+	numSamples int
+	maxSamples int
+	nextEmit   int64
+
+	mutex sync.Mutex
+}
+
+// AddSample implements window.Window.AddSample
+func (w *TypedTumblingTimeWindow[T]) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.load(sample) {
+		return false, nil
+	}
+
+	w.add(&w.acc, w.numSamples)
+	w.numSamples++
+
+	if w.numSamples > w.maxSamples {
+		w.maxSamples = w.numSamples
+	}
+
+	if !w.settings.ExternalTimer {
+		now := nowMillis()
+
+		if w.nextEmit == 0 {
+			w.nextEmit = now + int64(w.settings.Size)
+		} else if now >= w.nextEmit {
+			w.nextEmit = now + int64(w.settings.Size)
+			return w.nextBlock()
+		}
+	}
+
+	return false, nil
+}
+
+// NextBlock implements window.TimeWindow.NextBlock
+func (w *TypedTumblingTimeWindow[T]) NextBlock() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.nextBlock()
+}
+
+// Flush implements window.FlushableWindow.Flush
+func (w *TypedTumblingTimeWindow[T]) Flush() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.numSamples == 0 {
+		return false, nil
+	}
+
+	return w.nextBlock()
+}
+
+func (w *TypedTumblingTimeWindow[T]) nextBlock() (bool, interface{}) {
+
+	var val interface{}
+	if w.numSamples > 0 {
+		val = w.result(w.acc, w.maxSamples)
+	} else {
+		val = w.result(nil, 0)
+	}
+
+	w.numSamples = 0
+
+	if w.settings.TotalCountModifier > 0 {
+		w.maxSamples = 0
+	}
+
+	return true, val
+}
+
+/////////////////////////
+// Typed Sliding Window
+
+// NewTypedSlidingWindow creates a sliding window for numeric samples
+func NewTypedSlidingWindow[T functions.Number](fn *functions.Func[T], format Format, settings *Settings) *TypedSlidingWindow[T] {
+	return &TypedSlidingWindow[T]{typedState: typedState[T]{fn: fn, format: format}, settings: settings}
+}
+
+// TypedSlidingWindow is a sliding window whose samples are stored and aggregated without boxing them,
+// the samples are stored in a single ring buffer with the number of elements of the first sample.
+// Sums are maintained as samples enter and leave the window, they are recomputed every time the ring
+// wraps around so float rounding errors don't accumulate.
+type TypedSlidingWindow[T functions.Number] struct {
+	typedState[T]
+	settings *Settings
+
+	dims         int
+	ring         []T
+	sum          []T
+	filled       int
+	numSamples   int
+	currentBlock int
+	canEmit      bool
+
+	mutex sync.Mutex
+}
+
+// AddSample implements window.Window.AddSample
+func (w *TypedSlidingWindow[T]) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.load(sample) {
+		return false, nil
+	}
+
+	if w.ring == nil {
+		w.dims = len(w.sample)
+		w.ring = make([]T, w.settings.Size*w.dims)
+		w.sum = make([]T, w.dims)
+	}
+
+	running := w.fn.Op == functions.OpSum
+
+	if w.dims == 1 && len(w.sample) == 1 {
+		if running {
+			w.sum[0] += w.sample[0] - w.ring[w.currentBlock]
+		}
+		w.ring[w.currentBlock] = w.sample[0]
+	} else {
+		block := w.ring[w.currentBlock*w.dims : (w.currentBlock+1)*w.dims]
+		if running {
+			for i, v := range block {
+				w.sum[i] -= v
+			}
+		}
+		n := copy(block, w.sample)
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		if running {
+			for i, v := range block {
+				w.sum[i] += v
+			}
+		}
+	}
+
+	size := w.settings.Size
+
+	if w.filled < size {
+		w.filled++
+	}
+
+	if !w.canEmit && w.currentBlock == size-1 {
+		w.canEmit = true
+	}
+
+	w.currentBlock++
+	if w.currentBlock == size {
+		w.currentBlock = 0
+		if running {
+			w.resum()
+		}
+	}
+
+	w.numSamples++
+
+	if w.canEmit && w.numSamples >= w.settings.Resolution {
+		w.numSamples = 0
+		return true, w.aggregate()
+	}
+
+	return false, nil
+}
+
+// resum recomputes the sum of the samples in the ring
+func (w *TypedSlidingWindow[T]) resum() {
+
+	for i := range w.sum {
+		w.sum[i] = 0
+	}
+	w.fn.Fold(w.sum, w.ring[:w.filled*w.dims])
+}
+
+// aggregate aggregates the samples in the ring, the functions are commutative so the order of the
+// samples doesn't matter
+func (w *TypedSlidingWindow[T]) aggregate() interface{} {
+
+	if w.filled == 0 {
+		return w.result(nil, 0)
+	}
+
+	if w.fn.Op == functions.OpSum {
+		return w.result(w.sum, w.filled)
+	}
+
+	w.acc = append(w.acc[:0], w.ring[:w.dims]...)
+	w.fn.Fold(w.acc, w.ring[w.dims:w.filled*w.dims])
+
+	return w.result(w.acc, w.filled)
+}
+
+//////////////////////////////
+// Typed Sliding Time Window
+
+// NewTypedSlidingTimeWindow creates a sliding time window for numeric samples
+func NewTypedSlidingTimeWindow[T functions.Number](fn *functions.Func[T], format Format, settings *Settings) *TypedSlidingTimeWindow[T] {
+	numBlocks := settings.Size / settings.Resolution
+	return &TypedSlidingTimeWindow[T]{typedState: typedState[T]{fn: fn, format: format}, settings: settings,
+		numBlocks: numBlocks, blocks: make([][]T, numBlocks), counts: make([]int, numBlocks)}
+}
+
+// TypedSlidingTimeWindow is a sliding time window whose samples are aggregated without boxing them,
+// like SlidingTimeWindow the average is computed using the maximum number of samples of a block
+type TypedSlidingTimeWindow[T functions.Number] struct {
+	typedState[T]
+	settings *Settings
+
+	numBlocks    int
+	blocks       [][]T
+	counts       []int
+	numSamples   int
+	maxSamples   int
+	currentBlock int
+	canEmit      bool
+
+	nextBlockTime int64
+
+	mutex sync.Mutex
+}
+
+// AddSample implements window.Window.AddSample
+func (w *TypedSlidingTimeWindow[T]) AddSample(sample interface{}) (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.load(sample) {
+		return false, nil
+	}
+
+	w.add(&w.blocks[w.currentBlock], w.counts[w.currentBlock])
+	w.counts[w.currentBlock]++
+	w.numSamples++
+
+	if w.numSamples > w.maxSamples {
+		w.maxSamples = w.numSamples
+	}
+
+	if !w.settings.ExternalTimer {
+		now := nowMillis()
+
+		if w.nextBlockTime == 0 {
+			w.nextBlockTime = now + int64(w.settings.Resolution)
+		} else if now >= w.nextBlockTime {
+			w.nextBlockTime = now + int64(w.settings.Resolution)
+			return w.nextBlock()
+		}
+	}
+
+	return false, nil
+}
+
+// NextBlock implements window.TimeWindow.NextBlock
+func (w *TypedSlidingTimeWindow[T]) NextBlock() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.nextBlock()
+}
+
+func (w *TypedSlidingTimeWindow[T]) nextBlock() (bool, interface{}) {
+
+	if !w.canEmit && w.currentBlock == w.numBlocks-1 {
+		w.canEmit = true
+	}
+
+	w.numSamples = 0
+	w.currentBlock = (w.currentBlock + 1) % w.numBlocks
+
+	if !w.canEmit {
+		return false, nil
+	}
+
+	// aggregate from the oldest block, which is the new current block
+	n := 0
+	for i := 0; i < w.numBlocks; i++ {
+		idx := (w.currentBlock + i) % w.numBlocks
+		if w.counts[idx] == 0 {
+			continue
+		}
+		w.merge(&w.acc, n, w.blocks[idx])
+		n++
+	}
+
+	var val interface{}
+	if n > 0 {
+		val = w.result(w.acc, w.numBlocks*w.maxSamples)
+	} else {
+		val = w.result(nil, 0)
+	}
+
+	w.blocks[w.currentBlock] = w.blocks[w.currentBlock][:0]
+	w.counts[w.currentBlock] = 0
+
+	return true, val
+}
@@ -0,0 +1,248 @@
+package window
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/project-flogo/stream/activity/aggregate/window/functions"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFunc[T functions.Number](function string) *functions.Func[T] {
+	fn, _ := functions.NewFunc[T](function)
+	return fn
+}
+
+// samples are boxed before the benchmarks, so only the windows are measured
+var (
+	benchFloats = boxed(func(i int) interface{} { return float64(i % 100) })
+	benchInts   = boxed(func(i int) interface{} { return i % 100 })
+	benchVector = boxed(func(i int) interface{} { return []float64{float64(i), 3, 2, 7} })
+)
+
+func boxed(sample func(i int) interface{}) []interface{} {
+	samples := make([]interface{}, 1024)
+	for i := range samples {
+		samples[i] = sample(i)
+	}
+	return samples
+}
+
+func benchmarkWindow(b *testing.B, w Window, samples []interface{}) {
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.AddSample(samples[i%len(samples)])
+	}
+}
+
+func benchmarkTimeWindow(b *testing.B, w TimeWindow, samples []interface{}) {
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.AddSample(samples[i%len(samples)])
+		if i%100 == 0 {
+			w.NextBlock()
+		}
+	}
+}
+
+func BenchmarkTumblingWindow_Float(b *testing.B) {
+	w := NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 100})
+	benchmarkWindow(b, w, benchFloats)
+}
+
+func BenchmarkTypedTumblingWindow_Float(b *testing.B) {
+	w := NewTypedTumblingWindow(newFunc[float64]("avg"), Format{Float: true}, &Settings{Size: 100})
+	benchmarkWindow(b, w, benchFloats)
+}
+
+func BenchmarkTumblingWindow_Vector(b *testing.B) {
+	w := NewTumblingWindow(functions.AddSampleMax, functions.AggregateSingleNoopFunc, &Settings{Size: 100})
+	benchmarkWindow(b, w, benchVector)
+}
+
+func BenchmarkTypedTumblingWindow_Vector(b *testing.B) {
+	w := NewTypedTumblingWindow(newFunc[float64]("max"), Format{Float: true, Vector: true}, &Settings{Size: 100})
+	benchmarkWindow(b, w, benchVector)
+}
+
+func BenchmarkSlidingWindow_Int(b *testing.B) {
+	w := NewSlidingWindow(functions.AggregateBlocksSum, &Settings{Size: 1000, Resolution: 10})
+	benchmarkWindow(b, w, benchInts)
+}
+
+func BenchmarkTypedSlidingWindow_Int(b *testing.B) {
+	w := NewTypedSlidingWindow(newFunc[int64]("sum"), Format{Native: true}, &Settings{Size: 1000, Resolution: 10})
+	benchmarkWindow(b, w, benchInts)
+}
+
+func BenchmarkSlidingTimeWindow_Float(b *testing.B) {
+	w := NewSlidingTimeWindow(functions.AddSampleSum, functions.AggregateBlocksSum, &Settings{Size: 1000, Resolution: 100, ExternalTimer: true})
+	benchmarkTimeWindow(b, w, benchFloats)
+}
+
+func BenchmarkTypedSlidingTimeWindow_Float(b *testing.B) {
+	w := NewTypedSlidingTimeWindow(newFunc[float64]("sum"), Format{Float: true}, &Settings{Size: 1000, Resolution: 100, ExternalTimer: true})
+	benchmarkTimeWindow(b, w, benchFloats)
+}
+
+func TestTypedTumblingWindow(t *testing.T) {
+
+	w := NewTypedTumblingWindow(newFunc[int64]("avg"), Format{Native: true}, &Settings{Size: 3})
+
+	var emit bool
+	var val interface{}
+	for _, sample := range []int{1, 2, 3} {
+		emit, val = w.AddSample(sample)
+	}
+	assert.True(t, emit)
+	assert.Equal(t, 2, val)
+
+	//min is reset between windows
+	w = NewTypedTumblingWindow(newFunc[int64]("min"), Format{}, &Settings{Size: 2})
+	w.AddSample(3)
+	_, val = w.AddSample(5)
+	assert.Equal(t, int64(3), val)
+	w.AddSample(7)
+	_, val = w.AddSample(6)
+	assert.Equal(t, int64(6), val)
+
+	w = NewTypedTumblingWindow(newFunc[int64]("count"), Format{Vector: true}, &Settings{Size: 3})
+	w.AddSample([]int64{1, 2})
+	emit, val = w.Flush()
+	assert.True(t, emit)
+	assert.Equal(t, 1, val)
+}
+
+func TestTypedTumblingWindow_Vector(t *testing.T) {
+
+	w := NewTypedTumblingWindow(newFunc[float64]("sum"), Format{Float: true, Vector: true}, &Settings{Size: 2})
+
+	s := []float64{1, 2}
+	w.AddSample(s)
+	emit, val := w.AddSample(s)
+	assert.True(t, emit)
+	assert.Equal(t, []float64{2, 4}, val)
+
+	//the samples aren't modified
+	assert.Equal(t, []float64{1, 2}, s)
+}
+
+func TestTypedWindows_MatchUntyped(t *testing.T) {
+
+	samples := []int{5, 3, 8, 1, 9, 4, 7, 2}
+
+	for _, function := range []string{"avg", "sum", "min", "max", "count"} {
+		var untyped Window
+		switch function {
+		case "avg":
+			untyped = NewSlidingWindow(functions.AggregateBlocksAvg, &Settings{Size: 4, Resolution: 1})
+		case "sum":
+			untyped = NewSlidingWindow(functions.AggregateBlocksSum, &Settings{Size: 4, Resolution: 1})
+		case "min":
+			untyped = NewSlidingWindow(functions.AggregateBlocksMin, &Settings{Size: 4, Resolution: 1})
+		case "max":
+			untyped = NewSlidingWindow(functions.AggregateBlocksMax, &Settings{Size: 4, Resolution: 1})
+		case "count":
+			untyped = NewSlidingWindow(functions.AggregateBlocksCount, &Settings{Size: 4, Resolution: 1})
+		}
+		typed := NewTypedSlidingWindow(newFunc[int64](function), Format{Native: true}, &Settings{Size: 4, Resolution: 1})
+
+		for _, sample := range samples {
+			emit, val := untyped.AddSample(sample)
+			typedEmit, typedVal := typed.AddSample(sample)
+			assert.Equal(t, emit, typedEmit, function)
+			assert.Equal(t, val, typedVal, function)
+		}
+	}
+}
+
+func TestTypedSlidingTimeWindow(t *testing.T) {
+
+	w := NewTypedSlidingTimeWindow(newFunc[float64]("sum"), Format{Float: true}, &Settings{Size: 3, Resolution: 1, ExternalTimer: true})
+
+	w.AddSample(1.0)
+	emit, _ := w.NextBlock()
+	assert.False(t, emit)
+	w.AddSample(2.0)
+	w.NextBlock()
+	w.AddSample(3.0)
+	emit, val := w.NextBlock()
+	assert.True(t, emit)
+	assert.Equal(t, 6.0, val)
+
+	w.AddSample(4.0)
+	emit, val = w.NextBlock()
+	assert.True(t, emit)
+	assert.Equal(t, 9.0, val)
+}
+
+func TestTypedWindow_Snapshot(t *testing.T) {
+
+	settings := &Settings{Size: 3, Resolution: 1}
+	w := NewTypedSlidingWindow(newFunc[float64]("max"), Format{Float: true, Vector: true}, settings)
+
+	w.AddSample([]float64{1, 5})
+	w.AddSample([]float64{4, 2})
+
+	data, err := json.Marshal(w.Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	restored := NewTypedSlidingWindow(newFunc[float64]("max"), Format{Float: true, Vector: true}, settings)
+	err = restored.Restore(snapshot)
+	assert.Nil(t, err)
+
+	emit, val := restored.AddSample([]float64{3, 3})
+	assert.True(t, emit)
+	assert.Equal(t, []float64{4, 5}, val)
+
+	tw := NewTypedTumblingTimeWindow(newFunc[int64]("count"), Format{}, &Settings{Size: 10, ExternalTimer: true})
+	tw.AddSample(1)
+	tw.AddSample(1)
+
+	restoredTw := NewTypedTumblingTimeWindow(newFunc[int64]("count"), Format{}, &Settings{Size: 10, ExternalTimer: true})
+	err = restoredTw.Restore(tw.Snapshot())
+	assert.Nil(t, err)
+
+	restoredTw.AddSample(1)
+	_, val = restoredTw.NextBlock()
+	assert.Equal(t, 3, val)
+}
+
+func TestFormatOf(t *testing.T) {
+
+	format, ok := FormatOf(1)
+	assert.True(t, ok)
+	assert.Equal(t, Format{Native: true}, format)
+
+	format, ok = FormatOf([]float64{1})
+	assert.True(t, ok)
+	assert.Equal(t, Format{Float: true, Vector: true}, format)
+
+	_, ok = FormatOf(map[string]interface{}{})
+	assert.False(t, ok)
+
+	format, err := ParseSampleType("[]int64")
+	assert.Nil(t, err)
+	assert.Equal(t, Format{Vector: true}, format)
+
+	_, err = ParseSampleType("int8")
+	assert.NotNil(t, err)
+}
+
+func BenchmarkSlidingWindow_Vector(b *testing.B) {
+	w := NewSlidingWindow(functions.AggregateBlocksAvg, &Settings{Size: 1000, Resolution: 10})
+	benchmarkWindow(b, w, benchVector)
+}
+
+func BenchmarkTypedSlidingWindow_Vector(b *testing.B) {
+	w := NewTypedSlidingWindow(newFunc[float64]("avg"), Format{Float: true, Vector: true}, &Settings{Size: 1000, Resolution: 10})
+	benchmarkWindow(b, w, benchVector)
+}
@@ -13,3 +13,22 @@ type TimeWindow interface {
 	// NextBlock tells the time window to advance
 	NextBlock() (bool, interface{})
 }
+
+// FlushableWindow a window that can emit the results of a partially filled window
+type FlushableWindow interface {
+	Window
+
+	// Flush emits the aggregate of the samples currently in the window
+	Flush() (bool, interface{})
+}
+
+// SnapshotWindow a window whose state can be captured and restored
+type SnapshotWindow interface {
+	Window
+
+	// Snapshot captures the current state of the window
+	Snapshot() *Snapshot
+
+	// Restore restores the window to the state captured by the snapshot
+	Restore(snapshot *Snapshot) error
+}
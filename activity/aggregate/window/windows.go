@@ -13,12 +13,30 @@ import (
 type Settings struct {
 	Size          int
 	Resolution    int
+	Hop           int
 	ExternalTimer bool
 
 	TotalCountModifier int
 
+	// Quantile is the quantile (0 to 1) computed by the quantile function
+	Quantile float64
+
 	NameKey  string
 	ValueKey string
+
+	// K is the number of entries returned by the topK function
+	K int
+	// TopKSketch bounds the number of keys counted by the topK function to TopKCapacity
+	TopKSketch   bool
+	TopKCapacity int
+	// TopKKey and TopKValue are the fields of the samples that are the key and the value ranked by the topK function
+	TopKKey   string
+	TopKValue string
+
+	// MaxOutOfOrderness is the time in millis the watermark of an event time window trails the latest sample
+	MaxOutOfOrderness int
+	// AllowedLateness is the time in millis a closed event time window still accepts late samples
+	AllowedLateness int
 }
 
 func (s *Settings) SetAdditionalSettings(as map[string]string) error {
@@ -32,6 +50,37 @@ func (s *Settings) SetAdditionalSettings(as map[string]string) error {
 			s.NameKey = value
 		case "valuekey":
 			s.ValueKey = value
+		case "quantile":
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				return fmt.Errorf("invalid quantile '%s', must be between 0 and 1", value)
+			}
+			s.Quantile = q
+		case "k":
+			k, err := strconv.Atoi(value)
+			if err != nil || k <= 0 {
+				return fmt.Errorf("invalid k '%s', must be a positive integer", value)
+			}
+			s.K = k
+		case "topkmode":
+			switch value {
+			case "exact":
+				s.TopKSketch = false
+			case "sketch":
+				s.TopKSketch = true
+			default:
+				return fmt.Errorf("unsupported topK mode '%s', must be exact or sketch", value)
+			}
+		case "topkcapacity":
+			capacity, err := strconv.Atoi(value)
+			if err != nil || capacity <= 0 {
+				return fmt.Errorf("invalid topK capacity '%s', must be a positive integer", value)
+			}
+			s.TopKCapacity = capacity
+		case "topkkey":
+			s.TopKKey = value
+		case "topkvalue":
+			s.TopKValue = value
 		}
 	}
 
@@ -107,6 +156,29 @@ func (w *TumblingWindow) AddSample(sample interface{}) (bool, interface{}) {
 	return false, nil
 }
 
+// Flush implements window.FlushableWindow.Flush
+func (w *TumblingWindow) Flush() (bool, interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.numSamples == 0 {
+		return false, nil
+	}
+
+	if w.dataMap != nil {
+		w.numSamples = 0
+		return true, w.dataMap.extractData()
+	}
+
+	val := w.aggFunc(w.data, w.numSamples)
+
+	w.numSamples = 0
+	w.data, _ = zero(w.data)
+
+	return true, val
+}
+
 ///////////////////////
 // Tumbling Time Window
 
@@ -181,6 +253,18 @@ func (w *TumblingTimeWindow) NextBlock() (bool, interface{}) {
 	return w.nextBlock()
 }
 
+// Flush implements window.FlushableWindow.Flush
+func (w *TumblingTimeWindow) Flush() (bool, interface{}) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.numSamples == 0 {
+		return false, nil
+	}
+
+	return w.nextBlock()
+}
+
 func (w *TumblingTimeWindow) nextBlock() (bool, interface{}) {
 
 	var val interface{}
@@ -320,7 +404,7 @@ type SlidingTimeWindow struct {
 func (w *SlidingTimeWindow) AddSample(sample interface{}) (bool, interface{}) {
 
 	w.mutex.Lock()
-	defer w.mutex.Lock()
+	defer w.mutex.Unlock()
 
 	if w.dataMap != nil {
 		w.dataMap.addBlockSample(w.currentBlock, sample)
@@ -356,7 +440,7 @@ func (w *SlidingTimeWindow) AddSample(sample interface{}) (bool, interface{}) {
 func (w *SlidingTimeWindow) NextBlock() (bool, interface{}) {
 
 	w.mutex.Lock()
-	defer w.mutex.Lock()
+	defer w.mutex.Unlock()
 
 	return w.nextBlock()
 }
@@ -402,15 +486,10 @@ func zero(a interface{}) (interface{}, error) {
 	case float64:
 		return 0.0, nil
 	case []int:
-		for idx := range x {
-			x[idx] = 0
-		}
-		return x, nil
+		//the aggregated value may be the data itself, so it's replaced rather than cleared
+		return make([]int, len(x)), nil
 	case []float64:
-		for idx := range x {
-			x[idx] = 0.0
-		}
-		return x, nil
+		return make([]float64, len(x)), nil
 	}
 
 	return nil, fmt.Errorf("unsupported type")
@@ -1,7 +1,9 @@
 package window
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/project-flogo/stream/activity/aggregate/window/functions"
 	"github.com/stretchr/testify/assert"
@@ -39,6 +41,34 @@ func TestTumblingWindow_AddSample(t *testing.T) {
 	assert.Equal(t, 5, a)
 }
 
+func TestTumblingWindow_AddSampleArray(t *testing.T) {
+
+	w := NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 2})
+
+	first := []int{1, 2}
+	emit, _ := w.AddSample(first)
+	assert.False(t, emit)
+	emit, a := w.AddSample([]int{3, 4})
+	assert.True(t, emit)
+	assert.Equal(t, []int{4, 6}, a)
+
+	//the emitted sum is kept once the window is reset
+	emit, _ = w.AddSample([]int{1, 1})
+	assert.False(t, emit)
+	assert.Equal(t, []int{4, 6}, a)
+
+	//the samples are left untouched
+	assert.Equal(t, []int{1, 2}, first)
+
+	w = NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 1})
+
+	sample := []float64{1.5, 2}
+	emit, a = w.AddSample(sample)
+	assert.True(t, emit)
+	assert.Equal(t, []float64{1.5, 2}, a)
+	assert.Equal(t, []float64{1.5, 2}, sample)
+}
+
 func TestTumblingWindow_AddSampleAccum(t *testing.T) {
 
 	w := NewTumblingWindow(functions.AddSampleAccum, functions.AggregateSingleNoopFunc, &Settings{Size: 3})
@@ -64,6 +94,27 @@ func TestTumblingWindow_AddSampleAccum(t *testing.T) {
 	assert.Equal(t, 3, len(arr))
 }
 
+func TestTumblingWindow_Flush(t *testing.T) {
+
+	w := NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 3}).(FlushableWindow)
+
+	emit, a := w.Flush()
+	assert.False(t, emit)
+
+	w.AddSample(2)
+	w.AddSample(4)
+	emit, a = w.Flush()
+	assert.True(t, emit)
+	assert.Equal(t, 3, a)
+
+	//window starts over after a flush
+	emit, a = w.AddSample(3)
+	assert.False(t, emit)
+	emit, a = w.Flush()
+	assert.True(t, emit)
+	assert.Equal(t, 3, a)
+}
+
 func TestTumblingTimeWindowExt_AddSample(t *testing.T) {
 
 	w := NewTumblingTimeWindow(functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 10, ExternalTimer: true})
@@ -183,6 +234,412 @@ func TestSlidingTimeWindowExt_AddSample(t *testing.T) {
 	assert.Equal(t, 3, v)
 }
 
+func TestTumblingWindow_Snapshot(t *testing.T) {
+
+	w := NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 3})
+	w.AddSample(1)
+	w.AddSample(2)
+
+	data, err := json.Marshal(w.(SnapshotWindow).Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2 := NewTumblingWindow(functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 3})
+	err = w2.(SnapshotWindow).Restore(snapshot)
+	assert.Nil(t, err)
+
+	emit, a := w2.AddSample(3)
+	assert.True(t, emit)
+	assert.Equal(t, 2, a)
+}
+
+func TestSlidingTimeWindow_Snapshot(t *testing.T) {
+
+	settings := &Settings{Size: 30, Resolution: 10, ExternalTimer: true}
+	w := NewSlidingTimeWindow(functions.AddSampleSum, functions.AggregateBlocksAvg, settings)
+
+	w.AddSample(1)
+	w.AddSample(5)
+	w.NextBlock()
+	w.AddSample(5)
+	w.AddSample(5)
+	w.NextBlock()
+
+	data, err := json.Marshal(w.(SnapshotWindow).Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2 := NewSlidingTimeWindow(functions.AddSampleSum, functions.AggregateBlocksAvg, settings)
+	err = w2.(SnapshotWindow).Restore(snapshot)
+	assert.Nil(t, err)
+
+	//(6 + 10 + 5) / (3 blocks * 2 max samples)
+	w2.AddSample(4)
+	w2.AddSample(1)
+	e, v := w2.NextBlock()
+	assert.True(t, e)
+	assert.Equal(t, 3, v)
+
+	//window sizes must match
+	w3 := NewSlidingTimeWindow(functions.AddSampleSum, functions.AggregateBlocksAvg, &Settings{Size: 20, Resolution: 10, ExternalTimer: true})
+	err = w3.(SnapshotWindow).Restore(snapshot)
+	assert.NotNil(t, err)
+}
+
+func TestTumblingEventTimeWindow(t *testing.T) {
+
+	w := NewTumblingEventTimeWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 10, MaxOutOfOrderness: 5})
+
+	results, late := w.AddEvent(1, 3)
+	assert.False(t, late)
+	assert.Empty(t, results)
+	results, _ = w.AddEvent(2, 12)
+	assert.Empty(t, results)
+
+	//out of order, but within the bound
+	results, late = w.AddEvent(4, 8)
+	assert.False(t, late)
+	assert.Empty(t, results)
+
+	//watermark passes the end of the first window
+	results, _ = w.AddEvent(3, 16)
+	assert.Equal(t, []*Result{{Start: 0, End: 10, Count: 2, Value: 5}}, results)
+
+	results, late = w.AddEvent(7, 5)
+	assert.True(t, late)
+	assert.Empty(t, results)
+	assert.Equal(t, 1, w.LateCount())
+
+	//remaining windows are closed regardless of the watermark
+	results = w.CloseAll()
+	assert.Equal(t, []*Result{{Start: 10, End: 20, Count: 2, Value: 5}}, results)
+}
+
+func TestTumblingEventTimeWindow_AllowedLateness(t *testing.T) {
+
+	w := NewTumblingEventTimeWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 10, AllowedLateness: 10})
+
+	w.AddEvent(1, 5)
+	results, _ := w.AddEvent(2, 12)
+	assert.Equal(t, []*Result{{Start: 0, End: 10, Count: 1, Value: 1}}, results)
+
+	//late sample updates the closed window
+	results, late := w.AddEvent(3, 7)
+	assert.False(t, late)
+	assert.Equal(t, []*Result{{Start: 0, End: 10, Count: 2, Value: 4, Update: true}}, results)
+
+	results, _ = w.AddEvent(4, 25)
+	assert.Equal(t, []*Result{{Start: 10, End: 20, Count: 1, Value: 2}}, results)
+
+	//first window no longer accepts late samples
+	_, late = w.AddEvent(5, 8)
+	assert.True(t, late)
+}
+
+func TestSlidingEventTimeWindow(t *testing.T) {
+
+	w := NewSlidingEventTimeWindow(functions.AddSampleCount, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 20, Resolution: 10})
+
+	results, _ := w.AddEvent(1, 5)
+	assert.Empty(t, results)
+
+	results, _ = w.AddEvent(1, 15)
+	assert.Equal(t, []*Result{{Start: -10, End: 10, Count: 1, Value: 1}}, results)
+
+	results, _ = w.AddEvent(1, 16)
+	assert.Empty(t, results)
+
+	//watermark jumps, closing multiple windows
+	results, _ = w.AddEvent(1, 45)
+	assert.Equal(t, []*Result{{Start: 0, End: 20, Count: 3, Value: 3}, {Start: 10, End: 30, Count: 2, Value: 2}}, results)
+}
+
+func TestSlidingEventTimeWindow_Snapshot(t *testing.T) {
+
+	settings := &Settings{Size: 20, Resolution: 10}
+	w := NewSlidingEventTimeWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+
+	w.AddEvent(1, 5)
+	w.AddEvent(2, 15)
+	w.AddEvent(3, 2)
+
+	data, err := json.Marshal(w.(SnapshotWindow).Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2 := NewSlidingEventTimeWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+	err = w2.(SnapshotWindow).Restore(snapshot)
+	assert.Nil(t, err)
+
+	results, _ := w2.AddEvent(4, 20)
+	assert.Equal(t, []*Result{{Start: 0, End: 20, Count: 3, Value: []interface{}{1, 3, 2}}}, results)
+
+	_, late := w2.AddEvent(5, 1)
+	assert.True(t, late)
+	assert.Equal(t, 1, w2.LateCount())
+}
+
+func TestSessionWindow(t *testing.T) {
+
+	w := NewSessionWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 10, MaxOutOfOrderness: 20})
+
+	w.AddEvent(1, 100)
+	w.AddEvent(2, 105)
+	w.AddEvent(3, 130)
+
+	//bridges the two sessions
+	results, _ := w.AddEvent(4, 114)
+	assert.Empty(t, results)
+	results, _ = w.AddEvent(5, 122)
+	assert.Empty(t, results)
+
+	results, _ = w.AddEvent(6, 200)
+	assert.Equal(t, []*Result{{Start: 100, End: 130, Count: 5, Value: 15}}, results)
+
+	_, late := w.AddEvent(7, 150)
+	assert.True(t, late)
+	assert.Equal(t, 1, w.LateCount())
+
+	//within the out-of-orderness bound
+	_, late = w.AddEvent(7, 192)
+	assert.False(t, late)
+
+	results = w.Advance(230)
+	assert.Equal(t, []*Result{{Start: 192, End: 200, Count: 2, Value: 13}}, results)
+}
+
+func TestSessionWindow_Snapshot(t *testing.T) {
+
+	settings := &Settings{Size: 10}
+	w := NewSessionWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+
+	w.AddEvent(1, 100)
+	w.AddEvent(2, 105)
+
+	data, err := json.Marshal(w.Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2 := NewSessionWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+	err = w2.Restore(snapshot)
+	assert.Nil(t, err)
+
+	w2.AddEvent(3, 110)
+	results := w2.CloseAll()
+	assert.Equal(t, []*Result{{Start: 100, End: 110, Count: 3, Value: []interface{}{1, 2, 3}}}, results)
+}
+
+func TestHoppingWindow(t *testing.T) {
+
+	w, err := NewHoppingWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 4, Hop: 2})
+	assert.Nil(t, err)
+
+	expected := []interface{}{nil, nil, nil, 10, nil, 18, nil, 26}
+
+	for i, val := range expected {
+		emit, result := w.AddSample(i + 1)
+		assert.Equal(t, val != nil, emit)
+		assert.Equal(t, val, result)
+	}
+
+	//flush emits the samples retained for the next window
+	emit, result := w.(FlushableWindow).Flush()
+	assert.True(t, emit)
+	assert.Equal(t, 15, result)
+
+	_, err = NewHoppingWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleNoopFunc, &Settings{Size: 4})
+	assert.NotNil(t, err)
+}
+
+func TestHoppingWindow_Gaps(t *testing.T) {
+
+	//hop larger than the size skips samples
+	w, err := NewHoppingWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, &Settings{Size: 2, Hop: 3})
+	assert.Nil(t, err)
+
+	var results []interface{}
+	for i := 1; i <= 8; i++ {
+		if emit, result := w.AddSample(i); emit {
+			results = append(results, result)
+		}
+	}
+
+	assert.Equal(t, []interface{}{[]interface{}{1, 2}, []interface{}{4, 5}, []interface{}{7, 8}}, results)
+}
+
+func TestHoppingTimeWindowExt(t *testing.T) {
+
+	//window of 30 millis emitted every 20 millis, progressed every 10 millis
+	w, err := NewHoppingTimeWindow(functions.AddSampleSum, functions.AddSampleSum, functions.AggregateSingleAvg, &Settings{Size: 30, Hop: 20, ExternalTimer: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Millisecond, w.PaneInterval())
+
+	w.AddSample(1)
+	w.NextBlock()
+	w.AddSample(2)
+	w.NextBlock()
+	w.AddSample(3)
+	e, v := w.NextBlock()
+	assert.True(t, e)
+	assert.Equal(t, 2, v)
+
+	w.AddSample(7)
+	e, _ = w.NextBlock()
+	assert.False(t, e)
+	w.AddSample(8)
+	e, v = w.NextBlock()
+	assert.True(t, e)
+	assert.Equal(t, 6, v)
+}
+
+func TestHoppingWindow_Snapshot(t *testing.T) {
+
+	settings := &Settings{Size: 4, Hop: 2}
+	w, _ := NewHoppingWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+
+	for i := 1; i <= 5; i++ {
+		w.AddSample(i)
+	}
+
+	data, err := json.Marshal(w.(SnapshotWindow).Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2, _ := NewHoppingWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, settings)
+	err = w2.(SnapshotWindow).Restore(snapshot)
+	assert.Nil(t, err)
+
+	emit, result := w2.AddSample(6)
+	assert.True(t, emit)
+	assert.Equal(t, []interface{}{3, 4, 5, 6}, result)
+
+	//window sizes must match
+	w3, _ := NewHoppingWindow(functions.AddSampleAccum, functions.MergeAccum, functions.AggregateSingleNoopFunc, &Settings{Size: 6, Hop: 2})
+	err = w3.(SnapshotWindow).Restore(snapshot)
+	assert.NotNil(t, err)
+}
+
+func TestSlidingWindow_Stats(t *testing.T) {
+
+	//blocks of a sliding window are samples, added oldest first
+	w := NewSlidingWindow(functions.NewSampleBlocksFunc(functions.AddSampleFirst, functions.AggregateSingleFirst), &Settings{Size: 3, Resolution: 1})
+
+	w.AddSample(1)
+	w.AddSample(2)
+	emit, v := w.AddSample(3)
+	assert.True(t, emit)
+	assert.Equal(t, 1, v)
+
+	_, v = w.AddSample(4)
+	assert.Equal(t, 2, v)
+
+	w = NewSlidingWindow(functions.NewSampleBlocksFunc(functions.AddSampleDigest, functions.NewAggregateSingleQuantile(0.5)), &Settings{Size: 3, Resolution: 1})
+	w.AddSample(5)
+	w.AddSample(1)
+	_, v = w.AddSample(3)
+	assert.Equal(t, 3.0, v)
+}
+
+func TestSlidingTimeWindow_Stats(t *testing.T) {
+
+	settings := &Settings{Size: 20, Resolution: 10, ExternalTimer: true}
+	w := NewSlidingTimeWindow(functions.AddSampleLast, functions.NewMergeBlocksFunc(functions.MergeLast, functions.AggregateSingleLast), settings)
+
+	w.AddSample(1)
+	w.NextBlock()
+	w.AddSample(2)
+	w.AddSample(3)
+	e, v := w.NextBlock()
+	assert.True(t, e)
+	assert.Equal(t, 3, v)
+
+	w = NewSlidingTimeWindow(functions.AddSampleMoments, functions.NewMergeBlocksFunc(functions.MergeMoments, functions.AggregateSingleVariance), settings)
+
+	w.AddSample(2)
+	w.AddSample(4)
+	w.NextBlock()
+	w.AddSample(6)
+	e, v = w.NextBlock()
+	assert.True(t, e)
+	assert.Equal(t, 4.0, v)
+}
+
+func TestTumblingWindow_StatsSnapshot(t *testing.T) {
+
+	w := NewTumblingWindow(functions.AddSampleMoments, functions.AggregateSingleVariance, &Settings{Size: 3})
+	w.AddSample(2)
+	w.AddSample(4)
+
+	data, err := json.Marshal(w.(SnapshotWindow).Snapshot())
+	assert.Nil(t, err)
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	assert.Nil(t, err)
+
+	w2 := NewTumblingWindow(functions.AddSampleMoments, functions.AggregateSingleVariance, &Settings{Size: 3})
+	err = w2.(SnapshotWindow).Restore(snapshot)
+	assert.Nil(t, err)
+
+	emit, v := w2.AddSample(6)
+	assert.True(t, emit)
+	assert.Equal(t, 4.0, v)
+
+	//accumulator is reset after emitting
+	w2.AddSample(1)
+	w2.AddSample(1)
+	_, v = w2.AddSample(1)
+	assert.Equal(t, 0.0, v)
+}
+
+func TestHoppingWindow_Stats(t *testing.T) {
+
+	w, err := NewHoppingWindow(functions.AddSampleRange, functions.MergeRange, functions.AggregateSingleRange, &Settings{Size: 4, Hop: 2})
+	assert.Nil(t, err)
+
+	var results []interface{}
+	for _, val := range []int{1, 5, 2, 3, 4, 4} {
+		if emit, v := w.AddSample(val); emit {
+			results = append(results, v)
+		}
+	}
+
+	assert.Equal(t, []interface{}{4, 2}, results)
+}
+
+func TestValue(t *testing.T) {
+
+	values := []interface{}{3, 2.5, []int{1, 2}, []float64{1.5, 2.5}, []interface{}{1, 2.5}}
+
+	for _, val := range values {
+		data, err := json.Marshal(NewValue(val))
+		assert.Nil(t, err)
+
+		v := &Value{}
+		err = json.Unmarshal(data, v)
+		assert.Nil(t, err)
+
+		restored, err := v.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, val, restored)
+	}
+}
+
 func TestZero(t *testing.T) {
 	//var fa []float64
 	//zero(fa)
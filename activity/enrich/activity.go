@@ -0,0 +1,213 @@
+package enrich
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/engine/channels"
+	"github.com/project-flogo/core/support/log"
+)
+
+const (
+	ivKey   = "key"
+	ivValue = "value"
+
+	ovFound  = "found"
+	ovRecord = "record"
+	ovValue  = "value"
+
+	missingPass  = "pass"
+	missingDrop  = "drop"
+	missingError = "error"
+)
+
+type Settings struct {
+	KeyField       string `md:"keyField,required"`
+	File           string `md:"file"`
+	Format         string `md:"format"`
+	ReloadInterval int    `md:"reloadInterval"`
+	Channel        string `md:"channel"`
+	Merge          bool   `md:"merge"`
+	OnMissing      string `md:"onMissing"`
+}
+
+type Input struct {
+	Key   interface{} `md:"key"`
+	Value interface{} `md:"value"`
+}
+
+type Output struct {
+	Found  bool                   `md:"found"`
+	Record map[string]interface{} `md:"record"`
+	Value  interface{}            `md:"value"`
+}
+
+func init() {
+	_ = activity.Register(&Activity{}, New)
+}
+
+var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
+
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(ctx.Settings(), s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.OnMissing {
+	case "":
+		s.OnMissing = missingPass
+	case missingPass, missingDrop, missingError:
+	default:
+		return nil, fmt.Errorf("unsupported onMissing: '%s'", s.OnMissing)
+	}
+
+	if s.File == "" && s.Channel == "" {
+		return nil, fmt.Errorf("file or channel must be specified for the enrichment table")
+	}
+
+	act := &Activity{settings: s, table: NewTable(s.KeyField)}
+
+	if s.File != "" {
+		act.source, err = newFileSource(s.File, s.Format, act.table)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = act.source.reload()
+		if err != nil {
+			return nil, err
+		}
+
+		if s.ReloadInterval > 0 {
+			logger := ctx.Logger()
+			act.source.watch(time.Duration(s.ReloadInterval)*time.Millisecond, func(err error) {
+				logger.Errorf("Unable to reload enrichment table: %v", err)
+			})
+		}
+	}
+
+	if s.Channel != "" {
+		ch := channels.Get(s.Channel)
+		if ch == nil {
+			act.Cleanup()
+			return nil, fmt.Errorf("engine channel '%s' not registered", s.Channel)
+		}
+
+		err = ch.RegisterCallback(act.upsert(ctx.Logger()))
+		if err != nil {
+			act.Cleanup()
+			return nil, err
+		}
+	}
+
+	return act, nil
+}
+
+// Activity is an Activity that is used to enrich a message with a record of a reference table
+type Activity struct {
+	settings *Settings
+	table    *Table
+	source   *fileSource
+}
+
+// Metadata returns the activity's metadata
+func (a *Activity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements api.Activity.Eval - Enriches the Message
+func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
+
+	key, err := coerce.ToString(ctx.GetInput(ivKey))
+	if err != nil {
+		return false, fmt.Errorf("invalid enrichment key: %s", err.Error())
+	}
+
+	in := ctx.GetInput(ivValue)
+	record, found := a.table.Get(key)
+
+	if !found {
+		switch a.settings.OnMissing {
+		case missingError:
+			return false, fmt.Errorf("no enrichment record for key '%s'", key)
+		case missingDrop:
+			done = false
+		default:
+			done = true
+		}
+	} else {
+		done = true
+	}
+
+	out := in
+	if found && a.settings.Merge {
+		out, err = merge(in, record)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = ctx.SetOutput(ovFound, found)
+	if err != nil {
+		return false, err
+	}
+	err = ctx.SetOutput(ovRecord, record)
+	if err != nil {
+		return false, err
+	}
+	err = ctx.SetOutput(ovValue, out)
+	if err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
+
+// Cleanup implements support.NeedsCleanup, it stops reloading the table
+func (a *Activity) Cleanup() error {
+	if a.source != nil {
+		a.source.close()
+	}
+	return nil
+}
+
+// upsert returns the channel callback that upserts the records published to the channel
+func (a *Activity) upsert(logger log.Logger) channels.OnMessage {
+	return func(msg interface{}) {
+		record, err := coerce.ToObject(msg)
+		if err == nil {
+			err = a.table.Upsert(record)
+		}
+		if err != nil {
+			logger.Errorf("Unable to upsert enrichment record: %v", err)
+		}
+	}
+}
+
+// merge returns a copy of the value with the fields of the record added, the fields of the record
+// replace fields of the value with the same name
+func merge(value interface{}, record map[string]interface{}) (map[string]interface{}, error) {
+
+	merged := make(map[string]interface{})
+
+	if value != nil {
+		obj, err := coerce.ToObject(value)
+		if err != nil {
+			return nil, fmt.Errorf("only objects can be merged with an enrichment record: %s", err.Error())
+		}
+		for name, v := range obj {
+			merged[name] = v
+		}
+	}
+
+	for name, v := range record {
+		merged[name] = v
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,154 @@
+package enrich
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/engine/channels"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+
+	ref := activity.GetRef(&Activity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+func writeTable(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	assert.Nil(t, err)
+	return path
+}
+
+func TestEnrichCSV(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "enrich")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTable(t, dir, "devices.csv", "id,location,threshold\n007,lab,80\n008,roof,95.5\n")
+
+	settings := &Settings{KeyField: "id", File: path, Merge: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivKey, "007")
+	tc.SetInput(ivValue, map[string]interface{}{"id": "007", "temp": 85})
+
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.True(t, tc.GetOutput(ovFound).(bool))
+	assert.Equal(t, map[string]interface{}{"id": "007", "location": "lab", "threshold": 80.0}, tc.GetOutput(ovRecord))
+	assert.Equal(t, map[string]interface{}{"id": "007", "temp": 85, "location": "lab", "threshold": 80.0}, tc.GetOutput(ovValue))
+
+	//missing records are passed on by default
+	tc.SetInput(ivKey, "009")
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.False(t, tc.GetOutput(ovFound).(bool))
+}
+
+func TestEnrichJSON_Reload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "enrich")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTable(t, dir, "devices.json", `{"a": {"location": "lab"}, "b": {"location": "roof"}}`)
+
+	settings := &Settings{KeyField: "id", File: path, OnMissing: "drop"}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+	a := act.(*Activity)
+
+	record, found := a.table.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, map[string]interface{}{"id": "a", "location": "lab"}, record)
+
+	//unchanged files aren't reloaded
+	reloaded, err := a.source.reload()
+	assert.Nil(t, err)
+	assert.False(t, reloaded)
+
+	writeTable(t, dir, "devices.json", `[{"id": "c", "location": "basement"}]`)
+	err = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.Nil(t, err)
+
+	reloaded, err = a.source.reload()
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, 1, a.table.Len())
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivKey, "a")
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+}
+
+func TestEnrichChannel(t *testing.T) {
+
+	_, err := channels.New("enrich-test", 5)
+	assert.Nil(t, err)
+
+	settings := &Settings{KeyField: "id", Channel: "enrich-test", OnMissing: "error"}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+	a := act.(*Activity)
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivKey, 1)
+	_, err = act.Eval(tc)
+	assert.NotNil(t, err)
+
+	upsert := a.upsert(tc.Logger())
+	upsert(map[string]interface{}{"id": 1, "location": "lab"})
+	upsert(`{"id": 1, "location": "roof"}`)
+
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "roof", tc.GetOutput(ovRecord).(map[string]interface{})["location"])
+
+	//the channel must exist
+	_, err = New(test.NewActivityInitContext(&Settings{KeyField: "id", Channel: "missing"}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestTable_Replace(t *testing.T) {
+
+	table := NewTable("id")
+
+	err := table.Replace([]map[string]interface{}{{"id": "a", "location": "lab"}, {"id": "b", "location": "roof"}})
+	assert.Nil(t, err)
+	err = table.Upsert(map[string]interface{}{"id": "a", "location": "basement"})
+	assert.Nil(t, err)
+
+	//upserted records are kept when the records are replaced
+	err = table.Replace([]map[string]interface{}{{"id": "a", "location": "lab"}, {"id": "c", "location": "yard"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, table.Len())
+
+	record, found := table.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, "basement", record["location"])
+
+	//the record is a copy
+	record["location"] = "changed"
+	record, _ = table.Get("a")
+	assert.Equal(t, "basement", record["location"])
+
+	_, found = table.Get("b")
+	assert.False(t, found)
+}
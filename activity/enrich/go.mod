@@ -0,0 +1,8 @@
+module github.com/project-flogo/stream/activity/enrich
+
+require (
+	github.com/project-flogo/core v0.10.1
+	github.com/stretchr/testify v1.4.0
+)
+
+go 1.12
@@ -0,0 +1,289 @@
+package enrich
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// Table is a reference table of records by key, it is safe for concurrent use
+type Table struct {
+	keyField string
+
+	mutex   sync.RWMutex
+	records map[string]map[string]interface{}
+
+	// upserts are the records that were upserted, they are kept when the records are replaced
+	upserts map[string]map[string]interface{}
+}
+
+// NewTable creates an empty table whose records are keyed by the key field
+func NewTable(keyField string) *Table {
+	return &Table{keyField: keyField, records: make(map[string]map[string]interface{}),
+		upserts: make(map[string]map[string]interface{})}
+}
+
+// Get returns a copy of the record with the key
+func (t *Table) Get(key string) (map[string]interface{}, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	record, found := t.records[key]
+	if !found {
+		return nil, false
+	}
+
+	c := make(map[string]interface{}, len(record))
+	for name, value := range record {
+		c[name] = value
+	}
+
+	return c, true
+}
+
+// Len returns the number of records in the table
+func (t *Table) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return len(t.records)
+}
+
+// Upsert inserts or replaces the record, the record is keyed by its key field
+func (t *Table) Upsert(record map[string]interface{}) error {
+
+	key, err := t.key(record)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	t.records[key] = record
+	t.upserts[key] = record
+	t.mutex.Unlock()
+
+	return nil
+}
+
+// Replace replaces all the records of the table, the upserted records are kept and replace the
+// records with the same key
+func (t *Table) Replace(records []map[string]interface{}) error {
+
+	byKey := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		key, err := t.key(record)
+		if err != nil {
+			return err
+		}
+		byKey[key] = record
+	}
+
+	t.mutex.Lock()
+	for key, record := range t.upserts {
+		byKey[key] = record
+	}
+	t.records = byKey
+	t.mutex.Unlock()
+
+	return nil
+}
+
+func (t *Table) key(record map[string]interface{}) (string, error) {
+
+	value, ok := record[t.keyField]
+	if !ok || value == nil {
+		return "", fmt.Errorf("record has no key field '%s'", t.keyField)
+	}
+
+	return coerce.ToString(value)
+}
+
+// fileSource loads the records of a table from a file and reloads them when the file changes
+type fileSource struct {
+	path   string
+	format string
+	table  *Table
+
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+}
+
+func newFileSource(path, format string, table *Table) (*fileSource, error) {
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	if format != formatCSV && format != formatJSON {
+		return nil, fmt.Errorf("unsupported table format: '%s'", format)
+	}
+
+	return &fileSource{path: path, format: format, table: table}, nil
+}
+
+// reload loads the file if it has changed since it was last loaded, returns true if it was loaded
+func (s *fileSource) reload() (bool, error) {
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return false, nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var records []map[string]interface{}
+	if s.format == formatCSV {
+		records, err = readCSV(f, s.table.keyField)
+	} else {
+		records, err = readJSON(f, s.table.keyField)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to read table '%s': %s", s.path, err.Error())
+	}
+
+	err = s.table.Replace(records)
+	if err != nil {
+		return false, fmt.Errorf("unable to load table '%s': %s", s.path, err.Error())
+	}
+
+	s.modTime, s.size = info.ModTime(), info.Size()
+
+	return true, nil
+}
+
+// watch reloads the file whenever it changes, the file is checked at the interval
+func (s *fileSource) watch(interval time.Duration, onError func(err error)) {
+
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				_, err := s.reload()
+				if err != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *fileSource) close() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// readCSV reads the records of a CSV file whose first row is the header, numeric values other
+// than the key are converted to numbers
+func readCSV(r io.Reader, keyField string) ([]map[string]interface{}, error) {
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			if i >= len(row) {
+				break
+			}
+			if column == keyField {
+				record[column] = row[i]
+			} else if num, err := strconv.ParseFloat(row[i], 64); err == nil {
+				record[column] = num
+			} else {
+				record[column] = row[i]
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// readJSON reads the records of a JSON file, either an array of records or an object of records by key,
+// in which case the key is added to records that don't contain the key field
+func readJSON(r io.Reader, keyField string) ([]map[string]interface{}, error) {
+
+	var content interface{}
+	err := json.NewDecoder(r).Decode(&content)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+
+	switch t := content.(type) {
+	case []interface{}:
+		for _, v := range t {
+			record, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("table record must be an object")
+			}
+			records = append(records, record)
+		}
+	case map[string]interface{}:
+		for key, v := range t {
+			record, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("table record must be an object")
+			}
+			if _, exists := record[keyField]; !exists {
+				record[keyField] = key
+			}
+			records = append(records, record)
+		}
+	default:
+		return nil, fmt.Errorf("table must be an array or an object")
+	}
+
+	return records, nil
+}
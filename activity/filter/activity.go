@@ -2,21 +2,43 @@ package filter
 
 import (
 	"fmt"
+	"regexp"
+	"sync"
 
 	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
+	_ "github.com/project-flogo/core/data/expression/script"
+	"github.com/project-flogo/core/data/mapper"
 	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/data/resolve"
 )
 
 const (
+	sdState = "state"
+
 	ivValue    = "value"
 	ovFiltered = "filtered"
 	ovValue    = "value"
+	ovPrevious = "previous"
 )
 
 //we can generate json from this! - we could also create a "validate-able" object from this
 type Settings struct {
-	Type              string `md:"type,allowed(non-zero)"`
+	Type              string `md:"type,allowed(non-zero,expression,range,regex,non-null,non-empty,equals,not-equals,dedupe,change)"`
 	ProceedOnlyOnEmit bool
+	Expression        string      `md:"expression"`
+	Field             string      `md:"field"`
+	Min               interface{} `md:"min"`
+	Max               interface{} `md:"max"`
+	Pattern           string      `md:"pattern"`
+	Value             interface{} `md:"value"`
+	Invert            bool        `md:"invert"`
+	Horizon           int         `md:"horizon"`
+	HorizonCount      int         `md:"horizonCount"`
+	MaxKeys           int         `md:"maxKeys"`
+	KeyField          string      `md:"keyField"`
+	Deadband          float64     `md:"deadband"`
+	DeadbandType      string      `md:"deadbandType"`
 }
 
 type Input struct {
@@ -26,6 +48,7 @@ type Input struct {
 type Output struct {
 	Filtered bool        `md:"filtered"`
 	Value    interface{} `md:"value"`
+	Previous interface{} `md:"previous"`
 }
 
 func init() {
@@ -41,12 +64,11 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 		return nil, err
 	}
 
-	act := &Activity{}
+	act := &Activity{invert: s.Invert}
 
-	if s.Type == "non-zero" {
-		act.filter = &NonZeroFilter{}
-	} else {
-		return nil, fmt.Errorf("unsupported filter: '%s'", s.Type)
+	act.filter, err = newFilter(ctx, s)
+	if err != nil {
+		return nil, err
 	}
 
 	act.proceedOnlyOnEmit = s.ProceedOnlyOnEmit
@@ -54,10 +76,83 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 	return act, nil
 }
 
+func newFilter(ctx activity.InitContext, s *Settings) (Filter, error) {
+
+	switch s.Type {
+	case "non-zero":
+		return &NonZeroFilter{}, nil
+	case "expression":
+		if s.Expression == "" {
+			return nil, fmt.Errorf("expression not specified for expression filter")
+		}
+		mf := ctx.MapperFactory()
+		if mf == nil {
+			mf = mapper.NewFactory(resolve.GetBasicResolver())
+		}
+		return NewExpressionFilter(mf, s.Expression)
+	case "dedupe":
+		var mf mapper.Factory
+		if s.Expression != "" {
+			mf = ctx.MapperFactory()
+			if mf == nil {
+				mf = mapper.NewFactory(resolve.GetBasicResolver())
+			}
+		}
+		return NewDedupeFilter(mf, s.Expression, s.Field, s.Horizon, s.HorizonCount, s.MaxKeys)
+	case "change":
+		return NewChangeFilter(s.Field, s.KeyField, s.Deadband, s.DeadbandType, s.MaxKeys)
+	case "range":
+		f := &RangeFilter{field: s.Field}
+		var err error
+		if f.min, err = toBound(s.Min); err != nil {
+			return nil, err
+		}
+		if f.max, err = toBound(s.Max); err != nil {
+			return nil, err
+		}
+		if f.min == nil && f.max == nil {
+			return nil, fmt.Errorf("min or max must be specified for range filter")
+		}
+		return f, nil
+	case "regex":
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex filter pattern: %s", err.Error())
+		}
+		return &RegexFilter{field: s.Field, re: re}, nil
+	case "non-null":
+		return &NonNullFilter{field: s.Field}, nil
+	case "non-empty":
+		return &NonNullFilter{field: s.Field, nonEmpty: true}, nil
+	case "equals":
+		return &EqualsFilter{field: s.Field, value: s.Value}, nil
+	case "not-equals":
+		return &EqualsFilter{field: s.Field, value: s.Value, notEquals: true}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported filter: '%s'", s.Type)
+}
+
+func toBound(val interface{}) (*float64, error) {
+
+	if val == nil || val == "" {
+		return nil, nil
+	}
+
+	bound, err := coerce.ToFloat64(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range filter bound: %v", val)
+	}
+
+	return &bound, nil
+}
+
 // Activity is an Activity that is used to Filter a message to the console
 type Activity struct {
 	filter            Filter
 	proceedOnlyOnEmit bool
+	invert            bool
+	mutex             sync.RWMutex
 }
 
 // Metadata returns the activity's metadata
@@ -73,7 +168,28 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 
 	in := ctx.GetInput(ivValue)
 
-	filteredOut := filter.FilterOut(in)
+	var filteredOut bool
+	if cf, ok := filter.(*ChangeFilter); ok {
+		var previous interface{}
+		filteredOut, previous, err = cf.FilterOutChange(a.getState(ctx, cf), in)
+		if err != nil {
+			return false, err
+		}
+		err = ctx.SetOutput(ovPrevious, previous)
+	} else if sf, ok := filter.(StatefulFilter); ok {
+		filteredOut, err = sf.FilterOutWithState(a.getState(ctx, sf), in)
+	} else if cf, ok := filter.(CheckedFilter); ok {
+		filteredOut, err = cf.FilterOutChecked(in)
+	} else {
+		filteredOut = filter.FilterOut(in)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if a.invert {
+		filteredOut = !filteredOut
+	}
 
 	done = !(proceedOnlyOnEmit && filteredOut)
 
@@ -89,6 +205,38 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	return done, nil
 }
 
+// getState gets the state of the filter from the shared temp data, creating it if necessary
+func (a *Activity) getState(ctx activity.Context, sf StatefulFilter) interface{} {
+
+	sharedData := ctx.GetSharedTempData()
+
+	a.mutex.RLock()
+	state, defined := sharedData[sdState]
+	a.mutex.RUnlock()
+
+	if !defined {
+		a.mutex.Lock()
+		state, defined = sharedData[sdState]
+		if !defined {
+			state = sf.NewState()
+			sharedData[sdState] = state
+		}
+		a.mutex.Unlock()
+	}
+
+	return state
+}
+
+// Filter decides if a value is filtered out
 type Filter interface {
 	FilterOut(val interface{}) bool
 }
+
+// CheckedFilter is a Filter that can fail to decide, such as when its expression can't be evaluated,
+// the activity fails with the error instead of using FilterOut
+type CheckedFilter interface {
+	Filter
+
+	// FilterOutChecked decides if a value is filtered out, an error is returned if it can't be decided
+	FilterOutChecked(val interface{}) (bool, error)
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/data/resolve"
 	"github.com/project-flogo/core/support/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -81,3 +83,245 @@ func TestPOOEFalse(t *testing.T) {
 	assert.True(t, filtered)
 	assert.Equal(t, 0, value)
 }
+
+func TestExpressionFilter(t *testing.T) {
+
+	settings := &Settings{Type: "expression", Expression: `=$.value.temp > 80 && $.value.status == "ok"`, ProceedOnlyOnEmit: true}
+	iCtx := test.NewActivityInitContext(settings, mapper.NewFactory(resolve.GetBasicResolver()))
+
+	act, err := New(iCtx)
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	tc.SetInput(ivValue, map[string]interface{}{"temp": 90, "status": "ok"})
+	done, err := act.Eval(tc)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.False(t, tc.GetOutput(ovFiltered).(bool))
+
+	tc.SetInput(ivValue, map[string]interface{}{"temp": 90, "status": "error"})
+	done, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.True(t, tc.GetOutput(ovFiltered).(bool))
+
+	//the expression must be valid
+	_, err = New(test.NewActivityInitContext(&Settings{Type: "expression", Expression: "=$.value >"}, mapper.NewFactory(resolve.GetBasicResolver())))
+	assert.NotNil(t, err)
+}
+
+func TestFilters(t *testing.T) {
+
+	tests := []struct {
+		settings *Settings
+		value    interface{}
+		filtered bool
+	}{
+		{&Settings{Type: "range", Min: 10, Max: 20}, 15, false},
+		{&Settings{Type: "range", Min: 10, Max: 20}, 20.5, true},
+		{&Settings{Type: "range", Min: 10}, "25", false},
+		{&Settings{Type: "range", Max: 20, Field: "a.b"}, map[string]interface{}{"a": map[string]interface{}{"b": 21}}, true},
+		{&Settings{Type: "range", Min: 10}, "abc", true},
+		{&Settings{Type: "regex", Pattern: "^dev-[0-9]+$", Field: "id"}, map[string]interface{}{"id": "dev-12"}, false},
+		{&Settings{Type: "regex", Pattern: "^dev-[0-9]+$", Field: "id"}, map[string]interface{}{"id": "host-12"}, true},
+		{&Settings{Type: "regex", Pattern: "^dev-[0-9]+$", Field: "id"}, map[string]interface{}{}, true},
+		{&Settings{Type: "non-null", Field: "id"}, map[string]interface{}{"id": ""}, false},
+		{&Settings{Type: "non-null", Field: "id"}, map[string]interface{}{"id": nil}, true},
+		{&Settings{Type: "non-empty", Field: "id"}, map[string]interface{}{"id": ""}, true},
+		{&Settings{Type: "non-empty"}, []interface{}{1}, false},
+		{&Settings{Type: "equals", Field: "status", Value: "ok"}, map[string]interface{}{"status": "ok"}, false},
+		{&Settings{Type: "equals", Value: 1}, 1.0, false},
+		{&Settings{Type: "not-equals", Field: "status", Value: "ok"}, map[string]interface{}{"status": "ok"}, true},
+		{&Settings{Type: "not-equals", Field: "status", Value: "ok"}, map[string]interface{}{"status": "error"}, false},
+		{&Settings{Type: "non-zero", Invert: true}, 0, false},
+	}
+
+	for _, tt := range tests {
+		act, err := New(test.NewActivityInitContext(tt.settings, nil))
+		assert.Nil(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+		tc.SetInput(ivValue, tt.value)
+		_, err = act.Eval(tc)
+		assert.Nil(t, err)
+
+		assert.Equal(t, tt.filtered, tc.GetOutput(ovFiltered), "%s %v", tt.settings.Type, tt.value)
+	}
+
+	//a range requires a bound
+	_, err := New(test.NewActivityInitContext(&Settings{Type: "range"}, nil))
+	assert.NotNil(t, err)
+
+	//a regex must be valid
+	_, err = New(test.NewActivityInitContext(&Settings{Type: "regex", Pattern: "("}, nil))
+	assert.NotNil(t, err)
+
+	//values that aren't numeric are passed by the non-zero filter
+	act, err := New(test.NewActivityInitContext(&Settings{Type: "non-zero"}, nil))
+	assert.Nil(t, err)
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivValue, map[string]interface{}{})
+	_, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, tc.GetOutput(ovFiltered).(bool))
+}
+
+func TestDedupeFilter(t *testing.T) {
+
+	settings := &Settings{Type: "dedupe", Field: "id, source", HorizonCount: 3}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	values := []map[string]interface{}{
+		{"id": 1, "source": "mqtt"},
+		{"id": 1, "source": "http"},
+		{"id": 1, "source": "mqtt"},
+		{"id": 2, "source": "mqtt"},
+		{"id": 3, "source": "mqtt"},
+		{"id": 1, "source": "mqtt"},
+	}
+	expected := []bool{false, false, true, false, false, false}
+
+	for i, value := range values {
+		tc.SetInput(ivValue, value)
+		_, err = act.Eval(tc)
+		assert.Nil(t, err)
+		assert.Equal(t, expected[i], tc.GetOutput(ovFiltered), "value %d", i)
+	}
+
+	//each context has its own seen keys
+	tc = test.NewActivityContext(act.Metadata())
+	tc.SetInput(ivValue, values[0])
+	_, err = act.Eval(tc)
+	assert.Nil(t, err)
+	assert.False(t, tc.GetOutput(ovFiltered).(bool))
+
+	//a horizon is required
+	_, err = New(test.NewActivityInitContext(&Settings{Type: "dedupe"}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestDedupeFilter_Horizon(t *testing.T) {
+
+	f, err := NewDedupeFilter(mapper.NewFactory(resolve.GetBasicResolver()), "$.value.id", "", 1000, 0, 2)
+	assert.Nil(t, err)
+
+	now := int64(0)
+	f.now = func() int64 { return now }
+
+	filterOut := func(id int) bool {
+		out, err := f.FilterOutChecked(map[string]interface{}{"id": id, "time": now})
+		assert.Nil(t, err)
+		return out
+	}
+
+	assert.False(t, filterOut(1))
+	now = 500
+	assert.True(t, filterOut(1))
+	now = 1000
+	assert.False(t, filterOut(1))
+
+	//the oldest keys are evicted once maxKeys is exceeded
+	assert.False(t, filterOut(2))
+	assert.False(t, filterOut(3))
+	assert.Len(t, f.state.keys, 2)
+	assert.False(t, filterOut(1))
+	assert.True(t, filterOut(3))
+}
+
+func TestDedupeFilter_KeyTypes(t *testing.T) {
+
+	f, err := NewDedupeFilter(mapper.NewFactory(resolve.GetBasicResolver()), "", "", 0, 10, 10)
+	assert.Nil(t, err)
+
+	//strings don't collide with the values they're the JSON of
+	for _, value := range []interface{}{"1", 1, "[1,2]", []interface{}{1, 2}} {
+		out, err := f.FilterOutChecked(value)
+		assert.Nil(t, err)
+		assert.False(t, out, "%v", value)
+	}
+
+	out, err := f.FilterOutChecked("[1,2]")
+	assert.Nil(t, err)
+	assert.True(t, out)
+}
+
+func TestChangeFilter(t *testing.T) {
+
+	settings := &Settings{Type: "change", Field: "temp", KeyField: "device", Deadband: 0.5}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+
+	reading := func(device string, temp float64) map[string]interface{} {
+		return map[string]interface{}{"device": device, "temp": temp}
+	}
+
+	tests := []struct {
+		value    map[string]interface{}
+		filtered bool
+		previous interface{}
+	}{
+		{reading("a", 20), false, nil},
+		{reading("b", 30), false, nil},
+		{reading("a", 20.3), true, reading("a", 20)},
+		{reading("a", 20.6), false, reading("a", 20)},
+		{reading("b", 30), true, reading("b", 30)},
+		{reading("a", 20.2), true, reading("a", 20.6)},
+	}
+
+	for i, tt := range tests {
+		tc.SetInput(ivValue, tt.value)
+		_, err = act.Eval(tc)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.filtered, tc.GetOutput(ovFiltered), "value %d", i)
+		assert.Equal(t, tt.previous, tc.GetOutput(ovPrevious), "value %d", i)
+	}
+}
+
+func TestChangeFilter_Changed(t *testing.T) {
+
+	f, err := NewChangeFilter("", "", 10, "percent", 0)
+	assert.Nil(t, err)
+
+	assert.False(t, f.changed(100, 109.5))
+	assert.True(t, f.changed(100, 89))
+	assert.True(t, f.changed(0, 0.1))
+	assert.False(t, f.changed("on", "on"))
+	assert.True(t, f.changed("on", "off"))
+	assert.True(t, f.changed(nil, 1))
+
+	f, err = NewChangeFilter("", "", 0, "", 0)
+	assert.Nil(t, err)
+	assert.True(t, f.changed(1, 1.5))
+	assert.False(t, f.changed(1, 1.0))
+
+	_, err = NewChangeFilter("", "", 0, "relative", 0)
+	assert.NotNil(t, err)
+}
+
+func TestChangeFilter_MaxKeys(t *testing.T) {
+
+	f, err := NewChangeFilter("temp", "device", 0, "", 2)
+	assert.Nil(t, err)
+
+	filterOut := func(device string, temp int) bool {
+		out, err := f.FilterOutChecked(map[string]interface{}{"device": device, "temp": temp})
+		assert.Nil(t, err)
+		return out
+	}
+
+	assert.False(t, filterOut("a", 1))
+	assert.False(t, filterOut("b", 1))
+	assert.True(t, filterOut("a", 1))
+
+	//b is the least recently seen key, it is forgotten once maxKeys is exceeded
+	assert.False(t, filterOut("c", 1))
+	assert.Len(t, f.state.values, 2)
+	assert.True(t, filterOut("a", 1))
+	assert.False(t, filterOut("b", 1))
+}
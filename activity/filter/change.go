@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+const (
+	deadbandAbsolute = "absolute"
+	deadbandPercent  = "percent"
+)
+
+// ChangeFilter filters out values whose field didn't change compared to the previous value with
+// the same key. Numeric values are only considered changed if they differ by more than the deadband.
+// The previous value is the last value that passed, so slow drifts are eventually reported.
+type ChangeFilter struct {
+	field     string
+	keyFields []string
+	deadband  float64
+	percent   bool
+	maxKeys   int
+
+	state *PreviousValues
+}
+
+// NewChangeFilter creates a change filter for the field, the previous values are kept per key,
+// the key being the values of the comma separated key fields, for at most maxKeys keys
+func NewChangeFilter(field, keyFields string, deadband float64, deadbandType string, maxKeys int) (*ChangeFilter, error) {
+
+	if deadband < 0 {
+		return nil, fmt.Errorf("change filter deadband must be positive")
+	}
+
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	f := &ChangeFilter{field: field, deadband: deadband, maxKeys: maxKeys}
+
+	switch deadbandType {
+	case "", deadbandAbsolute:
+	case deadbandPercent:
+		f.percent = true
+	default:
+		return nil, fmt.Errorf("unsupported deadband type: '%s'", deadbandType)
+	}
+
+	if keyFields != "" {
+		for _, keyField := range strings.Split(keyFields, ",") {
+			f.keyFields = append(f.keyFields, strings.TrimSpace(keyField))
+		}
+	}
+
+	f.state = f.NewState().(*PreviousValues)
+
+	return f, nil
+}
+
+// FilterOut filters out unchanged values using state shared by all users of the filter, values
+// whose key can't be determined aren't filtered out
+func (f *ChangeFilter) FilterOut(val interface{}) bool {
+	filteredOut, _ := f.FilterOutChecked(val)
+	return filteredOut
+}
+
+// FilterOutChecked implements CheckedFilter.FilterOutChecked
+func (f *ChangeFilter) FilterOutChecked(val interface{}) (bool, error) {
+	return f.FilterOutWithState(f.state, val)
+}
+
+// NewState implements StatefulFilter.NewState
+func (f *ChangeFilter) NewState() interface{} {
+	return &PreviousValues{values: make(map[string]*list.Element), lru: list.New()}
+}
+
+// FilterOutWithState implements StatefulFilter.FilterOutWithState
+func (f *ChangeFilter) FilterOutWithState(state interface{}, val interface{}) (bool, error) {
+	filteredOut, _, err := f.FilterOutChange(state, val)
+	return filteredOut, err
+}
+
+// FilterOutChange decides if the value is filtered out, it also returns the previous value with
+// the same key, nil if there is none
+func (f *ChangeFilter) FilterOutChange(state interface{}, val interface{}) (filteredOut bool, previous interface{}, err error) {
+
+	key, err := f.key(val)
+	if err != nil {
+		return false, nil, err
+	}
+
+	pv := state.(*PreviousValues)
+
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	entry, seen := pv.values[key]
+	if seen {
+		pv.lru.MoveToFront(entry)
+
+		previous = entry.Value.(*previousValue).value
+		if !f.changed(fieldValue(previous, f.field), fieldValue(val, f.field)) {
+			return true, previous, nil
+		}
+
+		entry.Value.(*previousValue).value = val
+		return false, previous, nil
+	}
+
+	pv.values[key] = pv.lru.PushFront(&previousValue{key: key, value: val})
+
+	for len(pv.values) > f.maxKeys {
+		oldest := pv.lru.Remove(pv.lru.Back()).(*previousValue)
+		delete(pv.values, oldest.key)
+	}
+
+	return false, nil, nil
+}
+
+// changed indicates if the current value of the field changed compared to the previous value
+func (f *ChangeFilter) changed(previous, current interface{}) bool {
+
+	prevNum, prevErr := toNumber(previous)
+	curNum, curErr := toNumber(current)
+
+	if prevErr != nil || curErr != nil {
+		return !equals(current, previous)
+	}
+
+	delta := math.Abs(curNum - prevNum)
+
+	if f.percent {
+		if prevNum == 0 {
+			return delta != 0
+		}
+		return delta/math.Abs(prevNum)*100 > f.deadband
+	}
+
+	if f.deadband == 0 {
+		return delta != 0
+	}
+
+	return delta > f.deadband
+}
+
+// key returns the key of the value
+func (f *ChangeFilter) key(val interface{}) (string, error) {
+
+	switch len(f.keyFields) {
+	case 0:
+		return "", nil
+	case 1:
+		return coerce.ToString(fieldValue(val, f.keyFields[0]))
+	}
+
+	var b strings.Builder
+	for i, keyField := range f.keyFields {
+		s, err := coerce.ToString(fieldValue(val, keyField))
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+// toNumber converts numbers to float64, values of other types, including numeric strings, aren't converted
+func toNumber(val interface{}) (float64, error) {
+
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return coerce.ToFloat64(val)
+	}
+
+	return 0, fmt.Errorf("not a number: %T", val)
+}
+
+// PreviousValues are the previous values of a change filter by key, the least recently seen key is
+// forgotten once there are too many keys
+type PreviousValues struct {
+	mutex  sync.Mutex
+	values map[string]*list.Element
+	lru    *list.List
+}
+
+type previousValue struct {
+	key   string
+	value interface{}
+}
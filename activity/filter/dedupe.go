@@ -0,0 +1,211 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/mapper"
+)
+
+const defaultMaxKeys = 10000
+
+// StatefulFilter is a Filter whose decision depends on the values it filtered before, such as
+// the keys seen by a dedupe filter, the state is created and passed in by the caller
+type StatefulFilter interface {
+	Filter
+
+	// NewState creates the initial state of the filter
+	NewState() interface{}
+
+	// FilterOutWithState decides if a value is filtered out using and updating the state
+	FilterOutWithState(state interface{}, val interface{}) (bool, error)
+}
+
+// DedupeFilter filters out values whose key was already seen within the horizon, the key is
+// the result of the key expression or the values of the key fields
+type DedupeFilter struct {
+	keyExpr   mapper.Mapper
+	keyFields []string
+
+	// horizon in millis, 0 if the horizon isn't time based
+	horizon int64
+	// horizonCount in number of values, 0 if the horizon isn't count based
+	horizonCount int64
+	maxKeys      int
+
+	now   func() int64
+	state *SeenKeys
+}
+
+// NewDedupeFilter creates a dedupe filter, the key is the result of the expression if specified,
+// otherwise the values of the comma separated fields, or the value itself if there are no fields.
+func NewDedupeFilter(mf mapper.Factory, expression, fields string, horizon, horizonCount, maxKeys int) (*DedupeFilter, error) {
+
+	if horizon < 0 || horizonCount < 0 {
+		return nil, fmt.Errorf("dedupe filter horizon must be positive")
+	}
+	if horizon == 0 && horizonCount == 0 {
+		return nil, fmt.Errorf("horizon or horizonCount must be specified for dedupe filter")
+	}
+
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	f := &DedupeFilter{horizon: int64(horizon), horizonCount: int64(horizonCount), maxKeys: maxKeys, now: nowMillis}
+
+	if expression != "" {
+		m, err := newExpression(mf, expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dedupe key expression: %s", err.Error())
+		}
+		f.keyExpr = m
+	} else if fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			f.keyFields = append(f.keyFields, strings.TrimSpace(field))
+		}
+	}
+
+	f.state = f.NewState().(*SeenKeys)
+
+	return f, nil
+}
+
+// FilterOut filters out duplicates using state shared by all users of the filter, values
+// whose key can't be determined aren't filtered out
+func (f *DedupeFilter) FilterOut(val interface{}) bool {
+	filteredOut, _ := f.FilterOutChecked(val)
+	return filteredOut
+}
+
+// FilterOutChecked implements CheckedFilter.FilterOutChecked
+func (f *DedupeFilter) FilterOutChecked(val interface{}) (bool, error) {
+	return f.FilterOutWithState(f.state, val)
+}
+
+// NewState implements StatefulFilter.NewState
+func (f *DedupeFilter) NewState() interface{} {
+	return &SeenKeys{keys: make(map[string]struct{})}
+}
+
+// FilterOutWithState implements StatefulFilter.FilterOutWithState
+func (f *DedupeFilter) FilterOutWithState(state interface{}, val interface{}) (bool, error) {
+
+	key, err := f.key(val)
+	if err != nil {
+		return false, err
+	}
+
+	seen := state.(*SeenKeys)
+
+	seen.mutex.Lock()
+	defer seen.mutex.Unlock()
+
+	now := f.now()
+	seen.seq++
+
+	seen.expire(f.expired(now, seen.seq))
+
+	if _, dup := seen.keys[key]; dup {
+		return true, nil
+	}
+
+	seen.add(key, now)
+
+	for len(seen.keys) > f.maxKeys {
+		seen.evict()
+	}
+
+	return false, nil
+}
+
+// expired returns a function that indicates if a key that was seen is past the horizon
+func (f *DedupeFilter) expired(now, seq int64) func(e *seenKey) bool {
+	return func(e *seenKey) bool {
+		return (f.horizon > 0 && now-e.time >= f.horizon) || (f.horizonCount > 0 && seq-e.seq > f.horizonCount)
+	}
+}
+
+// key returns the dedupe key of the value
+func (f *DedupeFilter) key(val interface{}) (string, error) {
+
+	var key interface{}
+
+	switch {
+	case f.keyExpr != nil:
+		var err error
+		key, err = evalExpression(f.keyExpr, val)
+		if err != nil {
+			return "", err
+		}
+	case len(f.keyFields) == 1:
+		key = fieldValue(val, f.keyFields[0])
+	case len(f.keyFields) > 1:
+		values := make([]interface{}, len(f.keyFields))
+		for i, field := range f.keyFields {
+			values[i] = fieldValue(val, field)
+		}
+		key = values
+	default:
+		key = val
+	}
+
+	//every key is marshalled, so a string doesn't collide with the value it's the JSON of, and maps are
+	//marshalled with sorted keys, so equal values have the same key
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("unable to create dedupe key: %s", err.Error())
+	}
+
+	return string(b), nil
+}
+
+// SeenKeys are the keys seen by a dedupe filter, in the order they were first seen
+type SeenKeys struct {
+	mutex sync.Mutex
+	keys  map[string]struct{}
+	order []*seenKey
+	head  int
+	seq   int64
+}
+
+type seenKey struct {
+	key  string
+	time int64
+	seq  int64
+}
+
+func (s *SeenKeys) add(key string, now int64) {
+	s.keys[key] = struct{}{}
+	s.order = append(s.order, &seenKey{key: key, time: now, seq: s.seq})
+}
+
+// expire removes the keys that are past the horizon, since keys aren't refreshed when seen
+// again they expire in the order they were added
+func (s *SeenKeys) expire(expired func(e *seenKey) bool) {
+	for s.head < len(s.order) && expired(s.order[s.head]) {
+		s.evict()
+	}
+}
+
+// evict removes the oldest key
+func (s *SeenKeys) evict() {
+
+	delete(s.keys, s.order[s.head].key)
+	s.order[s.head] = nil
+	s.head++
+
+	//reclaim the evicted part of the order once it is the larger part
+	if s.head > len(s.order)/2 {
+		n := copy(s.order, s.order[s.head:])
+		s.order = s.order[:n]
+		s.head = 0
+	}
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
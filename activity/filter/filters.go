@@ -1,5 +1,16 @@
 package filter
 
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/mapper"
+)
+
 type NonZeroFilter struct {
 }
 
@@ -7,6 +18,7 @@ func (*NonZeroFilter) FilterOut(val interface{}) bool {
 	return !IsNonZero(val)
 }
 
+// IsNonZero indicates if the value is non-zero, values that aren't numeric are considered non-zero
 func IsNonZero(val interface{}) bool {
 
 	switch t := val.(type) {
@@ -30,6 +42,194 @@ func IsNonZero(val interface{}) bool {
 		return false
 	}
 
-	//todo handle unsupported type
-	return true
+	f, err := coerce.ToFloat64(val)
+	if err != nil {
+		return true
+	}
+
+	return f != 0.0
+}
+
+// ExpressionFilter filters out values for which the predicate expression is false, the value
+// is available to the expression as $.value
+type ExpressionFilter struct {
+	mapper mapper.Mapper
+}
+
+// NewExpressionFilter creates a filter for the boolean expression using the mapper factory
+func NewExpressionFilter(mf mapper.Factory, expression string) (*ExpressionFilter, error) {
+
+	m, err := newExpression(mf, expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %s", err.Error())
+	}
+
+	return &ExpressionFilter{mapper: m}, nil
+}
+
+// FilterOut filters out values for which the expression is false, values the expression can't be
+// evaluated for aren't filtered out
+func (f *ExpressionFilter) FilterOut(val interface{}) bool {
+	filteredOut, _ := f.FilterOutChecked(val)
+	return filteredOut
+}
+
+// FilterOutChecked implements CheckedFilter.FilterOutChecked
+func (f *ExpressionFilter) FilterOutChecked(val interface{}) (bool, error) {
+
+	result, err := evalExpression(f.mapper, val)
+	if err != nil {
+		return false, err
+	}
+
+	pass, err := coerce.ToBool(result)
+	if err != nil {
+		return false, fmt.Errorf("filter expression must be a boolean: %s", err.Error())
+	}
+
+	return !pass, nil
+}
+
+// newExpression creates a mapper that evaluates the expression
+func newExpression(mf mapper.Factory, expression string) (mapper.Mapper, error) {
+
+	if !strings.HasPrefix(expression, "=") {
+		expression = "=" + expression
+	}
+
+	return mf.NewMapper(map[string]interface{}{"expr": expression})
+}
+
+// evalExpression evaluates the expression of the mapper, the value is available as $.value
+func evalExpression(m mapper.Mapper, val interface{}) (interface{}, error) {
+
+	results, err := m.Apply(data.NewSimpleScope(map[string]interface{}{ivValue: val}, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return results["expr"], nil
+}
+
+// RangeFilter filters out values of the field that aren't within the range, the bounds are inclusive
+// and either can be omitted. Values that aren't numeric are filtered out.
+type RangeFilter struct {
+	field    string
+	min, max *float64
+}
+
+func (f *RangeFilter) FilterOut(val interface{}) bool {
+
+	num, err := coerce.ToFloat64(fieldValue(val, f.field))
+	if err != nil {
+		return true
+	}
+
+	if (f.min != nil && num < *f.min) || (f.max != nil && num > *f.max) {
+		return true
+	}
+
+	return false
+}
+
+// RegexFilter filters out values of the field that don't match the pattern
+type RegexFilter struct {
+	field string
+	re    *regexp.Regexp
+}
+
+func (f *RegexFilter) FilterOut(val interface{}) bool {
+
+	val = fieldValue(val, f.field)
+	if val == nil {
+		return true
+	}
+
+	str, err := coerce.ToString(val)
+	if err != nil {
+		return true
+	}
+
+	return !f.re.MatchString(str)
+}
+
+// NonNullFilter filters out null values of the field, if nonEmpty is set empty strings, arrays
+// and objects are also filtered out
+type NonNullFilter struct {
+	field    string
+	nonEmpty bool
+}
+
+func (f *NonNullFilter) FilterOut(val interface{}) bool {
+
+	val = fieldValue(val, f.field)
+	if val == nil {
+		return true
+	}
+
+	if f.nonEmpty {
+		switch rv := reflect.ValueOf(val); rv.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			return rv.Len() == 0
+		}
+	}
+
+	return false
+}
+
+// EqualsFilter filters out values of the field that aren't equal to the value, or that are
+// equal if notEquals is set
+type EqualsFilter struct {
+	field     string
+	value     interface{}
+	notEquals bool
+}
+
+func (f *EqualsFilter) FilterOut(val interface{}) bool {
+	return equals(fieldValue(val, f.field), f.value) == f.notEquals
+}
+
+// equals compares the value to the expected value, the value is coerced to the type of the expected value
+func equals(val, expected interface{}) bool {
+
+	if val == nil || expected == nil {
+		return val == expected
+	}
+
+	switch t := expected.(type) {
+	case string:
+		str, err := coerce.ToString(val)
+		return err == nil && str == t
+	case bool:
+		b, err := coerce.ToBool(val)
+		return err == nil && b == t
+	case int, int32, int64, float32, float64:
+		num, err := coerce.ToFloat64(val)
+		if err != nil {
+			return false
+		}
+		expectedNum, _ := coerce.ToFloat64(t)
+		return num == expectedNum
+	}
+
+	return reflect.DeepEqual(val, expected)
+}
+
+// fieldValue returns the value of the field, nested fields are separated by dots, if
+// the field is empty the value itself is returned
+func fieldValue(val interface{}, field string) interface{} {
+
+	if field == "" {
+		return val
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		val = obj[key]
+	}
+
+	return val
 }
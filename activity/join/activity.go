@@ -0,0 +1,309 @@
+package join
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/stream/pipeline/support"
+)
+
+const (
+	ivSide  = "side"
+	ivKey   = "key"
+	ivValue = "value"
+
+	ovJoined  = "joined"
+	ovKey     = "key"
+	ovLeft    = "left"
+	ovRight   = "right"
+	ovExpired = "expired"
+
+	sdState = "state"
+
+	joinInner     = "inner"
+	joinLeftOuter = "leftOuter"
+	joinTimeout   = "timeout"
+)
+
+type Settings struct {
+	Window            int    `md:"window,required"`
+	Type              string `md:"type"`
+	Left              string `md:"left"`
+	Right             string `md:"right"`
+	Resolution        int    `md:"resolution"`
+	ProceedOnlyOnEmit bool   `md:"proceedOnlyOnEmit"`
+}
+
+type Input struct {
+	Side  string      `md:"side"`
+	Key   interface{} `md:"key"`
+	Value interface{} `md:"value"`
+}
+
+type Output struct {
+	Joined  bool          `md:"joined"`
+	Key     string        `md:"key"`
+	Left    interface{}   `md:"left"`
+	Right   interface{}   `md:"right"`
+	Expired []interface{} `md:"expired"`
+}
+
+func init() {
+	_ = activity.Register(&Activity{}, New)
+}
+
+var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
+
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	s := &Settings{ProceedOnlyOnEmit: true}
+	err := metadata.MapToStruct(ctx.Settings(), s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Window <= 0 {
+		return nil, fmt.Errorf("join window must be positive")
+	}
+
+	switch s.Type {
+	case "":
+		s.Type = joinInner
+	case joinInner, joinLeftOuter, joinTimeout:
+	default:
+		return nil, fmt.Errorf("unsupported join type: '%s'", s.Type)
+	}
+
+	if s.Left == "" {
+		s.Left = ovLeft
+	}
+	if s.Right == "" {
+		s.Right = ovRight
+	}
+	if s.Left == s.Right {
+		return nil, fmt.Errorf("join sides must have different names")
+	}
+
+	if s.Resolution <= 0 {
+		//expire events within a tenth of the window
+		s.Resolution = s.Window / 10
+		if s.Resolution == 0 {
+			s.Resolution = 1
+		}
+	}
+
+	act := &Activity{settings: s, now: nowMillis}
+
+	return act, nil
+}
+
+// Activity is an Activity that is used to join the events of two streams
+type Activity struct {
+	settings *Settings
+	mutex    sync.RWMutex
+
+	now func() int64
+}
+
+// Metadata returns the activity's metadata
+func (a *Activity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements api.Activity.Eval - Joins the Message
+func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
+
+	side := ctx.GetInput(ivSide)
+	isLeft := side == a.settings.Left
+	if !isLeft && side != a.settings.Right {
+		return false, fmt.Errorf("unknown join side '%v', expected '%s' or '%s'", side, a.settings.Left, a.settings.Right)
+	}
+
+	key, err := coerce.ToString(ctx.GetInput(ivKey))
+	if err != nil {
+		return false, fmt.Errorf("invalid join key: %s", err.Error())
+	}
+
+	in := ctx.GetInput(ivValue)
+	state := a.getState(ctx)
+	now := a.now()
+
+	state.mutex.Lock()
+
+	expired := a.expire(state, now)
+
+	var match *entry
+	if isLeft {
+		match = state.right.take(key)
+		if match == nil {
+			state.left.add(key, in, now)
+		}
+	} else {
+		match = state.left.take(key)
+		if match == nil {
+			state.right.add(key, in, now)
+		}
+	}
+
+	if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported && !state.timerSet {
+		err = a.setTimer(timerSupport, state, now)
+	}
+
+	state.mutex.Unlock()
+
+	if err != nil {
+		return false, err
+	}
+
+	if match == nil {
+		err = a.setOutputs(ctx, false, "", nil, nil, expired)
+		if err != nil {
+			return false, err
+		}
+
+		return len(expired) > 0 || !a.settings.ProceedOnlyOnEmit, nil
+	}
+
+	left, right := in, match.value
+	if !isLeft {
+		left, right = right, left
+	}
+
+	err = a.setOutputs(ctx, true, key, left, right, expired)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// expireTimer is the timer callback that emits the expired events
+func (a *Activity) expireTimer(ctx activity.Context) bool {
+
+	state := a.getState(ctx)
+	now := a.now()
+
+	state.mutex.Lock()
+	expired := a.expire(state, now)
+
+	state.timerSet = false
+	if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported {
+		err := a.setTimer(timerSupport, state, now)
+		if err != nil {
+			ctx.Logger().Errorf("unable to set join expiry timer: %v", err)
+		}
+	}
+	state.mutex.Unlock()
+
+	if len(expired) == 0 {
+		return false
+	}
+
+	err := a.setOutputs(ctx, false, "", nil, nil, expired)
+	if err != nil {
+		ctx.Logger().Errorf("unable to set expired join events: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// setTimer sets the timer that expires the buffered events once the oldest of them expires, or after the
+// resolution if that's later, there is no timer while no events are buffered. The state must be locked.
+func (a *Activity) setTimer(timerSupport support.TimerSupport, state *joinState, now int64) error {
+
+	oldest, buffered := state.oldest()
+	if !buffered {
+		return nil
+	}
+
+	delay := oldest + int64(a.settings.Window) - now
+	if delay < int64(a.settings.Resolution) {
+		delay = int64(a.settings.Resolution)
+	}
+
+	//a timer that already fired is still held until it is replaced
+	timerSupport.CancelTimer(false)
+	err := timerSupport.CreateTimer(time.Duration(delay)*time.Millisecond, a.expireTimer, false)
+	if err != nil {
+		return err
+	}
+
+	state.timerSet = true
+	return nil
+}
+
+// expire removes the events that are older than the window, returns the expired events that
+// should be emitted by the type of join, each with its key and the value of its side
+func (a *Activity) expire(state *joinState, now int64) []interface{} {
+
+	until := now - int64(a.settings.Window)
+
+	left := state.left.expire(until)
+	right := state.right.expire(until)
+
+	if a.settings.Type == joinInner {
+		return nil
+	}
+
+	var expired []interface{}
+
+	for _, e := range left {
+		expired = append(expired, map[string]interface{}{ovKey: e.key, ovLeft: e.value, ovRight: nil})
+	}
+
+	if a.settings.Type == joinTimeout {
+		for _, e := range right {
+			expired = append(expired, map[string]interface{}{ovKey: e.key, ovLeft: nil, ovRight: e.value})
+		}
+	}
+
+	return expired
+}
+
+func (a *Activity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
+	return true, nil
+}
+
+func (a *Activity) setOutputs(ctx activity.Context, joined bool, key string, left, right interface{}, expired []interface{}) error {
+
+	outputs := map[string]interface{}{ovJoined: joined, ovKey: key, ovLeft: left, ovRight: right, ovExpired: expired}
+
+	for name, value := range outputs {
+		err := ctx.SetOutput(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getState gets the buffered events from the shared temp data, creating them if necessary
+func (a *Activity) getState(ctx activity.Context) *joinState {
+
+	sharedData := ctx.GetSharedTempData()
+
+	a.mutex.RLock()
+	state, defined := sharedData[sdState]
+	a.mutex.RUnlock()
+
+	if !defined {
+		a.mutex.Lock()
+		state, defined = sharedData[sdState]
+		if !defined {
+			state = newJoinState()
+			sharedData[sdState] = state
+		}
+		a.mutex.Unlock()
+	}
+
+	return state.(*joinState)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
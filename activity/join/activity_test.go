@@ -0,0 +1,155 @@
+package join
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+
+	ref := activity.GetRef(&Activity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+type joinEvent struct {
+	at    int64
+	side  string
+	key   string
+	value interface{}
+}
+
+// evalEvents evaluates the events and returns the outputs of the events that proceeded
+func evalEvents(t *testing.T, act *Activity, tc *test.TestActivityContext, events []joinEvent) []map[string]interface{} {
+
+	now := int64(0)
+	act.now = func() int64 { return now }
+
+	var outputs []map[string]interface{}
+	for _, e := range events {
+		now = e.at
+		tc.SetInput(ivSide, e.side)
+		tc.SetInput(ivKey, e.key)
+		tc.SetInput(ivValue, e.value)
+
+		done, err := act.Eval(tc)
+		assert.Nil(t, err)
+
+		if done {
+			outputs = append(outputs, map[string]interface{}{ovJoined: tc.GetOutput(ovJoined), ovKey: tc.GetOutput(ovKey),
+				ovLeft: tc.GetOutput(ovLeft), ovRight: tc.GetOutput(ovRight), ovExpired: tc.GetOutput(ovExpired)})
+		}
+	}
+
+	return outputs
+}
+
+func TestInnerJoin(t *testing.T) {
+
+	settings := &Settings{Window: 1000, Left: "order", Right: "payment", ProceedOnlyOnEmit: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	outputs := evalEvents(t, act.(*Activity), tc, []joinEvent{
+		{0, "order", "1", "o1"},
+		{100, "order", "2", "o2"},
+		{200, "payment", "2", "p2"},
+		{300, "payment", "2", "p2-again"},
+		{1500, "payment", "1", "p1"},
+	})
+
+	//order 1 expired before its payment, which is buffered in turn, while the second payment of order 2 expired
+	assert.Equal(t, []map[string]interface{}{
+		{ovJoined: true, ovKey: "2", ovLeft: "o2", ovRight: "p2", ovExpired: []interface{}(nil)},
+	}, outputs)
+
+	state := act.(*Activity).getState(tc)
+	assert.Equal(t, 0, state.left.size())
+	assert.Equal(t, 1, state.right.size())
+
+	//unknown sides aren't joined
+	tc.SetInput(ivSide, "refund")
+	_, err = act.Eval(tc)
+	assert.NotNil(t, err)
+}
+
+func TestOuterJoins(t *testing.T) {
+
+	events := []joinEvent{
+		{0, "left", "1", "l1"},
+		{100, "right", "2", "r2"},
+		{200, "left", "3", "l3"},
+		{300, "right", "3", "r3"},
+		{1200, "left", "4", "l4"},
+	}
+
+	act, err := New(test.NewActivityInitContext(&Settings{Window: 1000, Type: "leftOuter", ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	outputs := evalEvents(t, act.(*Activity), test.NewActivityContext(act.Metadata()), events)
+	assert.Len(t, outputs, 2)
+	assert.Equal(t, []interface{}{map[string]interface{}{ovKey: "1", ovLeft: "l1", ovRight: nil}}, outputs[1][ovExpired])
+
+	act, err = New(test.NewActivityInitContext(&Settings{Window: 1000, Type: "timeout", ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	outputs = evalEvents(t, act.(*Activity), test.NewActivityContext(act.Metadata()), events)
+	assert.Len(t, outputs, 2)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{ovKey: "1", ovLeft: "l1", ovRight: nil},
+		map[string]interface{}{ovKey: "2", ovLeft: nil, ovRight: "r2"},
+	}, outputs[1][ovExpired])
+
+	_, err = New(test.NewActivityInitContext(&Settings{Window: 1000, Type: "cross"}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestExpireTimer(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Window: 1000, Type: "timeout", ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+	a := act.(*Activity)
+
+	tc := test.NewActivityContext(act.Metadata())
+	outputs := evalEvents(t, a, tc, []joinEvent{{0, "left", "1", "l1"}})
+	assert.Empty(t, outputs)
+
+	a.now = func() int64 { return 500 }
+	assert.False(t, a.expireTimer(tc))
+
+	a.now = func() int64 { return 1000 }
+	assert.True(t, a.expireTimer(tc))
+	assert.Equal(t, []interface{}{map[string]interface{}{ovKey: "1", ovLeft: "l1", ovRight: nil}}, tc.GetOutput(ovExpired))
+	assert.False(t, tc.GetOutput(ovJoined).(bool))
+}
+
+func TestBuffer_Take(t *testing.T) {
+
+	b := newBuffer()
+	b.add("1", "a", 0)
+	b.add("2", "b", 10)
+	b.add("1", "c", 20)
+
+	//joined events are no longer buffered
+	assert.Equal(t, "a", b.take("1").value)
+
+	oldest, buffered := b.oldest()
+	assert.True(t, buffered)
+	assert.Equal(t, int64(10), oldest)
+	assert.Equal(t, 2, b.size())
+
+	expired := b.expire(10)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "b", expired[0].value)
+
+	assert.Equal(t, "c", b.take("1").value)
+	assert.Nil(t, b.take("1"))
+
+	_, buffered = b.oldest()
+	assert.False(t, buffered)
+}
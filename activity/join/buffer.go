@@ -0,0 +1,125 @@
+package join
+
+import (
+	"sync"
+)
+
+// entry is a buffered event waiting to be joined
+type entry struct {
+	key   string
+	value interface{}
+	time  int64
+}
+
+// buffer holds the events of one side of the join, by key and in the order they were received
+type buffer struct {
+	byKey map[string][]*entry
+	order []*entry
+}
+
+func newBuffer() *buffer {
+	return &buffer{byKey: make(map[string][]*entry)}
+}
+
+func (b *buffer) add(key string, value interface{}, now int64) {
+	e := &entry{key: key, value: value, time: now}
+	b.byKey[key] = append(b.byKey[key], e)
+	b.order = append(b.order, e)
+}
+
+// take removes and returns the oldest event with the key, nil if there is none
+func (b *buffer) take(key string) *entry {
+
+	entries := b.byKey[key]
+	if len(entries) == 0 {
+		return nil
+	}
+
+	e := entries[0]
+	b.removeOldest(key)
+
+	for i, o := range b.order {
+		if o == e {
+			copy(b.order[i:], b.order[i+1:])
+			b.order[len(b.order)-1] = nil
+			b.order = b.order[:len(b.order)-1]
+			break
+		}
+	}
+
+	return e
+}
+
+// expire removes and returns the events received up to the time
+func (b *buffer) expire(until int64) []*entry {
+
+	i := 0
+	for ; i < len(b.order) && b.order[i].time <= until; i++ {
+		//events expire in order, so the event is the oldest of its key
+		b.removeOldest(b.order[i].key)
+	}
+
+	if i == 0 {
+		return nil
+	}
+
+	expired := append([]*entry(nil), b.order[:i]...)
+	for j := 0; j < i; j++ {
+		b.order[j] = nil
+	}
+	b.order = b.order[i:]
+
+	return expired
+}
+
+// removeOldest removes the oldest event with the key from the events by key
+func (b *buffer) removeOldest(key string) {
+
+	entries := b.byKey[key]
+	if len(entries) == 1 {
+		delete(b.byKey, key)
+	} else {
+		entries[0] = nil
+		b.byKey[key] = entries[1:]
+	}
+}
+
+// oldest returns the time of the oldest buffered event, false if there is none
+func (b *buffer) oldest() (int64, bool) {
+	if len(b.order) == 0 {
+		return 0, false
+	}
+	return b.order[0].time, true
+}
+
+// size returns the number of events waiting to be joined
+func (b *buffer) size() int {
+	return len(b.order)
+}
+
+// joinState holds the buffered events of both sides of the join
+type joinState struct {
+	mutex sync.Mutex
+	left  *buffer
+	right *buffer
+
+	// timerSet is set while a timer is set to expire the buffered events
+	timerSet bool
+}
+
+func newJoinState() *joinState {
+	return &joinState{left: newBuffer(), right: newBuffer()}
+}
+
+// oldest returns the time of the oldest buffered event of either side, false if there is none
+func (s *joinState) oldest() (int64, bool) {
+
+	left, hasLeft := s.left.oldest()
+	right, hasRight := s.right.oldest()
+
+	if !hasLeft || (hasRight && right < left) {
+		return right, hasRight
+	}
+
+	return left, true
+}
@@ -0,0 +1,199 @@
+package pattern
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
+	_ "github.com/project-flogo/core/data/expression/script"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/data/resolve"
+	"github.com/project-flogo/stream/pipeline/support"
+)
+
+const (
+	ivKey   = "key"
+	ivValue = "value"
+
+	ovMatched = "matched"
+	ovKey     = "key"
+	ovEvents  = "events"
+
+	sdState = "state"
+
+	defaultMaxPartial = 100
+)
+
+type Settings struct {
+	Steps             []interface{} `md:"steps,required"`
+	Within            int           `md:"within,required"`
+	Strict            bool          `md:"strict"`
+	MaxPartialMatches int           `md:"maxPartialMatches"`
+	Resolution        int           `md:"resolution"`
+	ProceedOnlyOnEmit bool          `md:"proceedOnlyOnEmit"`
+}
+
+type Input struct {
+	Key   interface{} `md:"key"`
+	Value interface{} `md:"value"`
+}
+
+type Output struct {
+	Matched bool                   `md:"matched"`
+	Key     string                 `md:"key"`
+	Events  map[string]interface{} `md:"events"`
+}
+
+func init() {
+	_ = activity.Register(&Activity{}, New)
+}
+
+var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
+
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	s := &Settings{ProceedOnlyOnEmit: true}
+	err := metadata.MapToStruct(ctx.Settings(), s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Within <= 0 {
+		return nil, fmt.Errorf("pattern time limit must be positive")
+	}
+
+	if s.MaxPartialMatches <= 0 {
+		s.MaxPartialMatches = defaultMaxPartial
+	}
+
+	if s.Resolution <= 0 {
+		//expire partial matches within a tenth of the time limit
+		s.Resolution = s.Within / 10
+		if s.Resolution == 0 {
+			s.Resolution = 1
+		}
+	}
+
+	mf := ctx.MapperFactory()
+	if mf == nil {
+		mf = mapper.NewFactory(resolve.GetBasicResolver())
+	}
+
+	pattern, err := NewPattern(mf, s.Steps, int64(s.Within), s.Strict, s.MaxPartialMatches)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &Activity{pattern: pattern, resolution: s.Resolution, proceedOnlyOnEmit: s.ProceedOnlyOnEmit, now: nowMillis}
+
+	return act, nil
+}
+
+// Activity is an Activity that is used to detect a pattern of events
+type Activity struct {
+	pattern           *Pattern
+	resolution        int
+	proceedOnlyOnEmit bool
+	mutex             sync.RWMutex
+
+	now func() int64
+}
+
+// Metadata returns the activity's metadata
+func (a *Activity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements api.Activity.Eval - Matches the Message against the pattern
+func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
+
+	key, err := coerce.ToString(ctx.GetInput(ivKey))
+	if err != nil {
+		return false, fmt.Errorf("invalid pattern key: %s", err.Error())
+	}
+
+	in := ctx.GetInput(ivValue)
+	runs := a.getState(ctx)
+
+	runs.mutex.Lock()
+	events, err := a.pattern.Match(runs, key, in, a.now())
+	runs.mutex.Unlock()
+
+	if err != nil {
+		return false, err
+	}
+
+	if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported {
+		if !timerSupport.HasTimer(true) {
+			err = timerSupport.CreateTimer(time.Duration(a.resolution)*time.Millisecond, a.expireTimer, true)
+			if err != nil {
+				return false, err
+			}
+		}
+		timerSupport.UpdateTimer(true)
+	}
+
+	matched := events != nil
+	if !matched {
+		key = ""
+	}
+
+	err = ctx.SetOutput(ovMatched, matched)
+	if err != nil {
+		return false, err
+	}
+	err = ctx.SetOutput(ovKey, key)
+	if err != nil {
+		return false, err
+	}
+	err = ctx.SetOutput(ovEvents, events)
+	if err != nil {
+		return false, err
+	}
+
+	return matched || !a.proceedOnlyOnEmit, nil
+}
+
+// expireTimer is the timer callback that discards the partial matches that expired
+func (a *Activity) expireTimer(ctx activity.Context) bool {
+
+	runs := a.getState(ctx)
+
+	runs.mutex.Lock()
+	a.pattern.Expire(runs, a.now())
+	runs.mutex.Unlock()
+
+	return false
+}
+
+func (a *Activity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
+	return true, nil
+}
+
+// getState gets the partial matches from the shared temp data, creating them if necessary
+func (a *Activity) getState(ctx activity.Context) *Runs {
+
+	sharedData := ctx.GetSharedTempData()
+
+	a.mutex.RLock()
+	state, defined := sharedData[sdState]
+	a.mutex.RUnlock()
+
+	if !defined {
+		a.mutex.Lock()
+		state, defined = sharedData[sdState]
+		if !defined {
+			state = NewRuns()
+			sharedData[sdState] = state
+		}
+		a.mutex.Unlock()
+	}
+
+	return state.(*Runs)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,145 @@
+package pattern
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+
+	ref := activity.GetRef(&Activity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+var steps = []interface{}{
+	map[string]interface{}{"name": "hot", "condition": "$.value.temp > 80"},
+	map[string]interface{}{"name": "drop", "condition": "$.value.pressure < $.hot.pressure * 0.9"},
+}
+
+type patternEvent struct {
+	at    int64
+	key   string
+	value map[string]interface{}
+}
+
+// evalEvents evaluates the events and returns the bound events of the matches
+func evalEvents(t *testing.T, act *Activity, tc *test.TestActivityContext, events []patternEvent) []interface{} {
+
+	now := int64(0)
+	act.now = func() int64 { return now }
+
+	var matches []interface{}
+	for _, e := range events {
+		now = e.at
+		tc.SetInput(ivKey, e.key)
+		tc.SetInput(ivValue, e.value)
+
+		done, err := act.Eval(tc)
+		assert.Nil(t, err)
+
+		if done {
+			assert.True(t, tc.GetOutput(ovMatched).(bool))
+			assert.Equal(t, e.key, tc.GetOutput(ovKey))
+			matches = append(matches, tc.GetOutput(ovEvents))
+		}
+	}
+
+	return matches
+}
+
+func reading(temp, pressure float64) map[string]interface{} {
+	return map[string]interface{}{"temp": temp, "pressure": pressure}
+}
+
+func TestPattern(t *testing.T) {
+
+	settings := &Settings{Steps: steps, Within: 30000, ProceedOnlyOnEmit: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	matches := evalEvents(t, act.(*Activity), tc, []patternEvent{
+		{0, "a", reading(85, 100)},
+		{1000, "b", reading(70, 100)},
+		{2000, "a", reading(75, 95)},
+		{3000, "b", reading(60, 50)},
+		{4000, "a", reading(75, 85)},
+		{5000, "a", reading(75, 80)},
+	})
+
+	//only device a matches, its partial matches are discarded once matched
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"hot": reading(85, 100), "drop": reading(75, 85)},
+	}, matches)
+	assert.Equal(t, 0, act.(*Activity).getState(tc).Len())
+}
+
+func TestPattern_Within(t *testing.T) {
+
+	settings := &Settings{Steps: steps, Within: 30000, ProceedOnlyOnEmit: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+	a := act.(*Activity)
+
+	tc := test.NewActivityContext(act.Metadata())
+	matches := evalEvents(t, a, tc, []patternEvent{
+		{0, "a", reading(85, 100)},
+		{10000, "a", reading(90, 120)},
+		{35000, "a", reading(70, 95)},
+	})
+
+	//the first partial match expired, the drop is relative to the second one
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"hot": reading(90, 120), "drop": reading(70, 95)},
+	}, matches)
+
+	evalEvents(t, a, tc, []patternEvent{{40000, "a", reading(85, 100)}})
+	assert.Equal(t, 1, a.getState(tc).Len())
+
+	a.now = func() int64 { return 70000 }
+	assert.False(t, a.expireTimer(tc))
+	assert.Equal(t, 0, a.getState(tc).Len())
+}
+
+func TestPattern_Strict(t *testing.T) {
+
+	settings := &Settings{Steps: steps, Within: 30000, Strict: true, ProceedOnlyOnEmit: true}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	matches := evalEvents(t, act.(*Activity), tc, []patternEvent{
+		{0, "a", reading(85, 100)},
+		{1000, "a", reading(75, 95)},
+		{2000, "a", reading(75, 80)},
+		{3000, "a", reading(85, 90)},
+		{4000, "a", reading(75, 80)},
+	})
+
+	//the pressure must drop with the event following the high temperature
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"hot": reading(85, 90), "drop": reading(75, 80)},
+	}, matches)
+}
+
+func TestPattern_Invalid(t *testing.T) {
+
+	_, err := New(test.NewActivityInitContext(&Settings{Steps: steps}, nil))
+	assert.NotNil(t, err)
+
+	_, err = New(test.NewActivityInitContext(&Settings{Within: 1000}, nil))
+	assert.NotNil(t, err)
+
+	duplicate := []interface{}{steps[0], steps[0]}
+	_, err = New(test.NewActivityInitContext(&Settings{Steps: duplicate, Within: 1000}, nil))
+	assert.NotNil(t, err)
+
+	missing := []interface{}{map[string]interface{}{"name": "hot"}}
+	_, err = New(test.NewActivityInitContext(&Settings{Steps: missing, Within: 1000}, nil))
+	assert.NotNil(t, err)
+}
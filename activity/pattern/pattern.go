@@ -0,0 +1,195 @@
+package pattern
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/mapper"
+)
+
+// Step is a step of a pattern, an event matches the step when its condition is true
+type Step struct {
+	name      string
+	condition mapper.Mapper
+}
+
+// Pattern is a sequence of steps that must be matched in order within a time limit
+type Pattern struct {
+	steps      []*Step
+	within     int64
+	strict     bool
+	maxPartial int
+}
+
+// NewPattern creates a pattern from the step configs, each with a name and a boolean condition
+func NewPattern(mf mapper.Factory, steps []interface{}, within int64, strict bool, maxPartial int) (*Pattern, error) {
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pattern must have at least one step")
+	}
+
+	p := &Pattern{within: within, strict: strict, maxPartial: maxPartial}
+	names := make(map[string]bool)
+
+	for i, config := range steps {
+		sc, err := coerce.ToObject(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern step %d: %s", i, err.Error())
+		}
+
+		name, _ := coerce.ToString(sc["name"])
+		if name == "" {
+			return nil, fmt.Errorf("name not specified for pattern step %d", i)
+		}
+		if name == ivValue || names[name] {
+			return nil, fmt.Errorf("pattern step name '%s' must be unique and not '%s'", name, ivValue)
+		}
+		names[name] = true
+
+		condition, _ := coerce.ToString(sc["condition"])
+		if condition == "" {
+			return nil, fmt.Errorf("condition not specified for pattern step '%s'", name)
+		}
+		if !strings.HasPrefix(condition, "=") {
+			condition = "=" + condition
+		}
+
+		m, err := mf.NewMapper(map[string]interface{}{"condition": condition})
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition for pattern step '%s': %s", name, err.Error())
+		}
+
+		p.steps = append(p.steps, &Step{name: name, condition: m})
+	}
+
+	return p, nil
+}
+
+// matches indicates if the event matches the step, the event is available to the condition as $.value
+// and the events bound to the previous steps by the names of their steps
+func (s *Step) matches(val interface{}, events map[string]interface{}) (bool, error) {
+
+	values := make(map[string]interface{}, len(events)+1)
+	for name, event := range events {
+		values[name] = event
+	}
+	values[ivValue] = val
+
+	results, err := s.condition.Apply(data.NewSimpleScope(values, nil))
+	if err != nil {
+		return false, err
+	}
+
+	matched, err := coerce.ToBool(results["condition"])
+	if err != nil {
+		return false, fmt.Errorf("condition of pattern step '%s' must be a boolean: %s", s.name, err.Error())
+	}
+
+	return matched, nil
+}
+
+// run is a partial match of the pattern
+type run struct {
+	start  int64
+	next   int
+	events map[string]interface{}
+}
+
+// Runs holds the partial matches of a pattern by key, oldest first
+type Runs struct {
+	mutex sync.Mutex
+	byKey map[string][]*run
+}
+
+func NewRuns() *Runs {
+	return &Runs{byKey: make(map[string][]*run)}
+}
+
+// Len returns the number of partial matches
+func (r *Runs) Len() int {
+	n := 0
+	for _, runs := range r.byKey {
+		n += len(runs)
+	}
+	return n
+}
+
+// Match advances the partial matches of the key with the event, returns the events bound to the steps
+// of the oldest match completed by the event, nil if the event didn't complete a match. Once the pattern
+// is matched the partial matches of the key are discarded, so matches don't overlap.
+func (p *Pattern) Match(runs *Runs, key string, val interface{}, now int64) (map[string]interface{}, error) {
+
+	var active []*run
+	for _, r := range runs.byKey[key] {
+		if r.start <= now-p.within {
+			continue
+		}
+
+		matched, err := p.steps[r.next].matches(val, r.events)
+		if err != nil {
+			return nil, err
+		}
+
+		if matched {
+			r.events[p.steps[r.next].name] = val
+			r.next++
+			if r.next == len(p.steps) {
+				delete(runs.byKey, key)
+				return r.events, nil
+			}
+		} else if p.strict {
+			continue
+		}
+
+		active = append(active, r)
+	}
+
+	matched, err := p.steps[0].matches(val, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if matched {
+		r := &run{start: now, next: 1, events: map[string]interface{}{p.steps[0].name: val}}
+		if len(p.steps) == 1 {
+			delete(runs.byKey, key)
+			return r.events, nil
+		}
+
+		active = append(active, r)
+		if p.maxPartial > 0 && len(active) > p.maxPartial {
+			active = active[len(active)-p.maxPartial:]
+		}
+	}
+
+	if len(active) == 0 {
+		delete(runs.byKey, key)
+	} else {
+		runs.byKey[key] = active
+	}
+
+	return nil, nil
+}
+
+// Expire removes the partial matches that didn't complete within the time limit
+func (p *Pattern) Expire(runs *Runs, now int64) {
+
+	until := now - p.within
+
+	for key, keyRuns := range runs.byKey {
+		//runs are started in order, so the runs that expired are the oldest
+		i := 0
+		for i < len(keyRuns) && keyRuns[i].start <= until {
+			i++
+		}
+
+		if i == len(keyRuns) {
+			delete(runs.byKey, key)
+		} else if i > 0 {
+			runs.byKey[key] = keyRuns[i:]
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package throttle
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/stream/pipeline/support"
+)
+
+const (
+	ivValue = "value"
+
+	ovThrottled = "throttled"
+	ovValue     = "value"
+
+	sdState = "state"
+)
+
+type Settings struct {
+	Mode              string  `md:"mode,required,allowed(tokenBucket,first,last,nth,sample)"`
+	Rate              int     `md:"rate"`
+	Interval          int     `md:"interval"`
+	Every             int     `md:"every"`
+	Probability       float64 `md:"probability"`
+	ProceedOnlyOnEmit bool    `md:"proceedOnlyOnEmit"`
+}
+
+type Input struct {
+	Value interface{} `md:"value"`
+}
+
+type Output struct {
+	Throttled bool        `md:"throttled"`
+	Value     interface{} `md:"value"`
+}
+
+func init() {
+	_ = activity.Register(&Activity{}, New)
+}
+
+var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
+
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	s := &Settings{ProceedOnlyOnEmit: true}
+	err := metadata.MapToStruct(ctx.Settings(), s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	throttler, err := newThrottler(s)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &Activity{throttler: throttler, interval: s.Interval, proceedOnlyOnEmit: s.ProceedOnlyOnEmit, now: nowMillis}
+
+	return act, nil
+}
+
+func newThrottler(s *Settings) (Throttler, error) {
+
+	switch s.Mode {
+	case "tokenBucket", "first", "last":
+		if s.Interval <= 0 {
+			return nil, fmt.Errorf("interval must be specified for throttle mode '%s'", s.Mode)
+		}
+	}
+
+	switch s.Mode {
+	case "tokenBucket":
+		if s.Rate <= 0 {
+			return nil, fmt.Errorf("rate must be specified for throttle mode '%s'", s.Mode)
+		}
+		return &TokenBucket{rate: float64(s.Rate), interval: float64(s.Interval)}, nil
+	case "first":
+		return &FirstInInterval{interval: int64(s.Interval)}, nil
+	case "last":
+		return &Debounce{interval: int64(s.Interval)}, nil
+	case "nth":
+		if s.Every <= 0 {
+			return nil, fmt.Errorf("every must be specified for throttle mode '%s'", s.Mode)
+		}
+		return &EveryNth{n: int64(s.Every)}, nil
+	case "sample":
+		//a probability of 0 would throttle every value, so it's taken as a missing probability
+		if s.Probability <= 0 {
+			return nil, fmt.Errorf("probability must be specified for throttle mode '%s'", s.Mode)
+		}
+		if s.Probability > 1 {
+			return nil, fmt.Errorf("sample probability must be between 0 and 1")
+		}
+		return &Sample{probability: s.Probability, random: rand.Float64}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported throttle mode: '%s'", s.Mode)
+}
+
+// Activity is an Activity that is used to throttle the messages of a pipeline
+type Activity struct {
+	throttler         Throttler
+	interval          int
+	proceedOnlyOnEmit bool
+	mutex             sync.RWMutex
+
+	now func() int64
+}
+
+// Metadata returns the activity's metadata
+func (a *Activity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements api.Activity.Eval - Throttles the Message
+func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
+
+	in := ctx.GetInput(ivValue)
+	state := a.getState(ctx)
+
+	if debounce, ok := a.throttler.(*Debounce); ok {
+		return a.evalDebounce(ctx, debounce, state, in)
+	}
+
+	throttled := a.throttler.Throttle(state, a.now())
+
+	return a.setOutputs(ctx, throttled, in)
+}
+
+// evalDebounce holds the value until no values were received for the interval, in a stream the held
+// value is passed by a timer, otherwise it is passed by the first value received after the interval
+func (a *Activity) evalDebounce(ctx activity.Context, debounce *Debounce, state interface{}, in interface{}) (done bool, err error) {
+
+	previous, passed := debounce.Hold(state, in, a.now())
+
+	if timerSupport, timerSupported := support.GetTimerSupport(ctx); timerSupported {
+		//restart the timer, the held value is passed once it expires
+		timerSupport.CancelTimer(false)
+		err = timerSupport.CreateTimer(time.Duration(a.interval)*time.Millisecond, a.release, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if passed {
+		return a.setOutputs(ctx, false, previous)
+	}
+
+	return a.setOutputs(ctx, true, in)
+}
+
+// release is the timer callback that passes the held value
+func (a *Activity) release(ctx activity.Context) bool {
+
+	val, held := a.throttler.(*Debounce).Release(a.getState(ctx))
+	if !held {
+		return false
+	}
+
+	_, err := a.setOutputs(ctx, false, val)
+	if err != nil {
+		ctx.Logger().Errorf("unable to set debounced value: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func (a *Activity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
+	return true, nil
+}
+
+func (a *Activity) setOutputs(ctx activity.Context, throttled bool, val interface{}) (done bool, err error) {
+
+	err = ctx.SetOutput(ovThrottled, throttled)
+	if err != nil {
+		return false, err
+	}
+	err = ctx.SetOutput(ovValue, val)
+	if err != nil {
+		return false, err
+	}
+
+	return !(a.proceedOnlyOnEmit && throttled), nil
+}
+
+// getState gets the state of the throttler from the shared temp data, creating it if necessary
+func (a *Activity) getState(ctx activity.Context) interface{} {
+
+	sharedData := ctx.GetSharedTempData()
+
+	a.mutex.RLock()
+	state, defined := sharedData[sdState]
+	a.mutex.RUnlock()
+
+	if !defined {
+		a.mutex.Lock()
+		state, defined = sharedData[sdState]
+		if !defined {
+			state = a.throttler.NewState()
+			sharedData[sdState] = state
+		}
+		a.mutex.Unlock()
+	}
+
+	return state
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
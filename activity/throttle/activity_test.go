@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/test"
+	"github.com/project-flogo/stream/pipeline/support"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+
+	ref := activity.GetRef(&Activity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// evalAt evaluates the values at the times and returns which values were throttled
+func evalAt(t *testing.T, act *Activity, tc activity.Context, times []int64) []bool {
+
+	now := int64(0)
+	act.now = func() int64 { return now }
+
+	throttled := make([]bool, len(times))
+	for i, at := range times {
+		now = at
+		tc.(*test.TestActivityContext).SetInput(ivValue, i)
+		done, err := act.Eval(tc)
+		assert.Nil(t, err)
+		throttled[i] = tc.(*test.TestActivityContext).GetOutput(ovThrottled).(bool)
+		assert.Equal(t, !throttled[i], done)
+	}
+
+	return throttled
+}
+
+func TestTokenBucket(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Mode: "tokenBucket", Rate: 2, Interval: 1000, ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	throttled := evalAt(t, act.(*Activity), tc, []int64{0, 10, 20, 400, 500, 510, 2000, 2000, 2000})
+	assert.Equal(t, []bool{false, false, true, true, false, true, false, false, true}, throttled)
+
+	//each context is throttled separately
+	tc = test.NewActivityContext(act.Metadata())
+	throttled = evalAt(t, act.(*Activity), tc, []int64{20})
+	assert.Equal(t, []bool{false}, throttled)
+}
+
+func TestFirstInInterval(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Mode: "first", Interval: 1000, ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	throttled := evalAt(t, act.(*Activity), tc, []int64{0, 500, 999, 1000, 1500, 2500})
+	assert.Equal(t, []bool{false, true, true, false, true, false}, throttled)
+}
+
+func TestEveryNth(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Mode: "nth", Every: 3, ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	throttled := evalAt(t, act.(*Activity), tc, []int64{0, 0, 0, 0, 0, 0})
+	assert.Equal(t, []bool{true, true, false, true, true, false}, throttled)
+}
+
+func TestSample(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Mode: "sample", Probability: 0.25, ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	randoms := []float64{0.1, 0.25, 0.9, 0.2}
+	act.(*Activity).throttler.(*Sample).random = func() float64 {
+		r := randoms[0]
+		randoms = randoms[1:]
+		return r
+	}
+
+	tc := test.NewActivityContext(act.Metadata())
+	throttled := evalAt(t, act.(*Activity), tc, []int64{0, 0, 0, 0})
+	assert.Equal(t, []bool{false, true, true, false}, throttled)
+
+	_, err = New(test.NewActivityInitContext(&Settings{Mode: "sample", Probability: 2}, nil))
+	assert.NotNil(t, err)
+
+	//the probability is required
+	_, err = New(test.NewActivityInitContext(&Settings{Mode: "sample"}, nil))
+	assert.NotNil(t, err)
+}
+
+func TestDebounce(t *testing.T) {
+
+	act, err := New(test.NewActivityInitContext(&Settings{Mode: "last", Interval: 1000, ProceedOnlyOnEmit: true}, nil))
+	assert.Nil(t, err)
+
+	//without timers the held value is passed by the first value after the interval
+	tc := test.NewActivityContext(act.Metadata())
+	throttled := evalAt(t, act.(*Activity), tc, []int64{0, 500, 1400, 2500})
+	assert.Equal(t, []bool{true, true, true, false}, throttled)
+	assert.Equal(t, 2, tc.GetOutput(ovValue))
+
+	//with timers the held value is passed when the timer expires
+	ttc := &timerContext{TestActivityContext: test.NewActivityContext(act.Metadata())}
+	throttled = evalAt(t, act.(*Activity), ttc.TestActivityContext, []int64{0})
+	assert.Equal(t, []bool{true}, throttled)
+
+	for i := 0; i < 3; i++ {
+		ttc.SetInput(ivValue, i)
+		done, err := act.Eval(ttc)
+		assert.Nil(t, err)
+		assert.False(t, done)
+	}
+
+	assert.Equal(t, time.Second, ttc.interval)
+	assert.Equal(t, 3, ttc.created)
+
+	assert.True(t, ttc.callback(ttc))
+	assert.Equal(t, false, ttc.GetOutput(ovThrottled))
+	assert.Equal(t, 2, ttc.GetOutput(ovValue))
+
+	//the value is only passed once
+	assert.False(t, ttc.callback(ttc))
+}
+
+// timerContext is a test context that supports a single non repeating timer
+type timerContext struct {
+	*test.TestActivityContext
+
+	interval time.Duration
+	callback support.TimerCallback
+	created  int
+}
+
+func (c *timerContext) HasTimer(repeating bool) bool {
+	return c.callback != nil
+}
+
+func (c *timerContext) CancelTimer(repeating bool) {
+	c.callback = nil
+}
+
+func (c *timerContext) UpdateTimer(repeating bool) {
+}
+
+func (c *timerContext) CreateTimer(interval time.Duration, callback support.TimerCallback, repeating bool) error {
+	c.interval, c.callback = interval, callback
+	c.created++
+	return nil
+}
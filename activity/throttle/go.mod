@@ -0,0 +1,9 @@
+module github.com/project-flogo/stream/activity/throttle
+
+require (
+	github.com/project-flogo/core v0.10.1
+	github.com/project-flogo/stream v0.3.0
+	github.com/stretchr/testify v1.4.0
+)
+
+go 1.12
@@ -0,0 +1,205 @@
+package throttle
+
+import (
+	"sync"
+)
+
+// Throttler decides which values are throttled, it holds no state itself, what it needs to remember
+// between values, such as the tokens of a bucket, is in the state it creates
+type Throttler interface {
+	// NewState creates the initial state of the throttler
+	NewState() interface{}
+
+	// Throttle indicates if a value received at the time, in millis, is throttled
+	Throttle(state interface{}, now int64) bool
+}
+
+// TokenBucket passes at most rate values per interval, it allows bursts of up to rate values
+type TokenBucket struct {
+	rate     float64
+	interval float64
+}
+
+type bucketState struct {
+	mutex  sync.Mutex
+	tokens float64
+	last   int64
+	init   bool
+}
+
+// NewState implements Throttler.NewState
+func (t *TokenBucket) NewState() interface{} {
+	return &bucketState{}
+}
+
+// Throttle implements Throttler.Throttle
+func (t *TokenBucket) Throttle(state interface{}, now int64) bool {
+
+	s := state.(*bucketState)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.init {
+		s.tokens = t.rate
+		s.init = true
+	} else if now > s.last {
+		//refill the bucket for the elapsed time
+		s.tokens += float64(now-s.last) * t.rate / t.interval
+		if s.tokens > t.rate {
+			s.tokens = t.rate
+		}
+	}
+
+	if now > s.last {
+		s.last = now
+	}
+
+	if s.tokens < 1 {
+		return true
+	}
+
+	s.tokens--
+	return false
+}
+
+// FirstInInterval passes the first value and throttles the values received within the interval after it
+type FirstInInterval struct {
+	interval int64
+}
+
+type firstState struct {
+	mutex  sync.Mutex
+	passed int64
+	init   bool
+}
+
+// NewState implements Throttler.NewState
+func (t *FirstInInterval) NewState() interface{} {
+	return &firstState{}
+}
+
+// Throttle implements Throttler.Throttle
+func (t *FirstInInterval) Throttle(state interface{}, now int64) bool {
+
+	s := state.(*firstState)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.init && now-s.passed < t.interval {
+		return true
+	}
+
+	s.passed = now
+	s.init = true
+
+	return false
+}
+
+// EveryNth passes every nth value
+type EveryNth struct {
+	n int64
+}
+
+type countState struct {
+	mutex sync.Mutex
+	count int64
+}
+
+// NewState implements Throttler.NewState
+func (t *EveryNth) NewState() interface{} {
+	return &countState{}
+}
+
+// Throttle implements Throttler.Throttle
+func (t *EveryNth) Throttle(state interface{}, now int64) bool {
+
+	s := state.(*countState)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.count++
+	if s.count < t.n {
+		return true
+	}
+
+	s.count = 0
+	return false
+}
+
+// Sample passes values at random with the probability
+type Sample struct {
+	probability float64
+	random      func() float64
+}
+
+// NewState implements Throttler.NewState
+func (t *Sample) NewState() interface{} {
+	return nil
+}
+
+// Throttle implements Throttler.Throttle
+func (t *Sample) Throttle(state interface{}, now int64) bool {
+	return t.random() >= t.probability
+}
+
+// Debounce passes the last value once no values were received for the interval, as a value is
+// only passed later it requires the activity to set a timer
+type Debounce struct {
+	interval int64
+}
+
+type debounceState struct {
+	mutex   sync.Mutex
+	pending interface{}
+	waiting bool
+	last    int64
+}
+
+// NewState implements Throttler.NewState
+func (t *Debounce) NewState() interface{} {
+	return &debounceState{}
+}
+
+// Throttle implements Throttler.Throttle, values are always throttled, they are passed by Hold or Release
+func (t *Debounce) Throttle(state interface{}, now int64) bool {
+	return true
+}
+
+// Hold holds the value until the interval passed, if the interval since the previously held value
+// already passed that value is returned so it can be passed
+func (t *Debounce) Hold(state interface{}, val interface{}, now int64) (previous interface{}, passed bool) {
+
+	s := state.(*debounceState)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.waiting && now-s.last >= t.interval {
+		previous, passed = s.pending, true
+	}
+
+	s.pending, s.waiting, s.last = val, true, now
+
+	return previous, passed
+}
+
+// Release returns the held value, false if there is none
+func (t *Debounce) Release(state interface{}) (interface{}, bool) {
+
+	s := state.(*debounceState)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.waiting {
+		return nil, false
+	}
+
+	val := s.pending
+	s.pending, s.waiting = nil, false
+
+	return val, true
+}
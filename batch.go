@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultBatchLinger = 100
+
+// batcher collects the events of each group into micro-batches, a batch is dispatched once it is full or
+// once its first event has waited for the linger time. The batches of a group are dispatched one at a time
+// in order, by the goroutine that flushed the first of them or, if async, by a goroutine of their own.
+type batcher struct {
+	size     int
+	linger   time.Duration
+	dispatch func(t *task)
+	async    bool
+
+	mutex   sync.Mutex
+	pending map[string]*pendingBatch
+	// ready are the flushed batches of each group waiting to be dispatched, a group
+	// is in ready while its batches are being dispatched
+	ready   map[string][]*task
+	stopped bool
+}
+
+type pendingBatch struct {
+	tasks []*task
+	timer *time.Timer
+}
+
+func newBatcher(size int, linger time.Duration, dispatch func(t *task), async bool) *batcher {
+	return &batcher{size: size, linger: linger, dispatch: dispatch, async: async,
+		pending: make(map[string]*pendingBatch), ready: make(map[string][]*task)}
+}
+
+// add adds the event of the task to the pending batch of its group
+func (b *batcher) add(t *task) error {
+
+	b.mutex.Lock()
+
+	if b.stopped {
+		b.mutex.Unlock()
+		return errPoolStopped
+	}
+
+	p, exists := b.pending[t.discriminator]
+	if !exists {
+		p = &pendingBatch{}
+		p.timer = time.AfterFunc(b.linger, func() { b.expire(t.discriminator, p) })
+		b.pending[t.discriminator] = p
+	}
+
+	p.tasks = append(p.tasks, t)
+
+	var dispatch bool
+	if len(p.tasks) >= b.size {
+		p.timer.Stop()
+		dispatch = b.flush(t.discriminator, p)
+	}
+
+	b.mutex.Unlock()
+
+	if dispatch {
+		b.dispatchReady(t.discriminator)
+	}
+
+	return nil
+}
+
+// expire flushes the batch once it has lingered, unless it has already been flushed
+func (b *batcher) expire(discriminator string, p *pendingBatch) {
+
+	b.mutex.Lock()
+
+	var dispatch bool
+	if b.pending[discriminator] == p {
+		dispatch = b.flush(discriminator, p)
+	}
+
+	b.mutex.Unlock()
+
+	if dispatch {
+		b.dispatchReady(discriminator)
+	}
+}
+
+// flush moves the pending batch of the group to its ready batches, the mutex must be held. Returns true if
+// the ready batches of the group must be dispatched by the caller, once the mutex is released, as no other
+// goroutine is dispatching them.
+func (b *batcher) flush(discriminator string, p *pendingBatch) bool {
+	delete(b.pending, discriminator)
+
+	//the batch waits for the pool on its own, each event keeps the context it was received with
+	t := &task{ctx: context.Background(), discriminator: discriminator, batch: p.tasks}
+
+	ready, dispatching := b.ready[discriminator]
+	b.ready[discriminator] = append(ready, t)
+
+	return !dispatching
+}
+
+// dispatchReady dispatches the ready batches of the group, in a goroutine of their own if async
+func (b *batcher) dispatchReady(discriminator string) {
+
+	if b.async {
+		go b.drain(discriminator)
+		return
+	}
+
+	b.drain(discriminator)
+}
+
+// drain dispatches the ready batches of the group in order, until none are left
+func (b *batcher) drain(discriminator string) {
+
+	for {
+		b.mutex.Lock()
+		ready := b.ready[discriminator]
+		if len(ready) == 0 {
+			delete(b.ready, discriminator)
+			b.mutex.Unlock()
+			return
+		}
+		b.ready[discriminator] = ready[1:]
+		b.mutex.Unlock()
+
+		b.dispatch(ready[0])
+	}
+}
+
+// stop stops batching, the pending batches and the ready batches that aren't being dispatched are rejected
+func (b *batcher) stop() {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stopped = true
+
+	for discriminator, p := range b.pending {
+		p.timer.Stop()
+		for _, t := range p.tasks {
+			t.reject(errPoolStopped)
+		}
+		delete(b.pending, discriminator)
+	}
+
+	//the groups stay in ready until their dispatch completes
+	for discriminator, ready := range b.ready {
+		for _, t := range ready {
+			t.reject(errPoolStopped)
+		}
+		b.ready[discriminator] = nil
+	}
+}
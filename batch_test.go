@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func batchIds(t *task) []interface{} {
+	var ids []interface{}
+	for _, bt := range t.batch {
+		ids = append(ids, bt.inputs["id"])
+	}
+	return ids
+}
+
+func TestBatcher(t *testing.T) {
+
+	dispatched := make(chan *task, 10)
+	b := newBatcher(3, 20*time.Millisecond, func(t *task) { dispatched <- t }, false)
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, b.add(newTestTask("a", i)))
+	}
+	assert.Nil(t, b.add(newTestTask("b", 5)))
+
+	//the first batch of a is full
+	batch := <-dispatched
+	assert.Equal(t, "a", batch.discriminator)
+	assert.Equal(t, []interface{}{0, 1, 2}, batchIds(batch))
+
+	//the other batches are dispatched once they have lingered
+	lingered := map[string][]interface{}{}
+	for i := 0; i < 2; i++ {
+		select {
+		case batch = <-dispatched:
+			lingered[batch.discriminator] = batchIds(batch)
+		case <-time.After(time.Second):
+			assert.Fail(t, "batch not dispatched")
+		}
+	}
+	assert.Equal(t, map[string][]interface{}{"a": {3, 4}, "b": {5}}, lingered)
+}
+
+func TestBatcher_Stop(t *testing.T) {
+
+	dispatched := make(chan *task, 10)
+	b := newBatcher(3, time.Hour, func(t *task) { dispatched <- t }, false)
+
+	pending := newTestTask("a", 0)
+	assert.Nil(t, b.add(pending))
+
+	b.stop()
+
+	assert.Equal(t, errPoolStopped, waitTask(t, pending))
+	assert.Equal(t, errPoolStopped, b.add(newTestTask("a", 1)))
+	assert.Len(t, dispatched, 0)
+}
+
+func TestBatcher_Dispatch(t *testing.T) {
+
+	started := make(chan struct{}, 10)
+	gate := make(chan struct{})
+	dispatched := make(chan *task, 10)
+	b := newBatcher(1, time.Hour, func(t *task) {
+		if t.discriminator == "a" {
+			started <- struct{}{}
+			<-gate
+		}
+		dispatched <- t
+	}, false)
+
+	//the dispatch of a blocks, the batches that follow it queue up
+	added := make(chan struct{})
+	go func() {
+		assert.Nil(t, b.add(newTestTask("a", 0)))
+		close(added)
+	}()
+	<-started
+
+	assert.Nil(t, b.add(newTestTask("a", 1)))
+	assert.Nil(t, b.add(newTestTask("a", 2)))
+
+	//other groups aren't blocked
+	assert.Nil(t, b.add(newTestTask("b", 3)))
+	assert.Equal(t, []interface{}{3}, batchIds(<-dispatched))
+
+	close(gate)
+	<-added
+
+	var ids []interface{}
+	for i := 0; i < 3; i++ {
+		ids = append(ids, batchIds(<-dispatched)...)
+	}
+	assert.Equal(t, []interface{}{0, 1, 2}, ids)
+}
+
+func TestBatcher_Async(t *testing.T) {
+
+	var mutex sync.Mutex
+	var running, overlapped bool
+	var ids []interface{}
+	done := make(chan struct{}, 10)
+
+	b := newBatcher(1, time.Hour, func(t *task) {
+		mutex.Lock()
+		overlapped = overlapped || running
+		running = true
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running = false
+		ids = append(ids, batchIds(t)...)
+		mutex.Unlock()
+		done <- struct{}{}
+	}, true)
+
+	//the batches of a group are executed one at a time in order, without blocking the caller
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, b.add(newTestTask("a", i)))
+	}
+	assert.True(t, time.Since(start) < 20*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.False(t, overlapped)
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4}, ids)
+}
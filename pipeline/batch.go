@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/stream/pipeline/support"
+)
+
+// BatchResult is the result of the execution of an event of a micro-batch
+type BatchResult struct {
+	Output map[string]interface{}
+	Status ExecutionStatus
+	Err    error
+}
+
+// RunBatch runs the pipeline for the inputs of a micro-batch whose events all belong to the group of the
+// discriminator, goCtxs are the contexts each execution is cancelled by. The executions proceed stage by stage,
+// stages whose activity implements support.BatchActivity evaluate the events at the stage at once, other stages
+// evaluate them one by one. The results are in the order of the inputs.
+func (inst *Instance) RunBatch(goCtxs []context.Context, discriminator string, inputs []map[string]interface{}) []*BatchResult {
+
+	state := inst.sm.GetState(discriminator)
+
+	ctxs := make([]*ExecutionContext, len(inputs))
+	hasWork := make([]bool, len(inputs))
+	errs := make([]error, len(inputs))
+
+	for i, input := range inputs {
+		ctxs[i] = inst.newExecution(goCtxs[i], discriminator, state, input)
+		hasWork[i] = true
+	}
+
+	unlock := lockExecution(state)
+	for {
+		//the executions at the stage of the first execution with work left, in the order of the inputs
+		var batch []*ExecutionContext
+		var ids []int
+		for i, ctx := range ctxs {
+			if hasWork[i] && (batch == nil || ctx.stageId == batch[0].stageId) {
+				batch = append(batch, ctx)
+				ids = append(ids, i)
+			}
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		hasNext, batchErrs := inst.doBatchStep(batch)
+		for j, i := range ids {
+			hasWork[i], errs[i] = hasNext[j], batchErrs[j]
+		}
+	}
+	unlock()
+
+	if len(ctxs) > 0 {
+		inst.stateChanged(ctxs[len(ctxs)-1])
+	}
+
+	results := make([]*BatchResult, len(ctxs))
+	for i, ctx := range ctxs {
+		result := &BatchResult{}
+		result.Output, result.Status, result.Err = inst.result(ctx, errs[i])
+		results[i] = result
+	}
+
+	return results
+}
+
+// doBatchStep executes the stage the executions are at, if the activity of the stage doesn't evaluate
+// batches each execution is stepped on its own. If the evaluation of the batch fails, the error policy
+// of the stage is applied to each execution, retries evaluate the executions one by one.
+func (inst *Instance) doBatchStep(ctxs []*ExecutionContext) (hasNext []bool, errs []error) {
+
+	hasNext = make([]bool, len(ctxs))
+	errs = make([]error, len(ctxs))
+
+	var batchAct support.BatchActivity
+	if ctxs[0].stageId < len(inst.def.stages) {
+		batchAct, _ = ctxs[0].currentStage().act.(support.BatchActivity)
+	}
+
+	if batchAct == nil || len(ctxs) == 1 {
+		for i, ctx := range ctxs {
+			hasNext[i], errs[i] = inst.DoStep(ctx, false)
+		}
+		return hasNext, errs
+	}
+
+	stage := ctxs[0].currentStage()
+	inputs := make([]map[string]interface{}, len(ctxs))
+
+	executed := func(i int, done bool, err error) {
+		if err != nil && !isCancelled(err) && stage.onError != nil {
+			done, err = inst.handleError(ctxs[i], inputs[i], err, ExecuteCurrentStage)
+		}
+		hasNext[i], errs[i] = inst.stageDone(ctxs[i], inputs[i], done, err)
+	}
+
+	var evaluated []int
+	for i, ctx := range ctxs {
+		inputs[i] = ctx.currentOutput
+
+		err := ctx.cancelled()
+		if err == nil {
+			err = prepareStage(ctx, stage)
+		}
+		if err != nil {
+			executed(i, false, err)
+			continue
+		}
+
+		evaluated = append(evaluated, i)
+	}
+
+	if len(evaluated) == 0 {
+		return hasNext, errs
+	}
+
+	evalCtxs := make([]*ExecutionContext, len(evaluated))
+	for j, i := range evaluated {
+		evalCtxs[j] = ctxs[i]
+	}
+
+	done, err := evalBatch(evalCtxs, stage, batchAct)
+
+	for j, i := range evaluated {
+		if err != nil {
+			executed(i, false, err)
+			continue
+		}
+
+		var mapErr error
+		if done[j] && stage.outputMapper != nil {
+			mapErr = applyOutputMapper(ctxs[i])
+		}
+
+		executed(i, done[j] && mapErr == nil, mapErr)
+	}
+
+	return hasNext, errs
+}
+
+// evalBatch evaluates the activity of the stage for the contexts of a batch at once, the batch is
+// cancelled once all its executions are cancelled
+func evalBatch(ctxs []*ExecutionContext, stage *Stage, act support.BatchActivity) (done []bool, err error) {
+
+	ctx := ctxs[0]
+	logger := ctx.pipeline.logger
+
+	defer func() {
+		if r := recover(); r != nil {
+
+			err = fmt.Errorf("unhandled error executing stage %d : %v", ctx.stageId, r)
+			logger.Error(err)
+			logger.Debugf("StackTrace: %s", debug.Stack())
+
+			done = nil
+		}
+	}()
+
+	if logger.DebugEnabled() {
+		logger.Debugf("Pipeline[%s] - Evaluating Activity %s for a batch of %d events", ctx.pipeline.id, activity.GetRef(stage.act), len(ctxs))
+	}
+
+	//results is only read once the evaluation completed, an abandoned evaluation might still set it
+	var results []bool
+	err = evalWithin(ctxs, stage, func(ctxs []*ExecutionContext) (err error) {
+		actCtxs := make([]activity.Context, len(ctxs))
+		for i, c := range ctxs {
+			actCtxs[i] = c
+		}
+
+		results, err = act.EvalBatch(actCtxs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) != len(ctxs) {
+		return nil, fmt.Errorf("stage %d returned %d results for a batch of %d events", ctx.stageId, len(results), len(ctxs))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchTagActivity appends "batch" to the tags of the previous stage, it records the sizes of the batches it
+// evaluated, a single event counting as a batch of 1. Events whose note is "stall" don't proceed.
+type batchTagActivity struct {
+	fail    bool
+	batches []int
+}
+
+func (a *batchTagActivity) Metadata() *activity.Metadata {
+	return tagActivityMd
+}
+
+func (a *batchTagActivity) Eval(ctx activity.Context) (done bool, err error) {
+	a.batches = append(a.batches, 1)
+	return a.eval(ctx)
+}
+
+func (a *batchTagActivity) EvalBatch(ctxs []activity.Context) (done []bool, err error) {
+	a.batches = append(a.batches, len(ctxs))
+	if a.fail {
+		return nil, errors.New("batch failed")
+	}
+
+	done = make([]bool, len(ctxs))
+	for i, ctx := range ctxs {
+		done[i], err = a.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return done, nil
+}
+
+func (a *batchTagActivity) eval(ctx activity.Context) (done bool, err error) {
+	if ctx.GetInput("note") == "stall" {
+		return false, nil
+	}
+	tags, _ := ctx.GetInput("tags").([]interface{})
+	err = ctx.SetOutput("tags", append(append([]interface{}(nil), tags...), "batch"))
+	return true, err
+}
+
+// newBatchDefinition creates a pipeline whose second stage evaluates batches
+func newBatchDefinition(t *testing.T, onError *ErrorPolicyConfig) (*Definition, *batchTagActivity) {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+
+	config.Stages[1].Input["note"] = "=$pipeline.note"
+	config.Stages[1].OnError = onError
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+
+	act := &batchTagActivity{}
+	def.stages[1].act = act
+
+	return def, act
+}
+
+func batchInputs(notes ...string) []map[string]interface{} {
+	inputs := make([]map[string]interface{}, len(notes))
+	for i, note := range notes {
+		inputs[i] = map[string]interface{}{"tags": []interface{}{}, "note": note}
+	}
+	return inputs
+}
+
+func batchContexts(n int) []context.Context {
+	goCtxs := make([]context.Context, n)
+	for i := range goCtxs {
+		goCtxs[i] = context.Background()
+	}
+	return goCtxs
+}
+
+func TestRunBatch(t *testing.T) {
+
+	def, act := newBatchDefinition(t, nil)
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	results := inst.RunBatch(batchContexts(3), "", batchInputs("", "stall", ""))
+	assert.Len(t, results, 3)
+	assert.Equal(t, []int{3}, act.batches)
+
+	for _, i := range []int{0, 2} {
+		assert.Nil(t, results[i].Err)
+		assert.Equal(t, ExecStatusCompleted, results[i].Status)
+		assert.Equal(t, []interface{}{"first", "batch", "last"}, results[i].Output["tags"])
+	}
+
+	assert.Nil(t, results[1].Err)
+	assert.Equal(t, ExecStatusStalled, results[1].Status)
+
+	//a single event is evaluated on its own
+	results = inst.RunBatch(batchContexts(1), "", batchInputs(""))
+	assert.Equal(t, ExecStatusCompleted, results[0].Status)
+	assert.Equal(t, []int{3, 1}, act.batches)
+}
+
+func TestRunBatch_Cancelled(t *testing.T) {
+
+	def, act := newBatchDefinition(t, nil)
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	//each event is cancelled by its own context
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	goCtxs := batchContexts(3)
+	goCtxs[1] = cancelled
+
+	results := inst.RunBatch(goCtxs, "", batchInputs("", "", ""))
+	assert.Equal(t, []int{2}, act.batches)
+
+	for _, i := range []int{0, 2} {
+		assert.Nil(t, results[i].Err)
+		assert.Equal(t, ExecStatusCompleted, results[i].Status)
+	}
+
+	assert.NotNil(t, results[1].Err)
+	assert.Equal(t, ExecStatusCancelled, results[1].Status)
+}
+
+func TestRunBatch_Error(t *testing.T) {
+
+	def, act := newBatchDefinition(t, nil)
+	act.fail = true
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	results := inst.RunBatch(batchContexts(2), "", batchInputs("", ""))
+	for _, result := range results {
+		assert.NotNil(t, result.Err)
+		assert.Equal(t, ExecStatusFailed, result.Status)
+	}
+
+	//retries evaluate the events one by one
+	def, act = newBatchDefinition(t, &ErrorPolicyConfig{Action: onErrorRetry, Retries: 1})
+	act.fail = true
+
+	inst = NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	results = inst.RunBatch(batchContexts(2), "", batchInputs("", ""))
+	for _, result := range results {
+		assert.Nil(t, result.Err)
+		assert.Equal(t, ExecStatusCompleted, result.Status)
+		assert.Equal(t, []interface{}{"first", "batch", "last"}, result.Output["tags"])
+	}
+	assert.Equal(t, []int{2, 1, 1}, act.batches)
+	assert.Equal(t, int64(2), def.ErrorCounts()[1].Retried)
+}
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// cancelledError is the error of an execution that was cancelled, either because its context was
+// done, the pipeline instance was stopped or a stage timed out
+type cancelledError struct {
+	stageId int
+	reason  string
+}
+
+func (e *cancelledError) Error() string {
+	return fmt.Sprintf("execution cancelled at stage %d : %s", e.stageId, e.reason)
+}
+
+func isCancelled(err error) bool {
+	_, ok := err.(*cancelledError)
+	return ok
+}
+
+// cancelled returns an error if the context of the execution is done or the pipeline instance has been stopped
+func (eCtx *ExecutionContext) cancelled() error {
+
+	if eCtx.runCtx != nil && eCtx.runCtx.Err() != nil {
+		return &cancelledError{stageId: eCtx.stageId, reason: eCtx.runCtx.Err().Error()}
+	}
+
+	if stopped := eCtx.pipeline.stopped; stopped != nil && stopped.Err() != nil {
+		return &cancelledError{stageId: eCtx.stageId, reason: "pipeline instance stopped"}
+	}
+
+	return nil
+}
+
+// sleep waits for the duration, unless the execution is cancelled first in which case the cancellation is returned
+func (eCtx *ExecutionContext) sleep(d time.Duration) error {
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var runDone, stopped <-chan struct{}
+	if eCtx.runCtx != nil {
+		runDone = eCtx.runCtx.Done()
+	}
+	if eCtx.pipeline.stopped != nil {
+		stopped = eCtx.pipeline.stopped.Done()
+	}
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-runDone:
+	case <-stopped:
+	}
+
+	return eCtx.cancelled()
+}
+
+// evalStage evaluates the activity of the stage for the execution
+func evalStage(ctx *ExecutionContext, stage *Stage) (bool, error) {
+
+	//done is only read once the evaluation completed, an abandoned evaluation might still set it
+	var done bool
+	err := evalWithin([]*ExecutionContext{ctx}, stage, func(ctxs []*ExecutionContext) (err error) {
+		done, err = stage.act.Eval(ctxs[0])
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
+
+// evalWithin evaluates the activity of the stage for the executions using eval. Without a stage timeout the
+// activity is evaluated in place and the cancellation of the executions is only checked between stages. With a
+// timeout the activity is evaluated in its own goroutine against copies of the contexts, whose outputs are only kept
+// once it completes. If the stage times out, or all the executions are cancelled first, the evaluation is abandoned,
+// its copies are discarded and the following evaluations, timers and snapshots of the group wait for it to complete.
+func evalWithin(ctxs []*ExecutionContext, stage *Stage, eval func(ctxs []*ExecutionContext) error) error {
+
+	ctx := ctxs[0]
+	state := ctx.pipelineState()
+
+	if stage.timeout <= 0 {
+		waitAbandoned(state)
+		return eval(ctxs)
+	}
+
+	runDone, release := allDone(ctxs)
+	defer release()
+
+	evalCtxs := make([]*ExecutionContext, len(ctxs))
+	for i, c := range ctxs {
+		evalCtxs[i] = c.fork()
+	}
+
+	stageId := ctx.stageId
+	results := make(chan error, 1)
+	completed := make(chan struct{})
+
+	go func() {
+		defer close(completed)
+		defer func() {
+			if r := recover(); r != nil {
+				ctx.pipeline.logger.Debugf("StackTrace: %s", debug.Stack())
+				results <- fmt.Errorf("unhandled error executing stage %d : %v", stageId, r)
+			}
+		}()
+
+		//waiting for a previously abandoned evaluation counts towards the timeout
+		waitAbandoned(state)
+		results <- eval(evalCtxs)
+	}()
+
+	timer := time.NewTimer(stage.timeout)
+	defer timer.Stop()
+
+	var stopped <-chan struct{}
+	if ctx.pipeline.stopped != nil {
+		stopped = ctx.pipeline.stopped.Done()
+	}
+
+	var err error
+
+	select {
+	case err = <-results:
+		for i, c := range ctxs {
+			c.currentOutput = evalCtxs[i].currentOutput
+			c.updateTimers |= evalCtxs[i].updateTimers
+		}
+		return err
+	case <-timer.C:
+		err = &cancelledError{stageId: stageId, reason: fmt.Sprintf("timed out after %v", stage.timeout)}
+	case <-runDone:
+		err = ctx.cancelled()
+	case <-stopped:
+		err = ctx.cancelled()
+	}
+
+	abandonEval(state, completed)
+	return err
+}
+
+// allDone returns a channel that is closed once the contexts of all the executions are done, or nil if one of
+// them can't be cancelled. release must be called once the channel is no longer used.
+func allDone(ctxs []*ExecutionContext) (done <-chan struct{}, release func()) {
+
+	dones := make([]<-chan struct{}, len(ctxs))
+	for i, ctx := range ctxs {
+		if ctx.runCtx == nil || ctx.runCtx.Done() == nil {
+			return nil, func() {}
+		}
+		dones[i] = ctx.runCtx.Done()
+	}
+
+	if len(dones) == 1 {
+		return dones[0], func() {}
+	}
+
+	all := make(chan struct{})
+	released := make(chan struct{})
+
+	go func() {
+		for _, d := range dones {
+			select {
+			case <-d:
+			case <-released:
+				return
+			}
+		}
+		close(all)
+	}()
+
+	return all, func() { close(released) }
+}
@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSlowDefinition creates a pipeline whose second stage takes delay millis to evaluate
+func newSlowDefinition(t *testing.T, delay, timeout int, onError *ErrorPolicyConfig) *Definition {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+
+	config.Stages[1].Settings["delay"] = delay
+	config.Stages[1].Timeout = timeout
+	config.Stages[1].OnError = onError
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+
+	return def
+}
+
+func TestStageTimeout(t *testing.T) {
+
+	def := newSlowDefinition(t, 500, 20, nil)
+
+	start := time.Now()
+	out, status, err := runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.Nil(t, out)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+
+	//timeouts aren't handled by the error policy
+	def = newSlowDefinition(t, 500, 20, &ErrorPolicyConfig{Action: onErrorDrop})
+
+	_, status, err = runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.Equal(t, int64(0), def.ErrorCounts()[1].Dropped)
+
+	def = newSlowDefinition(t, 10, 1000, nil)
+
+	out, status, err = runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Equal(t, []interface{}{"first", "flaky", "last"}, out["tags"])
+
+	config := &DefinitionConfig{}
+	err = json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+	config.Stages[1].Timeout = -1
+	_, err = NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.NotNil(t, err)
+}
+
+func TestRunContext(t *testing.T) {
+
+	def := newSlowDefinition(t, 500, 0, nil)
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	input := map[string]interface{}{"tags": []interface{}{}}
+
+	goCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, status, err := inst.RunContext(goCtx, "", input)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+
+	//without a timeout the slow stage completes, the execution is cancelled before the following stage
+	def = newSlowDefinition(t, 50, 0, nil)
+	inst2 := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst2.Stop()
+
+	goCtx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, status, err = inst2.RunContext(goCtx, "", input)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.Equal(t, 2, err.(*cancelledError).stageId)
+
+	//with a timeout the slow stage is abandoned once the context is done
+	def = newSlowDefinition(t, 500, 1000, nil)
+	inst3 := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst3.Stop()
+
+	goCtx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, status, err = inst3.RunContext(goCtx, "", input)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.Equal(t, 1, err.(*cancelledError).stageId)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+}
+
+func TestStop(t *testing.T) {
+
+	def := newSlowDefinition(t, 0, 0, nil)
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+
+	out, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.NotNil(t, out)
+
+	inst.Stop()
+
+	_, status, err = inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+}
+
+// writerActivity keeps setting its output and the shared temp data of its group for delay
+type writerActivity struct {
+	delay      time.Duration
+	running    int32
+	overlapped int32
+}
+
+func (a *writerActivity) Metadata() *activity.Metadata {
+	return tagActivityMd
+}
+
+func (a *writerActivity) Eval(ctx activity.Context) (done bool, err error) {
+
+	if !atomic.CompareAndSwapInt32(&a.running, 0, 1) {
+		atomic.StoreInt32(&a.overlapped, 1)
+	}
+	defer atomic.StoreInt32(&a.running, 0)
+
+	shared := ctx.GetSharedTempData()
+	for i, deadline := 0, time.Now().Add(a.delay); time.Now().Before(deadline); i++ {
+		shared["writes"] = i
+		err = ctx.SetOutput("tags", []interface{}{i})
+		if err != nil {
+			return false, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return true, nil
+}
+
+func TestStageTimeout_Abandoned(t *testing.T) {
+
+	def := newSlowDefinition(t, 0, 10, nil)
+	act := &writerActivity{delay: 50 * time.Millisecond}
+	def.stages[1].act = act
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	state := inst.sm.GetState("")
+	ctx := inst.newExecution(context.Background(), "", state, nil)
+	ctx.stageId = 1
+	ctx.currentOutput = make(map[string]interface{})
+
+	_, err := evalStage(ctx, def.stages[1])
+	assert.True(t, isCancelled(err))
+
+	//the abandoned evaluation doesn't write to the context of the execution
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, ctx.currentOutput["tags"])
+		time.Sleep(time.Millisecond)
+	}
+
+	//the following evaluations of the group wait for it to complete
+	_, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusCancelled, status)
+
+	unlock := lockSnapshot(state)
+	unlock()
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&act.overlapped))
+}
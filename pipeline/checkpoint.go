@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CheckpointVersion is the version of the checkpoint format written by Instance.Checkpoint
+const CheckpointVersion = 1
+
+// checkpoint is the serialized form of the state of all the groups of an instance
+type checkpoint struct {
+	Version    int                        `json:"version"`
+	PipelineId string                     `json:"pipelineId"`
+	Created    time.Time                  `json:"created"`
+	Groups     map[string]json.RawMessage `json:"groups"`
+}
+
+// Checkpoint writes the state of all the groups of the instance, including the pipeline scope,
+// the state of the stateful stages and the deadlines of their timers
+func (inst *Instance) Checkpoint(w io.Writer) error {
+
+	cp := &checkpoint{Version: CheckpointVersion, PipelineId: inst.PipelineId(), Created: time.Now(), Groups: make(map[string]json.RawMessage)}
+
+	var err error
+	inst.sm.ForEach(func(id string, state State) {
+		if err != nil {
+			return
+		}
+
+		var data []byte
+		data, err = marshalState(inst.def, state)
+		if err != nil {
+			err = fmt.Errorf("unable to checkpoint group '%s': %s", id, err.Error())
+			return
+		}
+		cp.Groups[id] = data
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(cp)
+}
+
+// Restore restores the state of the groups in the checkpoint, timers are aligned to their
+// checkpointed deadlines when the stages recreate them
+func (inst *Instance) Restore(r io.Reader) error {
+
+	cp := &checkpoint{}
+	err := json.NewDecoder(r).Decode(cp)
+	if err != nil {
+		return fmt.Errorf("unable to read checkpoint: %s", err.Error())
+	}
+
+	if cp.Version < 1 || cp.Version > CheckpointVersion {
+		return fmt.Errorf("unsupported checkpoint version: %d", cp.Version)
+	}
+
+	if cp.PipelineId != inst.PipelineId() {
+		return fmt.Errorf("checkpoint is for pipeline '%s' not '%s'", cp.PipelineId, inst.PipelineId())
+	}
+
+	for id, data := range cp.Groups {
+
+		snapshot := &stateSnapshot{}
+		err = json.Unmarshal(data, snapshot)
+		if err != nil {
+			return fmt.Errorf("unable to read checkpoint of group '%s': %s", id, err.Error())
+		}
+
+		state := getRestoredState(inst.sm, id)
+
+		unlock := lockSnapshot(state)
+		err = restoreState(inst.def, state, snapshot)
+		unlock()
+		if err != nil {
+			return fmt.Errorf("unable to restore group '%s': %s", id, err.Error())
+		}
+
+		if inst.persistence != nil {
+			inst.persistence.Changed(id, state)
+		}
+	}
+
+	inst.logger.Infof("Restored checkpoint of %d group(s) created at %s", len(cp.Groups), cp.Created.Format(time.RFC3339))
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstance_Checkpoint(t *testing.T) {
+
+	act := &statefulActivity{}
+	def := &Definition{id: "test", stages: []*Stage{{act: act}}}
+
+	inst := NewInstance(def, "1", &GroupSettings{}, nil, log.RootLogger())
+	defer inst.Stop()
+
+	_, _, err := inst.Run("a", nil)
+	assert.Nil(t, err)
+	_, _, err = inst.Run("a", nil)
+	assert.Nil(t, err)
+	_, _, err = inst.Run("b", nil)
+	assert.Nil(t, err)
+
+	holder, err := inst.sm.GetState("a").NewTicker(act, time.Hour)
+	assert.Nil(t, err)
+	deadline := holder.Deadline()
+
+	buf := &bytes.Buffer{}
+	err = inst.Checkpoint(buf)
+	assert.Nil(t, err)
+
+	inst2 := NewInstance(def, "2", &GroupSettings{}, nil, log.RootLogger())
+	defer inst2.Stop()
+
+	err = inst2.Restore(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, inst2.sm.GetState("a").GetSharedData(act)[sdCount])
+	assert.Equal(t, 1, inst2.sm.GetState("b").GetSharedData(act)[sdCount])
+
+	//recreated ticker is aligned to the checkpointed deadline
+	holder, err = inst2.sm.GetState("a").NewTicker(act, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, deadline.Equal(holder.Deadline()))
+
+	//ticker in a group without a checkpointed deadline starts now
+	holder, err = inst2.sm.GetState("b").NewTicker(act, time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, deadline.Equal(holder.Deadline()))
+}
+
+func TestInstance_RestoreInvalid(t *testing.T) {
+
+	def := &Definition{id: "test", stages: []*Stage{{act: &statefulActivity{}}}}
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	err := inst.Restore(strings.NewReader(`{"version":99,"pipelineId":"test","groups":{}}`))
+	assert.NotNil(t, err)
+
+	err = inst.Restore(strings.NewReader(`{"version":1,"pipelineId":"other","groups":{}}`))
+	assert.NotNil(t, err)
+
+	err = inst.Restore(strings.NewReader(`{"version":1,"pipelineId":"test","groups":{"":{"scope":{"a":1}}}}`))
+	assert.Nil(t, err)
+
+	val, exists := inst.sm.GetState("").GetScope().GetValue("a")
+	assert.True(t, exists)
+	assert.Equal(t, float64(1), val)
+}
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"runtime/debug"
 	"time"
@@ -38,12 +39,20 @@ const (
 	// ExecStatusStalled indicates that the Pipeline execution has stalled
 	ExecStatusStalled ExecutionStatus = 400
 
+	// ExecStatusSplit indicates that the Pipeline execution has been split into executions whose
+	// outputs have been published individually
+	ExecStatusSplit ExecutionStatus = 450
+
 	// ExecStatusCompleted indicates that the Pipeline execution has been completed
 	ExecStatusCompleted ExecutionStatus = 500
 
 	// ExecStatusCancelled indicates that the Pipeline execution has been cancelled
 	ExecStatusCancelled ExecutionStatus = 600
 
+	// ExecStatusDropped indicates that a stage of the Pipeline execution has failed and the event has been
+	// dropped by the error policy of the stage
+	ExecStatusDropped ExecutionStatus = 650
+
 	// ExecStatusFailed indicates that the Pipeline execution has failed
 	ExecStatusFailed ExecutionStatus = 700
 )
@@ -56,6 +65,7 @@ const (
 type ExecutionContext struct {
 	pipeline      *Instance
 	discriminator string
+	state         State
 
 	stageId int
 	status  ExecutionStatus
@@ -67,6 +77,13 @@ type ExecutionContext struct {
 	currentInput  map[string]interface{}
 	currentOutput map[string]interface{}
 
+	// err is the error the execution failed with, errorData describes it to the stages of the error handler
+	err       error
+	errorData map[string]interface{}
+
+	// runCtx is the context the execution is cancelled by, nil if it can't be cancelled
+	runCtx context.Context
+
 	updateTimers uint8
 }
 
@@ -74,14 +91,27 @@ func (eCtx *ExecutionContext) Status() ExecutionStatus {
 	return eCtx.status
 }
 
+// Discriminator returns the group the execution belongs to, empty if the pipeline isn't grouped
+func (eCtx *ExecutionContext) Discriminator() string {
+	return eCtx.discriminator
+}
+
 func (eCtx *ExecutionContext) currentStage() *Stage {
 	//possibly keep pointer to state in ctx?
 	return eCtx.pipeline.def.stages[eCtx.stageId]
 }
 
 func (eCtx *ExecutionContext) pipelineScope() data.Scope {
-	//todo just maybe store ref to pipeline state in ctx
-	return eCtx.pipeline.sm.GetState(eCtx.discriminator).GetScope()
+	return eCtx.pipelineState().GetScope()
+}
+
+// pipelineState gets the state of the group the execution belongs to, the state is held by the
+// context so that an execution keeps working against its group even if it has been evicted
+func (eCtx *ExecutionContext) pipelineState() State {
+	if eCtx.state == nil {
+		eCtx.state = eCtx.pipeline.sm.GetState(eCtx.discriminator)
+	}
+	return eCtx.state
 }
 
 /////////////////////////////////////////
@@ -108,7 +138,7 @@ func (eCtx *ExecutionContext) Return(returnData map[string]interface{}, err erro
 }
 
 func (eCtx *ExecutionContext) Scope() data.Scope {
-	return eCtx.pipeline.sm.GetState(eCtx.discriminator).GetScope()
+	return eCtx.pipelineState().GetScope()
 }
 
 func (eCtx *ExecutionContext) GetTracingContext() trace.TracingContext {
@@ -178,8 +208,7 @@ func (eCtx *ExecutionContext) SetOutput(name string, value interface{}) error {
 
 func (eCtx *ExecutionContext) GetSharedTempData() map[string]interface{} {
 
-	state := eCtx.pipeline.sm.GetState(eCtx.discriminator)
-	return state.GetSharedData(eCtx.currentStage().act)
+	return eCtx.pipelineState().GetSharedData(eCtx.currentStage().act)
 }
 
 func (eCtx *ExecutionContext) Logger() log.Logger {
@@ -202,14 +231,13 @@ func (eCtx *ExecutionContext) SetOutputObject(output data.StructValue) error {
 // HasTimer indicates if a timer already exists
 func (eCtx *ExecutionContext) HasTimer(repeating bool) bool {
 	act := eCtx.currentStage().act
-	eCtx.pipeline.sm.GetState(eCtx.discriminator)
 
 	var hasTimer bool
 
-	state := eCtx.pipeline.sm.GetState(eCtx.discriminator)
+	state := eCtx.pipelineState()
 
 	if repeating {
-		_, hasTimer = state.GetTimer(act)
+		_, hasTimer = state.GetTicker(act)
 	} else {
 		_, hasTimer = state.GetTimer(act)
 	}
@@ -221,7 +249,7 @@ func (eCtx *ExecutionContext) HasTimer(repeating bool) bool {
 func (eCtx *ExecutionContext) CancelTimer(repeating bool) {
 	act := eCtx.currentStage().act
 
-	state := eCtx.pipeline.sm.GetState(eCtx.discriminator)
+	state := eCtx.pipelineState()
 
 	if repeating {
 		state.RemoveTicker(act)
@@ -243,15 +271,15 @@ func (eCtx *ExecutionContext) UpdateTimer(repeating bool) {
 // CreateTimer creates a timer, note: can only have one active timer at a time for an activity
 func (eCtx *ExecutionContext) UpdateTimers() {
 	act := eCtx.currentStage().act
-	state := eCtx.pipeline.sm.GetState(eCtx.discriminator)
+	state := eCtx.pipelineState()
 
 	if eCtx.updateTimers&bitIsTicker > 0 {
 		if holder, exists := state.GetTicker(act); exists {
-			holder.SetLastExecCtx(eCtx)
+			holder.SetLastExecCtx(eCtx.timerContext(eCtx.stageId))
 		}
 	} else if eCtx.updateTimers&bitIsTimer > 0 {
 		if holder, exists := state.GetTimer(act); exists {
-			holder.SetLastExecCtx(eCtx)
+			holder.SetLastExecCtx(eCtx.timerContext(eCtx.stageId))
 		}
 	}
 	eCtx.updateTimers = 0
@@ -264,12 +292,10 @@ func (eCtx *ExecutionContext) CreateTimer(interval time.Duration, callback suppo
 
 	logger := log.RootLogger()
 
-	//todo add "clone ctx flag, in case exec context isn't discarded)
-	//discriminator := eCtx.discriminator
-	//inst := eCtx.pipeline
-	//stageId := eCtx.stageId
+	//the timer fires at the stage that created it, whatever stage the execution moved on to
+	stageId := eCtx.stageId
 
-	state := eCtx.pipeline.sm.GetState(eCtx.discriminator)
+	state := eCtx.pipelineState()
 
 	if repeating {
 		//create go ticker
@@ -278,24 +304,46 @@ func (eCtx *ExecutionContext) CreateTimer(interval time.Duration, callback suppo
 		if err != nil {
 			return err
 		}
-		//todo should this clone ctx?
-		holder.SetLastExecCtx(eCtx)
+		holder.SetLastExecCtx(eCtx.timerContext(stageId))
 
 		go func() {
 
-			for range holder.ticker.C {
+			var tickC <-chan time.Time
+			if holder.delay != nil {
+				tickC = holder.delay.C
+			} else {
+				tickC = holder.ticker.C
+			}
 
-				newCtx := holder.GetLastExecCtx()
+			for {
+				select {
+				case <-holder.done:
+					return
+				case <-tickC:
+				}
+
+				if holder.GetTicker() == nil {
+					//restored ticker reached its deadline, start ticking at the regular interval
+					if !holder.startDelayed() {
+						return
+					}
+					tickC = holder.GetTicker().C
+				}
+
+				lastCtx := holder.GetLastExecCtx()
 
 				//todo - what should we do if no samples have come in a window,  ignore for now
 
-				if newCtx != nil {
+				if lastCtx != nil {
+					newCtx := lastCtx.timerContext(stageId)
 
 					if logger.DebugEnabled() {
 						ref := activity.GetRef(newCtx.currentStage().act)
 						logger.Debugf("Repeating timer fired for activity: %s", ref)
 					}
 
+					unlock := lockExecution(state)
+					waitAbandoned(state)
 					resume := invokeCallback(callback, newCtx)
 					//resume := callback(newCtx)
 					if resume {
@@ -304,6 +352,9 @@ func (eCtx *ExecutionContext) CreateTimer(interval time.Duration, callback suppo
 							logger.Errorf("Unable to resume stream pipeline: %v", err)
 						}
 					}
+					unlock()
+
+					newCtx.pipeline.stateChanged(newCtx)
 				} else {
 					if logger.DebugEnabled() {
 						logger.Debugf("Repeating timer fired for activity: %s, but not running since no samples in window", "activity")
@@ -319,21 +370,24 @@ func (eCtx *ExecutionContext) CreateTimer(interval time.Duration, callback suppo
 		if err != nil {
 			return err
 		}
-		//todo should this clone ctx?
-		holder.SetLastExecCtx(eCtx)
+		holder.SetLastExecCtx(eCtx.timerContext(stageId))
 
 		go func() {
-			<-holder.timer.C
-			newCtx := holder.GetLastExecCtx()
-			//newCtx := &ExecutionContext{discriminator: discriminator, stream: inst}
-			//newCtx.stageId = stageId
-			//newCtx.status = ExecStatusActive
+			select {
+			case <-holder.done:
+				return
+			case <-holder.timer.C:
+			}
+
+			newCtx := holder.GetLastExecCtx().timerContext(stageId)
 
 			if logger.DebugEnabled() {
 				ref := activity.GetRef(newCtx.currentStage().act)
 				logger.Debugf("Timeout timer fired for activity: %s", ref)
 			}
 
+			unlock := lockExecution(state)
+			waitAbandoned(state)
 			resume := invokeCallback(callback, newCtx)
 			//resume := callback(newCtx)
 			if resume {
@@ -342,12 +396,25 @@ func (eCtx *ExecutionContext) CreateTimer(interval time.Duration, callback suppo
 					logger.Errorf("Unable to resume stream pipeline: %v", err)
 				}
 			}
+			unlock()
+
+			newCtx.pipeline.stateChanged(newCtx)
 		}()
 	}
 
 	return nil
 }
 
+// timerContext creates a context that continues the execution from the stage, independently of the execution
+// which may still be running or may have moved on. The timers of a stage hold such a copy of the execution that
+// last set or updated them, and fire with a copy of it.
+func (eCtx *ExecutionContext) timerContext(stageId int) *ExecutionContext {
+
+	return &ExecutionContext{pipeline: eCtx.pipeline, discriminator: eCtx.discriminator, state: eCtx.state,
+		stageId: stageId, status: ExecStatusActive, pipelineInput: eCtx.pipelineInput, passThru: copyMap(eCtx.passThru),
+		currentInput: eCtx.currentInput, currentOutput: make(map[string]interface{})}
+}
+
 func invokeCallback(callback support.TimerCallback, ctx activity.Context) (resume bool) {
 
 	//todo fix logger
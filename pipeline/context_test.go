@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/engine/channels"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/stream/pipeline/support"
+	"github.com/stretchr/testify/assert"
+)
+
+// timerActivity sets a timer for every event, the timer appends "timer" to the tags of the last event.
+// Events whose note is "stall" don't proceed.
+type timerActivity struct {
+	delay time.Duration
+}
+
+func (a *timerActivity) Metadata() *activity.Metadata {
+	return tagActivityMd
+}
+
+func (a *timerActivity) Eval(ctx activity.Context) (done bool, err error) {
+
+	timerSupport, _ := support.GetTimerSupport(ctx)
+	timerSupport.CancelTimer(false)
+
+	err = timerSupport.CreateTimer(a.delay, a.fire, false)
+	if err != nil {
+		return false, err
+	}
+
+	tags, _ := ctx.GetInput("tags").([]interface{})
+	err = ctx.SetOutput("tags", append(append([]interface{}(nil), tags...), "event"))
+
+	return ctx.GetInput("note") != "stall", err
+}
+
+func (a *timerActivity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
+	return true, nil
+}
+
+func (a *timerActivity) fire(ctx activity.Context) bool {
+	tags, _ := ctx.GetInput("tags").([]interface{})
+	_ = ctx.SetOutput("tags", append(append([]interface{}(nil), tags...), "timer"))
+	return true
+}
+
+// publishedChannel hands the published messages over a go channel
+type publishedChannel struct {
+	published chan interface{}
+}
+
+func (c *publishedChannel) RegisterCallback(callback channels.OnMessage) error {
+	return nil
+}
+
+func (c *publishedChannel) Publish(msg interface{}) {
+	c.published <- msg
+}
+
+func (c *publishedChannel) PublishNoWait(msg interface{}) bool {
+	select {
+	case c.published <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestCreateTimer_Resume(t *testing.T) {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+	config.Stages[1].Input["note"] = "=$pipeline.note"
+	config.Stages[1].Output = config.Stages[2].Output
+	config.Stages = config.Stages[:2]
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+	def.stages[1].act = &timerActivity{delay: 20 * time.Millisecond}
+
+	ch := &publishedChannel{published: make(chan interface{}, 5)}
+	inst := NewInstance(def, "1", nil, ch, log.RootLogger())
+	defer inst.Stop()
+
+	_, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{}, "note": "stall"})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusStalled, status)
+
+	//the execution that last set the timer completes, the timer resumes it from the stage of the timer
+	out, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{}, "note": ""})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Equal(t, []interface{}{"first", "event"}, out["tags"])
+
+	select {
+	case msg := <-ch.published:
+		assert.Equal(t, map[string]interface{}{"tags": []interface{}{"first", "timer"}}, msg)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timer didn't resume the execution")
+	}
+}
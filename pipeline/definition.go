@@ -14,30 +14,89 @@ type DefinitionConfig struct {
 	Name     string               `json:"name"`
 	Metadata *metadata.IOMetadata `json:"metadata"`
 	Stages   []*StageConfig       `json:"stages"`
+
+	// ErrorHandler are the stages executed when the execution fails
+	ErrorHandler []*StageConfig `json:"errorHandler,omitempty"`
 }
 
 func NewDefinition(config *DefinitionConfig, mf mapper.Factory, resolver resolve.CompositeResolver) (*Definition, error) {
 
 	def := &Definition{id: config.id, name: config.Name, metadata: config.Metadata}
 
-	for _, sconfig := range config.Stages {
-		stage, err := NewStage(sconfig, mf, resolver)
+	_, err := def.addStages(config.Stages, stageEnd, mf, resolver)
+	if err != nil {
+		return nil, err
+	}
 
+	if len(config.ErrorHandler) > 0 {
+		def.errorHandler, err = def.addStages(config.ErrorHandler, stageEnd, mf, resolver)
 		if err != nil {
 			return nil, err
 		}
-
-		def.stages = append(def.stages, stage)
+		def.handlesErrors = true
 	}
 
 	return def, nil
 }
 
+// addStages adds a sequence of stages that is followed by the stage with id next, the stages
+// of branches are added after the sequence, so the ids of the top level stages are their
+// position in the pipeline. Returns the id of the first stage of the sequence.
+func (d *Definition) addStages(configs []*StageConfig, next int, mf mapper.Factory, resolver resolve.CompositeResolver) (int, error) {
+
+	if len(configs) == 0 {
+		return next, nil
+	}
+
+	first := len(d.stages)
+
+	for _, sconfig := range configs {
+		stage, err := NewStage(sconfig, mf, resolver)
+		if err != nil {
+			return 0, err
+		}
+
+		stage.next, stage.routed = len(d.stages)+1, true
+		d.stages = append(d.stages, stage)
+	}
+
+	d.stages[len(d.stages)-1].next = next
+
+	for i, sconfig := range configs {
+		stage := d.stages[first+i]
+
+		for _, bconfig := range sconfig.Branches {
+			branch, err := newBranch(bconfig, mf)
+			if err != nil {
+				return 0, err
+			}
+
+			merge := stage.next
+			if bconfig.End {
+				merge = stageEnd
+			}
+
+			branch.start, err = d.addStages(bconfig.Stages, merge, mf, resolver)
+			if err != nil {
+				return 0, err
+			}
+
+			stage.branches = append(stage.branches, branch)
+		}
+	}
+
+	return first, nil
+}
+
 type Definition struct {
 	id       string
 	name     string
 	stages   []*Stage
 	metadata *metadata.IOMetadata
+
+	// errorHandler is the id of the first stage of the error handler, it is only set if the pipeline handles errors
+	errorHandler  int
+	handlesErrors bool
 }
 
 // Metadata returns IO metadata for the pipeline
@@ -53,9 +112,23 @@ func (d *Definition) Name() string {
 	return d.name
 }
 
+// ErrorCounts returns the number of times the actions of the error policies of the stages were applied,
+// by stage id. The ids of the top level stages are their position in the pipeline.
+func (d *Definition) ErrorCounts() map[int]ErrorCounts {
+
+	counts := make(map[int]ErrorCounts)
+	for id, stage := range d.stages {
+		if stage.onError != nil {
+			counts[id] = stage.onError.errorCounts()
+		}
+	}
+
+	return counts
+}
+
 func (d *Definition) Cleanup() error {
 	for _, stage := range d.stages {
-		if !activity.IsSingleton(stage.act) {
+		if stage.act != nil && !activity.IsSingleton(stage.act) {
 			if needsCleanup, ok := stage.act.(support.NeedsCleanup); ok {
 				err := needsCleanup.Cleanup()
 				if err != nil {
@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
+	_ "github.com/project-flogo/core/data/expression/script"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	_ = activity.Register(&tagActivity{}, newTagActivity)
+}
+
+type tagSettings struct {
+	Tag   string `md:"tag"`
+	Fail  int    `md:"fail"`
+	Delay int    `md:"delay"`
+}
+
+type tagInput struct {
+	Tags []interface{} `md:"tags"`
+	Note interface{}   `md:"note"`
+}
+
+type tagOutput struct {
+	Tags []interface{} `md:"tags"`
+}
+
+var tagActivityMd = activity.ToMetadata(&tagSettings{}, &tagInput{}, &tagOutput{})
+
+// tagActivity appends its tag to the tags of the previous stage, it fails the first evaluations if fail
+// is set, or all of them if fail is negative. The last note it got is kept. If delay is set the
+// evaluations take that many millis.
+type tagActivity struct {
+	tag   string
+	fail  int
+	delay time.Duration
+	note  interface{}
+}
+
+func newTagActivity(ctx activity.InitContext) (activity.Activity, error) {
+	tag, _ := ctx.Settings()["tag"].(string)
+	fail, _ := coerce.ToInt(ctx.Settings()["fail"])
+	delay, _ := coerce.ToInt(ctx.Settings()["delay"])
+	return &tagActivity{tag: tag, fail: fail, delay: time.Duration(delay) * time.Millisecond}, nil
+}
+
+func (a *tagActivity) Metadata() *activity.Metadata {
+	return tagActivityMd
+}
+
+func (a *tagActivity) Eval(ctx activity.Context) (done bool, err error) {
+	time.Sleep(a.delay)
+	if a.fail != 0 {
+		a.fail--
+		return false, fmt.Errorf("stage '%s' failed", a.tag)
+	}
+	a.note = ctx.GetInput("note")
+	tags, _ := ctx.GetInput("tags").([]interface{})
+	err = ctx.SetOutput("tags", append(append([]interface{}(nil), tags...), a.tag))
+	return true, err
+}
+
+const branchDefinition = `{
+  "name": "branching",
+  "metadata": {
+    "input": [{"name": "temp", "type": "integer"}, {"name": "tags", "type": "array"}],
+    "output": [{"name": "tags", "type": "array"}]
+  },
+  "stages": [
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "first"},
+      "input": {"tags": "=$.tags"}
+    },
+    {
+      "branches": [
+        {
+          "name": "hot",
+          "condition": "=$pipeline.temp > 80",
+          "stages": [
+            {"ref": "github.com/project-flogo/stream/pipeline", "settings": {"tag": "hot"}, "input": {"tags": "=$.tags"}},
+            {"ref": "github.com/project-flogo/stream/pipeline", "settings": {"tag": "alert"}, "input": {"tags": "=$.tags"},
+             "output": {"pipeline.tags": "=$.tags"}}
+          ],
+          "end": true
+        },
+        {
+          "name": "cold",
+          "condition": "=$pipeline.temp < 10",
+          "stages": [
+            {"ref": "github.com/project-flogo/stream/pipeline", "settings": {"tag": "cold"}, "input": {"tags": "=$.tags"}}
+          ]
+        },
+        {
+          "name": "normal"
+        }
+      ]
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "last"},
+      "input": {"tags": "=$.tags"},
+      "output": {"pipeline.tags": "=$.tags"}
+    }
+  ]
+}`
+
+func TestBranches(t *testing.T) {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(branchDefinition), config)
+	assert.Nil(t, err)
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+
+	//the top level stages keep their position
+	assert.Len(t, def.stages, 6)
+	assert.Equal(t, "first", def.stages[0].act.(*tagActivity).tag)
+	assert.Nil(t, def.stages[1].act)
+	assert.Equal(t, "last", def.stages[2].act.(*tagActivity).tag)
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	tests := []struct {
+		temp int
+		tags []interface{}
+	}{
+		{90, []interface{}{"first", "hot", "alert"}},
+		{5, []interface{}{"first", "cold", "last"}},
+		{20, []interface{}{"first", "last"}},
+	}
+
+	for _, tt := range tests {
+		output, status, err := inst.Run("", map[string]interface{}{"temp": tt.temp, "tags": []interface{}{}})
+		assert.Nil(t, err)
+		assert.Equal(t, ExecStatusCompleted, status)
+		assert.Equal(t, tt.tags, output["tags"], "temp %d", tt.temp)
+	}
+}
+
+func TestBranches_Invalid(t *testing.T) {
+
+	config := &DefinitionConfig{Stages: []*StageConfig{{Branches: []*BranchConfig{{Name: "bad", Condition: "=$.a >"}}}}}
+	_, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.NotNil(t, err)
+
+	//a stage requires an activity or branches
+	config = &DefinitionConfig{Stages: []*StageConfig{{}}}
+	_, err = NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.NotNil(t, err)
+}
@@ -1,17 +1,19 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/project-flogo/stream/pipeline/support"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/project-flogo/core/activity"
 	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/engine/channels"
 	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/stream/pipeline/support"
 )
 
 type Instance struct {
@@ -20,21 +22,58 @@ type Instance struct {
 	status Status
 	logger log.Logger
 
-	sm         StateManager
-	outChannel channels.Channel
+	sm          StateManager
+	persistence *persistentStateManager
+	outChannel  channels.Channel
+
+	flushOnEvict bool
+
+	// stopped is done once the instance is stopped, cancelling the executions in progress
+	stopped context.Context
+	stop    context.CancelFunc
+}
+
+// NewInstance creates a new pipeline instance, if the pipeline is grouped groupSettings should be
+// specified, otherwise a single state is shared by all executions
+func NewInstance(definition *Definition, id string, groupSettings *GroupSettings, outChannel channels.Channel, logger log.Logger) *Instance {
+
+	inst := &Instance{def: definition, id: id, outChannel: outChannel, logger: logger}
+	inst.stopped, inst.stop = context.WithCancel(context.Background())
+	inst.sm = inst.newStateManager(groupSettings)
+
+	return inst
 }
 
-func NewInstance(definition *Definition, id string, single bool, outChannel channels.Channel, logger log.Logger) *Instance {
+// NewPersistentInstance creates a new pipeline instance whose state is saved to the store, any state previously
+// saved to the store is restored. If checkpointInterval is 0 the state of a group is saved after every execution
+func NewPersistentInstance(definition *Definition, id string, groupSettings *GroupSettings, store StateStore, checkpointInterval time.Duration, outChannel channels.Channel, logger log.Logger) (*Instance, error) {
+
+	inst := &Instance{def: definition, id: id, outChannel: outChannel, logger: logger}
+	inst.stopped, inst.stop = context.WithCancel(context.Background())
+
+	inst.persistence = newPersistentStateManager(definition, store, checkpointInterval, logger)
+	inst.persistence.StateManager = inst.newStateManager(groupSettings)
+	inst.persistence.deleteOnEvict = groupSettings != nil && groupSettings.DeleteStateOnEvict
+	inst.sm = inst.persistence
+
+	err := inst.persistence.start()
+	if err != nil {
+		inst.persistence.StateManager.Close()
+		inst.stop()
+		return nil, err
+	}
+
+	return inst, nil
+}
 
-	var sm StateManager
+func (inst *Instance) newStateManager(groupSettings *GroupSettings) StateManager {
 
-	if single {
-		sm = NewSimpleStateManager()
-	} else {
-		sm = NewMultiStateManager()
+	if groupSettings == nil {
+		return NewSimpleStateManager()
 	}
 
-	return &Instance{def: definition, id: id, sm: sm, outChannel: outChannel, logger: logger}
+	inst.flushOnEvict = groupSettings.FlushOnEvict
+	return NewMultiStateManager(groupSettings, inst.onEvict)
 }
 
 func (inst *Instance) Id() string {
@@ -47,12 +86,64 @@ func (inst *Instance) PipelineId() string {
 
 //consider a start/stop instance?
 
+// Stop releases the state held by the instance, stopping all its timers, and cancels the executions in progress
+func (inst *Instance) Stop() {
+	if inst.stop != nil {
+		inst.stop()
+	}
+	inst.sm.Close()
+}
+
+func (inst *Instance) onEvict(discriminator string, state State) {
+
+	if inst.flushOnEvict {
+		inst.flush(discriminator, state)
+	}
+
+	if inst.persistence != nil {
+		inst.persistence.Evicted(discriminator, state)
+	}
+}
+
+// stateChanged is called after an execution that might have changed the state of its group
+func (inst *Instance) stateChanged(ctx *ExecutionContext) {
+	if inst.persistence != nil {
+		inst.persistence.Changed(ctx.discriminator, ctx.pipelineState())
+	}
+}
+
 func (inst *Instance) Run(discriminator string, input map[string]interface{}) (output map[string]interface{}, status ExecutionStatus, err error) {
+	return inst.RunContext(context.Background(), discriminator, input)
+}
+
+// RunContext runs the pipeline for the input, the execution is cancelled once goCtx is done, between stages
+// or while a stage with a timeout is evaluated
+func (inst *Instance) RunContext(goCtx context.Context, discriminator string, input map[string]interface{}) (output map[string]interface{}, status ExecutionStatus, err error) {
 
 	hasWork := true
 
+	ctx := inst.newExecution(goCtx, discriminator, inst.sm.GetState(discriminator), input)
+
+	unlock := lockExecution(ctx.pipelineState())
+	for hasWork {
+
+		hasWork, err = inst.DoStep(ctx, false)
+		if err != nil {
+			break
+		}
+	}
+	unlock()
+
+	inst.stateChanged(ctx)
+
+	return inst.result(ctx, err)
+}
+
+// newExecution creates the context of the execution of the pipeline for the input
+func (inst *Instance) newExecution(goCtx context.Context, discriminator string, state State, input map[string]interface{}) *ExecutionContext {
+
 	//if context logging enable, need to come up with a unique id for the execution
-	ctx := &ExecutionContext{discriminator: discriminator, pipeline: inst}
+	ctx := &ExecutionContext{discriminator: discriminator, pipeline: inst, runCtx: goCtx, state: state}
 	ctx.pipelineInput = input
 
 	//pipeline - current output is the input to the next stage
@@ -62,13 +153,11 @@ func (inst *Instance) Run(discriminator string, input map[string]interface{}) (o
 		t.PipelineStarted(inst.PipelineId(), inst.id, input)
 	}
 
-	for hasWork {
+	return ctx
+}
 
-		hasWork, err = inst.DoStep(ctx, false)
-		if err != nil {
-			break
-		}
-	}
+// result returns the result of the execution, err is the error its last step failed with
+func (inst *Instance) result(ctx *ExecutionContext, err error) (output map[string]interface{}, status ExecutionStatus, _ error) {
 
 	if ctx.status == ExecStatusCompleted {
 		if t := support.GetTelemetryService(); t != nil {
@@ -78,63 +167,142 @@ func (inst *Instance) Run(discriminator string, input map[string]interface{}) (o
 		return ctx.pipelineOutput, ctx.status, nil
 	}
 
-	if ctx.status == ExecStatusFailed {
+	if ctx.status == ExecStatusFailed || ctx.status == ExecStatusCancelled {
 		return nil, ctx.status, err
 	}
 
-	return nil, status, nil
+	return nil, ctx.status, nil
 }
 
 func (inst *Instance) DoStep(ctx *ExecutionContext, resume bool) (hasWork bool, err error) {
 
-	hasNext := false
-
 	if ctx.stageId < len(inst.def.stages) {
 
 		//if t := support.GetTelemetryService(); t != nil {
 		//	t.StageStarted(inst.PipelineId(), inst.id, strconv.Itoa(ctx.stageId), ctx.currentInput)
 		//}
 
+		if err = ctx.cancelled(); err != nil {
+			return inst.fail(ctx, ctx.currentOutput, err)
+		}
+
 		//get the stage to work on
 		done := false
+		input := ctx.currentOutput
+		execute := ExecuteCurrentStage
 		if resume {
-			done, err = ResumeCurrentStage(ctx)
-		} else {
-			done, err = ExecuteCurrentStage(ctx)
+			execute = ResumeCurrentStage
 		}
 
-		if t := support.GetTelemetryService(); t != nil  && done {
-			t.StageFinished(inst.PipelineId(), inst.id, strconv.Itoa(ctx.stageId), ctx.currentOutput)
+		done, err = execute(ctx)
+		if err != nil && !isCancelled(err) && ctx.currentStage().onError != nil {
+			done, err = inst.handleError(ctx, input, err, execute)
 		}
 
-		if err != nil {
-			inst.logger.Debugf("Pipeline[%s] - Execution failed - Error: %s", ctx.pipeline.id, err.Error())
-			ctx.status = ExecStatusFailed
-			return false, err
-		}
+		return inst.stageDone(ctx, input, done, err)
+	}
 
-		if !done {
-			inst.logger.Debugf("Pipeline[%s] - Partial Execution Completed", ctx.pipeline.id)
+	return false, nil
+}
 
-			ctx.UpdateTimers()
+// stageDone moves the execution on once its current stage has been executed, input is the output of
+// the previous stage, returns true if there is a stage left to execute
+func (inst *Instance) stageDone(ctx *ExecutionContext, input map[string]interface{}, done bool, err error) (hasNext bool, _ error) {
 
-			//stage has stalled so we are done working
-			ctx.status = ExecStatusStalled
-			return false, nil
-		}
+	if t := support.GetTelemetryService(); t != nil && done {
+		t.StageFinished(inst.PipelineId(), inst.id, strconv.Itoa(ctx.stageId), ctx.currentOutput)
+	}
 
-		ctx.stageId++
-		if ctx.stageId < len(inst.def.stages) {
-			hasNext = true
-		} else {
-			inst.logger.Debugf("Pipeline[%s] - Execution Completed", ctx.pipeline.id)
-			ctx.status = ExecStatusCompleted
+	if err != nil {
+		return inst.fail(ctx, input, err)
+	}
+
+	if ctx.status == ExecStatusDropped {
+		return false, nil
+	}
+
+	if !done {
+		inst.logger.Debugf("Pipeline[%s] - Partial Execution Completed", ctx.pipeline.id)
+
+		ctx.UpdateTimers()
+
+		//stage has stalled so we are done working
+		ctx.status = ExecStatusStalled
+		return false, nil
+	}
+
+	if split := ctx.currentStage().split; split != nil {
+		err = inst.split(ctx, split)
+		if err != nil {
+			return inst.fail(ctx, ctx.currentOutput, err)
 		}
+		return false, nil
+	}
+
+	hasNext, err = inst.advance(ctx)
+	if err != nil {
+		return inst.fail(ctx, ctx.currentOutput, err)
+	}
+
+	if !hasNext && ctx.err != nil {
+		//the error handler is done, the execution still fails
+		ctx.status = ExecStatusFailed
+		return false, ctx.err
+	}
+
+	if !hasNext {
+		inst.logger.Debugf("Pipeline[%s] - Execution Completed", ctx.pipeline.id)
+		ctx.status = ExecStatusCompleted
 	}
 
 	return hasNext, nil
 }
 
+// fail fails the execution with the error, if the pipeline has an error handler the execution continues with the
+// stages of the error handler, with data as their input, and fails once they are done. Errors of the error handler
+// fail the execution. Cancelled executions aren't handled by the error handler.
+func (inst *Instance) fail(ctx *ExecutionContext, data map[string]interface{}, err error) (hasNext bool, _ error) {
+
+	if isCancelled(err) {
+		inst.logger.Warnf("Pipeline[%s] - Execution cancelled - Error: %s", ctx.pipeline.id, err.Error())
+		ctx.status = ExecStatusCancelled
+		return false, err
+	}
+
+	inst.logger.Errorf("Pipeline[%s] - Execution failed - Error: %s", ctx.pipeline.id, err.Error())
+
+	if !inst.def.handlesErrors || ctx.err != nil {
+		ctx.status = ExecStatusFailed
+		return false, err
+	}
+
+	ctx.err = err
+	ctx.errorData = map[string]interface{}{"message": err.Error(), "stage": ctx.stageId, "input": ctx.pipelineInput}
+
+	ctx.currentOutput = data
+	ctx.stageId = inst.def.errorHandler
+
+	return true, nil
+}
+
+// advance moves the execution to the stage that follows the current stage, taking the branches of
+// the current stage into account, returns false if there is no stage left
+func (inst *Instance) advance(ctx *ExecutionContext) (hasNext bool, err error) {
+
+	next, err := ctx.currentStage().nextStage(ctx.stageId, &StageInputScope{execCtx: ctx})
+	if err != nil {
+		return false, err
+	}
+
+	if next == stageEnd || next >= len(inst.def.stages) {
+		ctx.stageId = len(inst.def.stages)
+		return false, nil
+	}
+
+	ctx.stageId = next
+	return true, nil
+}
+
 func ExecuteCurrentStage(ctx *ExecutionContext) (done bool, err error) {
 
 	logger := ctx.pipeline.logger
@@ -155,33 +323,23 @@ func ExecuteCurrentStage(ctx *ExecutionContext) (done bool, err error) {
 	//prevent re-execution of stage?
 	stage := ctx.currentStage()
 
-	if logger.DebugEnabled() {
-		logger.Debugf("Pipeline[%s] - Executing stage %d", ctx.pipeline.id, ctx.stageId)
-	}
-
-	if stage.inputMapper != nil {
-
-		in := &StageInputScope{execCtx: ctx}
-		ctx.currentInput, err = stage.inputMapper.Apply(in)
-		if err != nil {
-			return false, err
-		}
+	if stage.act == nil {
+		//the stage only routes, the output of the previous stage is passed on
+		return true, nil
 	}
 
-	if t := support.GetTelemetryService(); t != nil {
-		t.StageStarted(ctx.pipeline.PipelineId(), ctx.pipeline.id, strconv.Itoa(ctx.stageId), ctx.currentInput)
+	err = prepareStage(ctx, stage)
+	if err != nil {
+		return false, err
 	}
 
-	//clear previous output
-	ctx.currentOutput = make(map[string]interface{})
-
 	if logger.DebugEnabled() {
 		ref := activity.GetRef(stage.act)
 		logger.Debugf("Pipeline[%s] - Evaluating Activity", ref)
 	}
 
 	//eval activity/stage
-	done, err = stage.act.Eval(ctx)
+	done, err = evalStage(ctx, stage)
 
 	if done {
 		if stage.outputMapper != nil {
@@ -195,6 +353,32 @@ func ExecuteCurrentStage(ctx *ExecutionContext) (done bool, err error) {
 	return done, err
 }
 
+// prepareStage maps the input of the stage's activity for the execution and clears its previous output
+func prepareStage(ctx *ExecutionContext, stage *Stage) (err error) {
+
+	if logger := ctx.pipeline.logger; logger.DebugEnabled() {
+		logger.Debugf("Pipeline[%s] - Executing stage %d", ctx.pipeline.id, ctx.stageId)
+	}
+
+	if stage.inputMapper != nil {
+
+		in := &StageInputScope{execCtx: ctx}
+		ctx.currentInput, err = stage.inputMapper.Apply(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t := support.GetTelemetryService(); t != nil {
+		t.StageStarted(ctx.pipeline.PipelineId(), ctx.pipeline.id, strconv.Itoa(ctx.stageId), ctx.currentInput)
+	}
+
+	//clear previous output
+	ctx.currentOutput = make(map[string]interface{})
+
+	return nil
+}
+
 func Resume(ctx *ExecutionContext) error {
 
 	hasWork := true
@@ -202,6 +386,9 @@ func Resume(ctx *ExecutionContext) error {
 	inst := ctx.pipeline
 	var err error
 
+	//timers outlive the execution that created them, they are only cancelled by stopping the instance
+	ctx.runCtx = nil
+
 	resume := true
 	for hasWork {
 
@@ -219,6 +406,90 @@ func Resume(ctx *ExecutionContext) error {
 	return nil
 }
 
+// flush gives the stages of the pipeline the chance to emit the partial results they
+// hold for the group, the results are run through the rest of the pipeline
+func (inst *Instance) flush(discriminator string, state State) {
+
+	unlock := lockExecution(state)
+	defer unlock()
+
+	for stageId, stage := range inst.def.stages {
+
+		flusher, ok := stage.act.(support.Flusher)
+		if !ok {
+			continue
+		}
+
+		ctx := &ExecutionContext{discriminator: discriminator, pipeline: inst, state: state, stageId: stageId}
+
+		done, err := FlushCurrentStage(ctx, flusher)
+		if err != nil {
+			inst.logger.Errorf("Pipeline[%s] - Unable to flush stage %d for group '%s': %v", inst.id, stageId, discriminator, err)
+			continue
+		}
+
+		if !done {
+			continue
+		}
+
+		hasWork, err := inst.advance(ctx)
+		if err != nil {
+			inst.logger.Errorf("Pipeline[%s] - Unable to complete flush for group '%s': %v", inst.id, discriminator, err)
+			continue
+		}
+		if !hasWork {
+			ctx.status = ExecStatusCompleted
+		}
+
+		for hasWork {
+			hasWork, err = inst.DoStep(ctx, false)
+			if err != nil {
+				inst.logger.Errorf("Pipeline[%s] - Unable to complete flush for group '%s': %v", inst.id, discriminator, err)
+				break
+			}
+		}
+
+		if ctx.status == ExecStatusCompleted && inst.outChannel != nil {
+			inst.outChannel.Publish(ctx.pipelineOutput)
+		}
+	}
+}
+
+func FlushCurrentStage(ctx *ExecutionContext, flusher support.Flusher) (done bool, err error) {
+
+	logger := ctx.pipeline.logger
+
+	defer func() {
+		if r := recover(); r != nil {
+
+			err = fmt.Errorf("unhandled Error flushing stage '%s' : %v", "stage", r)
+			logger.Error(err)
+
+			// todo: useful for debugging
+			logger.Debugf("StackTrace: %s", debug.Stack())
+
+			done = false
+		}
+	}()
+
+	logger.Debugf("Pipeline[%s] - Flushing stage %d", ctx.pipeline.id, ctx.stageId)
+
+	ctx.currentOutput = make(map[string]interface{})
+
+	done = flusher.Flush(ctx)
+
+	if done {
+		if ctx.currentStage().outputMapper != nil {
+			err := applyOutputMapper(ctx)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return done, err
+}
+
 func ResumeCurrentStage(ctx *ExecutionContext) (done bool, err error) {
 
 	logger := ctx.pipeline.logger
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/project-flogo/core/engine/channels"
+)
+
+const (
+	onErrorFail       = "fail"
+	onErrorRetry      = "retry"
+	onErrorSkip       = "skip"
+	onErrorDrop       = "drop"
+	onErrorDeadLetter = "deadLetter"
+)
+
+// ErrorPolicyConfig is the configuration of the policy applied when the activity of a stage fails
+type ErrorPolicyConfig struct {
+	// Action is fail, retry, skip, drop or deadLetter, fail by default
+	Action string `json:"action"`
+	// Retries is the number of times the stage is retried, once the retries are exhausted the Then action is applied
+	Retries int `json:"retries,omitempty"`
+	// Backoff is the time in millis before the first retry, it is doubled for each following retry
+	Backoff int    `json:"backoff,omitempty"`
+	Then    string `json:"then,omitempty"`
+	// Channel is the engine channel the failed events are published to by the deadLetter action
+	Channel string `json:"channel,omitempty"`
+}
+
+// ErrorCounts are the number of times each action of the error policy of a stage was applied
+type ErrorCounts struct {
+	Failed       int64
+	Retried      int64
+	Skipped      int64
+	Dropped      int64
+	DeadLettered int64
+}
+
+type errorPolicy struct {
+	// counts is first so it is 64 bit aligned for the atomic operations
+	counts ErrorCounts
+
+	action  string
+	retries int
+	backoff time.Duration
+	then    string
+	channel channels.Channel
+}
+
+func newErrorPolicy(config *ErrorPolicyConfig) (*errorPolicy, error) {
+
+	if config == nil {
+		return nil, nil
+	}
+
+	policy := &errorPolicy{action: config.Action, retries: config.Retries, then: config.Then,
+		backoff: time.Duration(config.Backoff) * time.Millisecond}
+
+	if policy.action == "" {
+		policy.action = onErrorFail
+	}
+
+	if policy.action == onErrorRetry {
+		if policy.retries <= 0 {
+			return nil, fmt.Errorf("retries must be specified for error action '%s'", onErrorRetry)
+		}
+		if policy.then == "" {
+			policy.then = onErrorFail
+		}
+	} else if policy.then != "" {
+		return nil, fmt.Errorf("then is only supported by error action '%s'", onErrorRetry)
+	}
+
+	for _, action := range []string{policy.action, policy.then} {
+		switch action {
+		case "", onErrorFail, onErrorRetry, onErrorSkip, onErrorDrop:
+		case onErrorDeadLetter:
+			if config.Channel == "" {
+				return nil, fmt.Errorf("channel must be specified for error action '%s'", onErrorDeadLetter)
+			}
+			policy.channel = channels.Get(config.Channel)
+			if policy.channel == nil {
+				return nil, fmt.Errorf("engine channel '%s' not registered", config.Channel)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported error action: '%s'", action)
+		}
+	}
+
+	if policy.then == onErrorRetry {
+		return nil, fmt.Errorf("then can't be '%s'", onErrorRetry)
+	}
+
+	return policy, nil
+}
+
+func (p *errorPolicy) errorCounts() ErrorCounts {
+	return ErrorCounts{
+		Failed:       atomic.LoadInt64(&p.counts.Failed),
+		Retried:      atomic.LoadInt64(&p.counts.Retried),
+		Skipped:      atomic.LoadInt64(&p.counts.Skipped),
+		Dropped:      atomic.LoadInt64(&p.counts.Dropped),
+		DeadLettered: atomic.LoadInt64(&p.counts.DeadLettered),
+	}
+}
+
+// handleError applies the error policy of the current stage to the error of its execution, the stage must have
+// an error policy. Input is the output of the previous stage and execute executes the stage again when it is
+// retried. The error is returned if the execution fails, if the event is dropped the status of the execution
+// is set to ExecStatusDropped.
+func (inst *Instance) handleError(ctx *ExecutionContext, input map[string]interface{}, err error, execute func(ctx *ExecutionContext) (bool, error)) (done bool, _ error) {
+
+	policy := ctx.currentStage().onError
+	action := policy.action
+
+	if action == onErrorRetry {
+		backoff := policy.backoff
+
+		for i := 0; i < policy.retries; i++ {
+			atomic.AddInt64(&policy.counts.Retried, 1)
+			inst.logger.Debugf("Pipeline[%s] - Retrying stage %d - Error: %s", inst.id, ctx.stageId, err.Error())
+
+			if cancelErr := ctx.sleep(backoff); cancelErr != nil {
+				return false, cancelErr
+			}
+			backoff *= 2
+
+			ctx.currentOutput = input
+			done, err = execute(ctx)
+			if err == nil {
+				return done, nil
+			}
+		}
+
+		action = policy.then
+	}
+
+	switch action {
+	case onErrorSkip:
+		atomic.AddInt64(&policy.counts.Skipped, 1)
+		inst.logger.Warnf("Pipeline[%s] - Skipping stage %d - Error: %s", inst.id, ctx.stageId, err.Error())
+
+		//the following stages get the output of the previous stage
+		ctx.currentOutput = input
+		return true, nil
+	case onErrorDrop:
+		atomic.AddInt64(&policy.counts.Dropped, 1)
+		inst.logger.Warnf("Pipeline[%s] - Dropping event, stage %d failed - Error: %s", inst.id, ctx.stageId, err.Error())
+
+		ctx.status = ExecStatusDropped
+		return false, nil
+	case onErrorDeadLetter:
+		atomic.AddInt64(&policy.counts.DeadLettered, 1)
+		inst.logger.Debugf("Pipeline[%s] - Publishing event to dead letter channel, stage %d failed - Error: %s", inst.id, ctx.stageId, err.Error())
+
+		msg := map[string]interface{}{"pipeline": inst.PipelineId(), "instance": inst.id,
+			"discriminator": ctx.discriminator, "stage": ctx.stageId, "error": err.Error(), "input": ctx.pipelineInput, "data": input}
+		if !policy.channel.PublishNoWait(msg) {
+			inst.logger.Errorf("Pipeline[%s] - Unable to publish event to dead letter channel, channel is full, stage %d failed - Error: %s", inst.id, ctx.stageId, err.Error())
+		}
+
+		ctx.status = ExecStatusDropped
+		return false, nil
+	default:
+		atomic.AddInt64(&policy.counts.Failed, 1)
+		return false, err
+	}
+}
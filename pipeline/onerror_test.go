@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/engine/channels"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const onErrorDefinition = `{
+  "name": "onError",
+  "metadata": {
+    "input": [{"name": "tags", "type": "array"}],
+    "output": [{"name": "tags", "type": "array"}]
+  },
+  "stages": [
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "first"},
+      "input": {"tags": "=$.tags"}
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "flaky"},
+      "input": {"tags": "=$.tags"}
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "last"},
+      "input": {"tags": "=$.tags"},
+      "output": {"pipeline.tags": "=$.tags"}
+    }
+  ]
+}`
+
+// newOnErrorDefinition creates a pipeline whose second stage fails the number of times specified
+func newOnErrorDefinition(t *testing.T, fail int, onError *ErrorPolicyConfig) (*Definition, error) {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+
+	config.Stages[1].Settings["fail"] = fail
+	config.Stages[1].OnError = onError
+
+	return NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+}
+
+func runOnError(t *testing.T, def *Definition) (map[string]interface{}, ExecutionStatus, error) {
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	return inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+}
+
+func TestOnError_Fail(t *testing.T) {
+
+	def, err := newOnErrorDefinition(t, -1, nil)
+	assert.Nil(t, err)
+
+	output, status, err := runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusFailed, status)
+	assert.Nil(t, output)
+	_, hasPolicy := def.ErrorCounts()[1]
+	assert.False(t, hasPolicy)
+
+	def, err = newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "fail"})
+	assert.Nil(t, err)
+
+	output, status, err = runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, ExecStatusFailed, status)
+	assert.Nil(t, output)
+	assert.Equal(t, ErrorCounts{Failed: 1}, def.ErrorCounts()[1])
+}
+
+func TestOnError_Retry(t *testing.T) {
+
+	def, err := newOnErrorDefinition(t, 2, &ErrorPolicyConfig{Action: "retry", Retries: 3, Backoff: 1})
+	assert.Nil(t, err)
+
+	output, status, err := runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Equal(t, []interface{}{"first", "flaky", "last"}, output["tags"])
+	assert.Equal(t, ErrorCounts{Retried: 2}, def.ErrorCounts()[1])
+
+	//the then action is applied once the retries are exhausted
+	def, err = newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "retry", Retries: 2, Then: "skip"})
+	assert.Nil(t, err)
+
+	output, status, err = runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Equal(t, []interface{}{"first", "last"}, output["tags"])
+	assert.Equal(t, ErrorCounts{Retried: 2, Skipped: 1}, def.ErrorCounts()[1])
+}
+
+func TestOnError_RetryCancelled(t *testing.T) {
+
+	def, err := newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "retry", Retries: 3, Backoff: 10000})
+	assert.Nil(t, err)
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+
+	//the backoff is cut short once the execution is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, status, err := inst.RunContext(ctx, "", map[string]interface{}{"tags": []interface{}{}})
+	assert.True(t, isCancelled(err))
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.True(t, time.Since(start) < time.Second)
+
+	//or once the instance is stopped
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		inst.Stop()
+	}()
+
+	start = time.Now()
+	_, status, err = inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.True(t, isCancelled(err))
+	assert.Equal(t, ExecStatusCancelled, status)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+// resumeActivity stalls until resumed by a timer, resuming it fails
+type resumeActivity struct {
+}
+
+func (a *resumeActivity) Metadata() *activity.Metadata {
+	return tagActivityMd
+}
+
+func (a *resumeActivity) Eval(ctx activity.Context) (done bool, err error) {
+	return false, nil
+}
+
+func (a *resumeActivity) PostEval(ctx activity.Context, userData interface{}) (done bool, err error) {
+	return false, errors.New("resume failed")
+}
+
+func TestOnError_Resumed(t *testing.T) {
+
+	def, err := newOnErrorDefinition(t, 0, &ErrorPolicyConfig{Action: "retry", Retries: 1, Then: "drop"})
+	assert.Nil(t, err)
+	def.stages[1].act = &resumeActivity{}
+
+	inst := NewInstance(def, "1", nil, nil, log.RootLogger())
+	defer inst.Stop()
+
+	_, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusStalled, status)
+
+	//the error policy applies to the stage resumed by a timer
+	ctx := inst.newExecution(context.Background(), "", inst.sm.GetState(""), nil)
+	ctx.stageId = 1
+
+	err = Resume(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusDropped, ctx.status)
+	assert.Equal(t, ErrorCounts{Retried: 1, Dropped: 1}, def.ErrorCounts()[1])
+}
+
+func TestOnError_Drop(t *testing.T) {
+
+	def, err := newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "drop"})
+	assert.Nil(t, err)
+
+	output, status, err := runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusDropped, status)
+	assert.Nil(t, output)
+	assert.Equal(t, ErrorCounts{Dropped: 1}, def.ErrorCounts()[1])
+}
+
+func TestOnError_DeadLetter(t *testing.T) {
+
+	ch, err := channels.New("onerror-dead-letter", 5)
+	assert.Nil(t, err)
+
+	published := make(chan interface{}, 1)
+	err = ch.RegisterCallback(func(msg interface{}) { published <- msg })
+	assert.Nil(t, err)
+	err = channels.Start()
+	assert.Nil(t, err)
+	defer func() { _ = channels.Stop() }()
+
+	def, err := newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "deadLetter", Channel: "onerror-dead-letter"})
+	assert.Nil(t, err)
+
+	_, status, err := runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusDropped, status)
+	assert.Equal(t, ErrorCounts{DeadLettered: 1}, def.ErrorCounts()[1])
+
+	select {
+	case msg := <-published:
+		m := msg.(map[string]interface{})
+		assert.Equal(t, 1, m["stage"])
+		assert.Equal(t, "stage 'flaky' failed", m["error"])
+		assert.Equal(t, map[string]interface{}{"tags": []interface{}{}}, m["input"])
+		assert.Equal(t, map[string]interface{}{"tags": []interface{}{"first"}}, m["data"])
+	case <-time.After(time.Second):
+		t.Fatal("event not published to the dead letter channel")
+	}
+}
+
+func TestOnError_DeadLetterFull(t *testing.T) {
+
+	ch, err := channels.New("onerror-dead-letter-full", 5)
+	assert.Nil(t, err)
+
+	def, err := newOnErrorDefinition(t, -1, &ErrorPolicyConfig{Action: "deadLetter", Channel: "onerror-dead-letter-full"})
+	assert.Nil(t, err)
+	assert.NotNil(t, ch)
+
+	//nothing receives from the channel, the event is dropped instead of blocking the execution
+	def.stages[1].onError.channel = &publishedChannel{published: make(chan interface{})}
+
+	_, status, err := runOnError(t, def)
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusDropped, status)
+	assert.Equal(t, ErrorCounts{DeadLettered: 1}, def.ErrorCounts()[1])
+}
+
+func TestOnError_Invalid(t *testing.T) {
+
+	invalid := []*ErrorPolicyConfig{
+		{Action: "ignore"},
+		{Action: "retry"},
+		{Action: "retry", Retries: 1, Then: "retry"},
+		{Action: "skip", Then: "drop"},
+		{Action: "deadLetter"},
+		{Action: "deadLetter", Channel: "missing"},
+	}
+
+	for _, onError := range invalid {
+		_, err := newOnErrorDefinition(t, 0, onError)
+		assert.NotNil(t, err, onError.Action)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(onErrorDefinition), config)
+	assert.Nil(t, err)
+
+	config.Stages[1].Settings["fail"] = -1
+	err = json.Unmarshal([]byte(`[
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "handler"},
+      "input": {"tags": "=$.tags", "note": "=$error.message"}
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "input": {"tags": "=$.tags", "note": "=$error.stage"}
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "input": {"note": "=$error.input"}
+    }
+  ]`), &config.ErrorHandler)
+	assert.Nil(t, err)
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+
+	//the error handler follows the stages of the pipeline
+	assert.Len(t, def.stages, 6)
+	assert.Equal(t, 3, def.errorHandler)
+
+	output, status, err := runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, "stage 'flaky' failed", err.Error())
+	assert.Equal(t, ExecStatusFailed, status)
+	assert.Nil(t, output)
+
+	assert.Equal(t, "stage 'flaky' failed", def.stages[3].act.(*tagActivity).note)
+	assert.Equal(t, 1, def.stages[4].act.(*tagActivity).note)
+	assert.Equal(t, map[string]interface{}{"tags": []interface{}{}}, def.stages[5].act.(*tagActivity).note)
+
+	//errors of the error handler fail the execution
+	def.stages[4].act.(*tagActivity).fail = -1
+
+	_, status, err = runOnError(t, def)
+	assert.NotNil(t, err)
+	assert.Equal(t, "stage '' failed", err.Error())
+	assert.Equal(t, ExecStatusFailed, status)
+}
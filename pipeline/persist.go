@@ -0,0 +1,405 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/stream/pipeline/support"
+)
+
+// StateStore stores the serialized state of the groups of a pipeline instance
+type StateStore interface {
+	// Load loads the serialized state of all the stored groups
+	Load() (map[string][]byte, error)
+
+	// Save stores the serialized state of a group
+	Save(id string, state []byte) error
+
+	// Delete removes the state of a group
+	Delete(id string) error
+}
+
+const (
+	stateFilePrefix = "group-"
+	stateFileExt    = ".json"
+)
+
+// NewFileStateStore creates a StateStore that keeps a file per group in the specified directory
+func NewFileStateStore(dir string) (StateStore, error) {
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create state directory '%s': %s", dir, err.Error())
+	}
+
+	return &fileStateStore{dir: dir}, nil
+}
+
+type fileStateStore struct {
+	dir string
+}
+
+func (s *fileStateStore) Load() (map[string][]byte, error) {
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string][]byte, len(files))
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, stateFilePrefix) || !strings.HasSuffix(name, stateFileExt) {
+			continue
+		}
+
+		id, err := base64.RawURLEncoding.DecodeString(name[len(stateFilePrefix) : len(name)-len(stateFileExt)])
+		if err != nil {
+			logger.Warnf("Ignoring unrecognized state file '%s'", name)
+			continue
+		}
+
+		state, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		states[string(id)] = state
+	}
+
+	return states, nil
+}
+
+func (s *fileStateStore) Save(id string, state []byte) error {
+
+	path := s.path(id)
+
+	//write to a temp file first, so a crash never leaves a partially written state
+	tmpPath := path + ".tmp"
+	err := ioutil.WriteFile(tmpPath, state, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (s *fileStateStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileStateStore) path(id string) string {
+	return filepath.Join(s.dir, stateFilePrefix+base64.RawURLEncoding.EncodeToString([]byte(id))+stateFileExt)
+}
+
+// stateSnapshot is the serialized form of a State
+type stateSnapshot struct {
+	Scope  map[string]interface{}    `json:"scope,omitempty"`
+	Stages map[string]*stageSnapshot `json:"stages,omitempty"`
+}
+
+type stageSnapshot struct {
+	Ref            string          `json:"ref"`
+	Data           json.RawMessage `json:"data,omitempty"`
+	TickerDeadline *time.Time      `json:"tickerDeadline,omitempty"`
+	TimerDeadline  *time.Time      `json:"timerDeadline,omitempty"`
+}
+
+// snapshotState captures the pipeline scope and the shared data of the stateful stages
+func snapshotState(def *Definition, state State) (*stateSnapshot, error) {
+
+	snapshot := &stateSnapshot{}
+
+	if scope, ok := state.GetScope().(*SharedScope); ok {
+		values := scope.Values()
+		if len(values) > 0 {
+			snapshot.Scope = values
+		}
+	}
+
+	for stageId, stage := range def.stages {
+
+		if stage.act == nil {
+			continue
+		}
+
+		stageState := &stageSnapshot{Ref: activity.GetRef(stage.act)}
+
+		if stateful, ok := stage.act.(support.Stateful); ok {
+			data, err := stateful.SaveState(state.GetSharedData(stage.act))
+			if err != nil {
+				return nil, fmt.Errorf("unable to save state of stage %d: %s", stageId, err.Error())
+			}
+			stageState.Data = data
+		}
+
+		if holder, exists := state.GetTicker(stage.act); exists {
+			deadline := holder.Deadline()
+			stageState.TickerDeadline = &deadline
+		}
+
+		if holder, exists := state.GetTimer(stage.act); exists {
+			deadline := holder.Deadline()
+			stageState.TimerDeadline = &deadline
+		}
+
+		if stageState.Data == nil && stageState.TickerDeadline == nil && stageState.TimerDeadline == nil {
+			continue
+		}
+
+		if snapshot.Stages == nil {
+			snapshot.Stages = make(map[string]*stageSnapshot)
+		}
+		snapshot.Stages[strconv.Itoa(stageId)] = stageState
+	}
+
+	return snapshot, nil
+}
+
+// marshalState serializes the state of the group, the executions of the group are waited for so the state
+// isn't captured half way through an execution
+func marshalState(def *Definition, state State) ([]byte, error) {
+
+	unlock := lockSnapshot(state)
+	defer unlock()
+
+	snapshot, err := snapshotState(def, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(snapshot)
+}
+
+// restoreState restores the pipeline scope and the shared data of the stateful stages
+func restoreState(def *Definition, state State, snapshot *stateSnapshot) error {
+
+	scope := state.GetScope()
+	for name, value := range snapshot.Scope {
+		err := scope.SetValue(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for id, stageState := range snapshot.Stages {
+
+		stageId, err := strconv.Atoi(id)
+		if err != nil || stageId < 0 || stageId >= len(def.stages) {
+			logger.Warnf("Ignoring saved state for unknown stage '%s'", id)
+			continue
+		}
+
+		stage := def.stages[stageId]
+		if stage.act == nil {
+			logger.Warnf("Ignoring saved state for stage %d, it has no activity", stageId)
+			continue
+		}
+
+		if ref := activity.GetRef(stage.act); ref != stageState.Ref {
+			logger.Warnf("Ignoring saved state for stage %d, expected activity '%s' found '%s'", stageId, stageState.Ref, ref)
+			continue
+		}
+
+		if stateful, ok := stage.act.(support.Stateful); ok && stageState.Data != nil {
+			err = stateful.RestoreState(state.GetSharedData(stage.act), stageState.Data)
+			if err != nil {
+				return fmt.Errorf("unable to restore state of stage %d: %s", stageId, err.Error())
+			}
+		}
+
+		if ss, ok := state.(*simpleState); ok {
+			ss.restoreDeadlines(stage.act, stageState.TickerDeadline, stageState.TimerDeadline)
+		}
+	}
+
+	return nil
+}
+
+// newPersistentStateManager creates a StateManager that persists the states of the underlying manager to the store,
+// if checkpointInterval is 0 the state of a group is saved after every change
+func newPersistentStateManager(def *Definition, store StateStore, checkpointInterval time.Duration, logger log.Logger) *persistentStateManager {
+
+	sm := &persistentStateManager{def: def, store: store, interval: checkpointInterval, logger: logger}
+	sm.dirty = make(map[string]State)
+
+	return sm
+}
+
+type persistentStateManager struct {
+	StateManager
+
+	def           *Definition
+	store         StateStore
+	interval      time.Duration
+	deleteOnEvict bool
+	logger        log.Logger
+
+	dirtyMutex sync.Mutex
+	dirty      map[string]State
+
+	// saveMutex serializes the writes to the store
+	saveMutex sync.Mutex
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// start restores the states from the store and starts the periodic checkpoint
+func (p *persistentStateManager) start() error {
+
+	states, err := p.store.Load()
+	if err != nil {
+		return fmt.Errorf("unable to load stream state: %s", err.Error())
+	}
+
+	for id, data := range states {
+
+		snapshot := &stateSnapshot{}
+		err := json.Unmarshal(data, snapshot)
+		if err != nil {
+			return fmt.Errorf("unable to load state for group '%s': %s", id, err.Error())
+		}
+
+		err = restoreState(p.def, getRestoredState(p.StateManager, id), snapshot)
+		if err != nil {
+			return fmt.Errorf("unable to restore state for group '%s': %s", id, err.Error())
+		}
+	}
+
+	if len(states) > 0 {
+		p.logger.Infof("Restored state for %d group(s)", len(states))
+	}
+
+	if p.interval > 0 {
+		p.stop = make(chan struct{})
+		go p.checkpointPeriodically()
+	}
+
+	return nil
+}
+
+// Changed notifies the manager that the state of a group has changed
+func (p *persistentStateManager) Changed(id string, state State) {
+
+	if p.interval == 0 {
+		err := p.save(id, state)
+		if err != nil {
+			p.logger.Errorf("Unable to save state for group '%s': %v", id, err)
+		}
+		return
+	}
+
+	p.dirtyMutex.Lock()
+	p.dirty[id] = state
+	p.dirtyMutex.Unlock()
+}
+
+// Checkpoint saves the states that have changed since the last checkpoint
+func (p *persistentStateManager) Checkpoint() error {
+
+	p.dirtyMutex.Lock()
+	dirty := p.dirty
+	p.dirty = make(map[string]State)
+	p.dirtyMutex.Unlock()
+
+	for id, state := range dirty {
+		err := p.save(id, state)
+		if err != nil {
+			return fmt.Errorf("unable to save state for group '%s': %s", id, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Evicted notifies the manager that a group has been evicted, before its state is closed. The stored state of
+// the group is removed if deleteOnEvict, otherwise its unsaved changes are saved so it is restored on restart.
+func (p *persistentStateManager) Evicted(id string, state State) {
+
+	p.dirtyMutex.Lock()
+	_, changed := p.dirty[id]
+	delete(p.dirty, id)
+	p.dirtyMutex.Unlock()
+
+	if !p.deleteOnEvict {
+		if changed {
+			err := p.save(id, state)
+			if err != nil {
+				p.logger.Errorf("Unable to save state for group '%s': %v", id, err)
+			}
+		}
+		return
+	}
+
+	p.saveMutex.Lock()
+	defer p.saveMutex.Unlock()
+
+	err := p.store.Delete(id)
+	if err != nil {
+		p.logger.Errorf("Unable to delete state for group '%s': %v", id, err)
+	}
+}
+
+func (p *persistentStateManager) Close() {
+
+	p.closeOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+		}
+
+		err := p.Checkpoint()
+		if err != nil {
+			p.logger.Errorf("Unable to checkpoint stream state: %v", err)
+		}
+
+		p.StateManager.Close()
+	})
+}
+
+func (p *persistentStateManager) checkpointPeriodically() {
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			err := p.Checkpoint()
+			if err != nil {
+				p.logger.Errorf("Unable to checkpoint stream state: %v", err)
+			}
+		}
+	}
+}
+
+func (p *persistentStateManager) save(id string, state State) error {
+
+	data, err := marshalState(p.def, state)
+	if err != nil {
+		return err
+	}
+
+	p.saveMutex.Lock()
+	defer p.saveMutex.Unlock()
+
+	return p.store.Save(id, data)
+}
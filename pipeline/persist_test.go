@@ -0,0 +1,242 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const sdCount = "count"
+
+// statefulActivity counts the evaluations and persists the count
+type statefulActivity struct {
+}
+
+func (a *statefulActivity) Metadata() *activity.Metadata {
+	return &activity.Metadata{}
+}
+
+func (a *statefulActivity) Eval(ctx activity.Context) (done bool, err error) {
+	sharedData := ctx.GetSharedTempData()
+	count, _ := sharedData[sdCount].(int)
+	sharedData[sdCount] = count + 1
+	return true, nil
+}
+
+func (a *statefulActivity) SaveState(sharedData map[string]interface{}) ([]byte, error) {
+	count, ok := sharedData[sdCount].(int)
+	if !ok {
+		return nil, nil
+	}
+	return []byte(strconv.Itoa(count)), nil
+}
+
+func (a *statefulActivity) RestoreState(sharedData map[string]interface{}, state []byte) error {
+	count, err := strconv.Atoi(string(state))
+	sharedData[sdCount] = count
+	return err
+}
+
+func TestFileStateStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "stream-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStateStore(dir)
+	assert.Nil(t, err)
+
+	err = store.Save("", []byte("a"))
+	assert.Nil(t, err)
+	err = store.Save("device/1", []byte("b"))
+	assert.Nil(t, err)
+	err = store.Save("device/2", []byte("c"))
+	assert.Nil(t, err)
+
+	err = store.Delete("device/2")
+	assert.Nil(t, err)
+
+	states, err := store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"": []byte("a"), "device/1": []byte("b")}, states)
+}
+
+func TestPersistentInstance(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "stream-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	act := &statefulActivity{}
+	def := &Definition{id: "test", stages: []*Stage{{act: act}}}
+
+	store, err := NewFileStateStore(dir)
+	assert.Nil(t, err)
+
+	inst, err := NewPersistentInstance(def, "1", &GroupSettings{}, store, 0, nil, log.RootLogger())
+	assert.Nil(t, err)
+
+	err = inst.sm.GetState("a").GetScope().SetValue("last", "x")
+	assert.Nil(t, err)
+
+	_, _, err = inst.Run("a", nil)
+	assert.Nil(t, err)
+	_, _, err = inst.Run("a", nil)
+	assert.Nil(t, err)
+	_, _, err = inst.Run("b", nil)
+	assert.Nil(t, err)
+
+	inst.Stop()
+
+	//new instance restores the state
+	inst, err = NewPersistentInstance(def, "2", &GroupSettings{}, store, 0, nil, log.RootLogger())
+	assert.Nil(t, err)
+	defer inst.Stop()
+
+	assert.Equal(t, 2, inst.sm.GetState("a").GetSharedData(act)[sdCount])
+	assert.Equal(t, 1, inst.sm.GetState("b").GetSharedData(act)[sdCount])
+
+	last, exists := inst.sm.GetState("a").GetScope().GetValue("last")
+	assert.True(t, exists)
+	assert.Equal(t, "x", last)
+}
+
+func TestPersistentInstance_RestoreBounded(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "stream-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	act := &statefulActivity{}
+	def := &Definition{id: "test", stages: []*Stage{{act: act}}}
+
+	store, err := NewFileStateStore(dir)
+	assert.Nil(t, err)
+
+	inst, err := NewPersistentInstance(def, "1", &GroupSettings{}, store, 0, nil, log.RootLogger())
+	assert.Nil(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, _, err = inst.Run(id, nil)
+		assert.Nil(t, err)
+	}
+	inst.Stop()
+
+	//restoring more groups than the limit doesn't evict the restored groups
+	inst, err = NewPersistentInstance(def, "2", &GroupSettings{MaxGroups: 2}, store, 0, nil, log.RootLogger())
+	assert.Nil(t, err)
+	defer inst.Stop()
+
+	restored := make(map[string]interface{})
+	inst.sm.ForEach(func(id string, state State) {
+		restored[id] = state.GetSharedData(act)[sdCount]
+	})
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 1, "c": 1}, restored)
+
+	states, err := store.Load()
+	assert.Nil(t, err)
+	assert.Len(t, states, 3)
+}
+
+func TestPersistentInstance_ConcurrentCheckpoint(t *testing.T) {
+
+	act := &statefulActivity{}
+	def := &Definition{id: "test", stages: []*Stage{{act: act}}}
+
+	store := &memoryStateStore{states: make(map[string][]byte)}
+
+	inst, err := NewPersistentInstance(def, "1", &GroupSettings{}, store, time.Millisecond, nil, log.RootLogger())
+	assert.Nil(t, err)
+
+	//the periodic checkpoints snapshot the state while the events are executed
+	count := 0
+	for start := time.Now(); time.Since(start) < 50*time.Millisecond; count++ {
+		_, _, err = inst.Run("a", nil)
+		assert.Nil(t, err)
+	}
+	inst.Stop()
+
+	state, err := store.Load()
+	assert.Nil(t, err)
+	assert.Contains(t, string(state["a"]), `"data":`+strconv.Itoa(count))
+}
+
+func TestPersistentInstance_Evict(t *testing.T) {
+
+	act := &statefulActivity{}
+	def := &Definition{id: "test", stages: []*Stage{{act: act}}}
+
+	//the unsaved changes of an evicted group are saved, so its state is kept
+	store := &memoryStateStore{states: make(map[string][]byte)}
+
+	inst, err := NewPersistentInstance(def, "1", &GroupSettings{MaxGroups: 1}, store, time.Hour, nil, log.RootLogger())
+	assert.Nil(t, err)
+
+	for _, id := range []string{"a", "b"} {
+		_, _, err = inst.Run(id, nil)
+		assert.Nil(t, err)
+	}
+
+	states, err := store.Load()
+	assert.Nil(t, err)
+	assert.Contains(t, states, "a")
+	assert.NotContains(t, states, "b")
+	inst.Stop()
+
+	//the state of an evicted group is deleted if requested
+	store = &memoryStateStore{states: make(map[string][]byte)}
+
+	inst, err = NewPersistentInstance(def, "2", &GroupSettings{MaxGroups: 1, DeleteStateOnEvict: true}, store, 0, nil, log.RootLogger())
+	assert.Nil(t, err)
+	defer inst.Stop()
+
+	for _, id := range []string{"a", "b"} {
+		_, _, err = inst.Run(id, nil)
+		assert.Nil(t, err)
+	}
+
+	states, err = store.Load()
+	assert.Nil(t, err)
+	assert.NotContains(t, states, "a")
+	assert.Contains(t, states, "b")
+}
+
+// memoryStateStore keeps the states in memory
+type memoryStateStore struct {
+	mutex  sync.Mutex
+	states map[string][]byte
+}
+
+func (s *memoryStateStore) Load() (map[string][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	states := make(map[string][]byte, len(s.states))
+	for id, state := range s.states {
+		states[id] = state
+	}
+	return states, nil
+}
+
+func (s *memoryStateStore) Save(id string, state []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.states[id] = state
+	return nil
+}
+
+func (s *memoryStateStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.states, id)
+	return nil
+}
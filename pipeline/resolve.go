@@ -13,7 +13,8 @@ var pipelineRes = resolve.NewCompositeResolver(map[string]resolve.Resolver{
 	"env":      &resolve.EnvResolver{},
 	"property": &property.Resolver{},
 	"pipeline": &MultiScopeResolver{scopeId: ScopePipeline},
-	"passthru": &MultiScopeResolver{scopeId: ScopePassthru}})
+	"passthru": &MultiScopeResolver{scopeId: ScopePassthru},
+	"error":    &MultiScopeResolver{scopeId: ScopeError}})
 
 func GetDataResolver() resolve.CompositeResolver {
 	return pipelineRes
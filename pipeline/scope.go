@@ -11,12 +11,14 @@ const (
 	ScopeDefault ScopeId = iota
 	ScopePipeline
 	ScopePassthru
+	ScopeError
 )
 
 var scopeNames = [...]string{
 	"default",
 	"pipeline",
 	"passthru",
+	"error",
 }
 
 func (t ScopeId) String() string {
@@ -65,6 +67,18 @@ func (s *SharedScope) SetValue(name string, value interface{}) error {
 	return nil
 }
 
+// Values returns a copy of the values in the scope
+func (s *SharedScope) Values() map[string]interface{} {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+
+	values := make(map[string]interface{}, len(s.attrs))
+	for name, value := range s.attrs {
+		values[name] = value
+	}
+
+	return values
+}
 
 // SimpleScope is a basic implementation of a scope
 type StageInputScope struct {
@@ -97,6 +111,8 @@ func (s *StageInputScope) GetValueByScope(scopeId ScopeId, name string) (value i
 		attrs = s.execCtx.pipelineInput
 	case ScopePassthru:
 		attrs = s.execCtx.passThru
+	case ScopeError:
+		attrs = s.execCtx.errorData
 	}
 
 	attr, found := attrs[name]
@@ -137,6 +153,8 @@ func (s *StageOutputScope) GetValueByScope(scopeId ScopeId, name string) (value
 		attrs = s.execCtx.pipelineInput
 	case ScopePassthru:
 		attrs = s.execCtx.passThru
+	case ScopeError:
+		attrs = s.execCtx.errorData
 	}
 
 	attr, found := attrs[name]
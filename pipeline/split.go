@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/mapper"
+)
+
+const (
+	splitItem  = "item"
+	splitIndex = "index"
+)
+
+// splitter splits the output of a stage into the elements of an array, each element is passed to
+// the remaining stages as the output of the stage in its own execution
+type splitter struct {
+	items mapper.Mapper
+	// collect is the name of the pipeline output the outputs of the executions are collected
+	// into, if empty the output of each execution is published
+	collect string
+}
+
+func newSplitter(items, collect string, mf mapper.Factory) (*splitter, error) {
+
+	if !strings.HasPrefix(items, "=") {
+		//the name of an output of the stage
+		items = "=$." + items
+	}
+
+	m, err := mf.NewMapper(map[string]interface{}{"items": items})
+	if err != nil {
+		return nil, fmt.Errorf("invalid split '%s' : %s", items, err.Error())
+	}
+
+	return &splitter{items: m, collect: collect}, nil
+}
+
+// split executes the remaining stages for each element of the split of the current stage, the
+// outputs of the completed executions are either published or collected into the pipeline output
+func (inst *Instance) split(ctx *ExecutionContext, s *splitter) error {
+
+	results, err := s.items.Apply(&StageInputScope{execCtx: ctx})
+	if err != nil {
+		return fmt.Errorf("unable to evaluate split : %s", err.Error())
+	}
+
+	var items []interface{}
+	if results["items"] != nil {
+		items, err = coerce.ToArray(results["items"])
+		if err != nil {
+			return fmt.Errorf("unable to split value : %s", err.Error())
+		}
+	}
+
+	inst.logger.Debugf("Pipeline[%s] - Splitting stage %d into %d executions", inst.id, ctx.stageId, len(items))
+
+	var collected []interface{}
+	if s.collect != "" {
+		collected = make([]interface{}, 0, len(items))
+	}
+
+	for i, item := range items {
+
+		child := ctx.fork()
+		child.currentOutput[splitItem] = item
+		child.currentOutput[splitIndex] = i
+
+		hasWork, err := inst.advance(child)
+		if err != nil {
+			return err
+		}
+		if !hasWork {
+			child.status = ExecStatusCompleted
+		}
+
+		for hasWork {
+			hasWork, err = inst.DoStep(child, false)
+			if err != nil {
+				//the error handler has already been executed by the child
+				ctx.err = child.err
+				return err
+			}
+		}
+
+		if child.status != ExecStatusCompleted {
+			continue
+		}
+
+		if s.collect != "" {
+			collected = append(collected, child.pipelineOutput)
+		} else if inst.outChannel != nil {
+			inst.outChannel.Publish(child.pipelineOutput)
+		}
+	}
+
+	ctx.stageId = len(inst.def.stages)
+
+	if s.collect == "" {
+		ctx.status = ExecStatusSplit
+		return nil
+	}
+
+	output := make(map[string]interface{}, len(ctx.pipelineOutput)+1)
+	for name, value := range ctx.pipelineOutput {
+		output[name] = value
+	}
+	output[s.collect] = collected
+
+	ctx.pipelineOutput = output
+	ctx.status = ExecStatusCompleted
+
+	return nil
+}
+
+// fork creates a copy of the context to continue the execution independently, the current output,
+// pipeline output and passthru data are copied, the pipeline input and the group state are shared
+func (eCtx *ExecutionContext) fork() *ExecutionContext {
+
+	return &ExecutionContext{pipeline: eCtx.pipeline, discriminator: eCtx.discriminator, state: eCtx.state,
+		stageId: eCtx.stageId, status: eCtx.status, pipelineInput: eCtx.pipelineInput,
+		pipelineOutput: copyMap(eCtx.pipelineOutput), passThru: copyMap(eCtx.passThru),
+		currentInput: eCtx.currentInput, currentOutput: copyMap(eCtx.currentOutput), err: eCtx.err, errorData: eCtx.errorData, runCtx: eCtx.runCtx}
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+
+	if m == nil {
+		return make(map[string]interface{})
+	}
+
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
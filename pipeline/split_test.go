@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/project-flogo/core/data/mapper"
+	"github.com/project-flogo/core/engine/channels"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const splitDefinition = `{
+  "name": "split",
+  "metadata": {
+    "input": [{"name": "tags", "type": "array"}],
+    "output": [{"name": "tags", "type": "array"}, {"name": "results", "type": "array"}]
+  },
+  "stages": [
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "c"},
+      "input": {"tags": "=$.tags"},
+      "split": "tags"
+    },
+    {
+      "branches": [
+        {"name": "skip", "condition": "=$.item == \"b\"", "end": true}
+      ]
+    },
+    {
+      "ref": "github.com/project-flogo/stream/pipeline",
+      "settings": {"tag": "tagged"},
+      "input": {"tags": "=$.tags"},
+      "output": {"pipeline.tags": "=$.tags"}
+    }
+  ]
+}`
+
+// testChannel records the published messages
+type testChannel struct {
+	published []interface{}
+}
+
+func (c *testChannel) RegisterCallback(callback channels.OnMessage) error {
+	return nil
+}
+
+func (c *testChannel) Publish(msg interface{}) {
+	c.published = append(c.published, msg)
+}
+
+func (c *testChannel) PublishNoWait(msg interface{}) bool {
+	c.Publish(msg)
+	return true
+}
+
+func newSplitDefinition(t *testing.T, collect string) *Definition {
+
+	config := &DefinitionConfig{}
+	err := json.Unmarshal([]byte(splitDefinition), config)
+	assert.Nil(t, err)
+
+	config.Stages[0].Collect = collect
+
+	def, err := NewDefinition(config, mapper.NewFactory(GetDataResolver()), GetDataResolver())
+	assert.Nil(t, err)
+
+	return def
+}
+
+func TestSplit(t *testing.T) {
+
+	ch := &testChannel{}
+	inst := NewInstance(newSplitDefinition(t, ""), "1", nil, ch, log.RootLogger())
+	defer inst.Stop()
+
+	output, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{"a", "b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusSplit, status)
+	assert.Nil(t, output)
+
+	//each element is executed separately, the element "b" ends in a branch without output
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"tags": []interface{}{"a", "b", "c", "tagged"}},
+		map[string]interface{}{},
+		map[string]interface{}{"tags": []interface{}{"a", "b", "c", "tagged"}},
+	}, ch.published)
+}
+
+func TestSplit_Collect(t *testing.T) {
+
+	ch := &testChannel{}
+	inst := NewInstance(newSplitDefinition(t, "results"), "1", nil, ch, log.RootLogger())
+	defer inst.Stop()
+
+	output, status, err := inst.Run("", map[string]interface{}{"tags": []interface{}{"a", "b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Len(t, output["results"], 3)
+	assert.Empty(t, ch.published)
+
+	//the split of the pipeline with no tags has the single tag of the first stage
+	output, status, err = inst.Run("", map[string]interface{}{"tags": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStatusCompleted, status)
+	assert.Equal(t, []interface{}{map[string]interface{}{"tags": []interface{}{"c", "tagged"}}}, output["results"])
+}
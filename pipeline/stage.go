@@ -2,10 +2,13 @@ package pipeline
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/project-flogo/core/support"
 
 	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/mapper"
 	"github.com/project-flogo/core/data/resolve"
 	"github.com/project-flogo/core/support/log"
@@ -15,6 +18,9 @@ import (
 //	exists = struct{}{}
 //)
 
+// stageEnd is the id of the stage that follows the last stage, it ends the execution
+const stageEnd = -1
+
 type Stage struct {
 	act activity.Activity
 
@@ -24,12 +30,112 @@ type Stage struct {
 
 	inputMapper  mapper.Mapper
 	outputMapper mapper.Mapper
+
+	// next is the id of the stage that follows this stage, it is only set if the stage is routed,
+	// otherwise the stage is followed by the next stage of the pipeline
+	next     int
+	routed   bool
+	branches []*Branch
+	split    *splitter
+
+	onError *errorPolicy
+	// timeout is the time the activity of the stage has to complete its evaluation, no limit if 0
+	timeout time.Duration
 }
 
 type StageConfig struct {
 	*activity.Config
 
-	Promotions []string `json:"addToPipeline,omitempty"`
+	Promotions []string        `json:"addToPipeline,omitempty"`
+	Branches   []*BranchConfig `json:"branches,omitempty"`
+
+	// Split is the output of the stage, or an expression, whose elements are each passed to the remaining stages
+	Split string `json:"split,omitempty"`
+	// Collect is the pipeline output the outputs of the split executions are collected into
+	Collect string `json:"collect,omitempty"`
+
+	OnError *ErrorPolicyConfig `json:"onError,omitempty"`
+	// Timeout is the time in millis the activity has to complete its evaluation, the execution is cancelled if it doesn't
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// BranchConfig is the configuration of a branch of a stage, the stages of the branch are executed if
+// its condition is true. Unless End is set, the branch merges back into the stages following the stage.
+type BranchConfig struct {
+	Name      string         `json:"name"`
+	Condition string         `json:"condition,omitempty"`
+	Stages    []*StageConfig `json:"stages,omitempty"`
+	End       bool           `json:"end,omitempty"`
+}
+
+// Branch is a conditional sequence of stages, a branch without a condition is taken if no other branch is
+type Branch struct {
+	name      string
+	condition mapper.Mapper
+	// start is the id of the first stage of the branch
+	start int
+}
+
+func newBranch(config *BranchConfig, mf mapper.Factory) (*Branch, error) {
+
+	branch := &Branch{name: config.Name}
+
+	if config.Condition != "" {
+		condition := config.Condition
+		if condition[0] != '=' {
+			condition = "=" + condition
+		}
+
+		var err error
+		branch.condition, err = mf.NewMapper(map[string]interface{}{"condition": condition})
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition for branch '%s' : %s", config.Name, err.Error())
+		}
+	}
+
+	return branch, nil
+}
+
+// nextStage returns the id of the stage that follows the stage with the id, if the stage has branches
+// the first branch whose condition is true is taken, if none is the stage is followed by its next stage
+func (s *Stage) nextStage(id int, scope data.Scope) (int, error) {
+
+	var defaultBranch *Branch
+
+	for _, branch := range s.branches {
+		if branch.condition == nil {
+			if defaultBranch == nil {
+				defaultBranch = branch
+			}
+			continue
+		}
+
+		results, err := branch.condition.Apply(scope)
+		if err != nil {
+			return 0, fmt.Errorf("unable to evaluate condition of branch '%s' : %s", branch.name, err.Error())
+		}
+
+		taken, err := coerce.ToBool(results["condition"])
+		if err != nil {
+			return 0, fmt.Errorf("condition of branch '%s' must be a boolean : %s", branch.name, err.Error())
+		}
+
+		if taken {
+			logger.Debugf("Taking branch '%s'", branch.name)
+			return branch.start, nil
+		}
+	}
+
+	if defaultBranch != nil {
+		logger.Debugf("Taking branch '%s'", defaultBranch.name)
+		return defaultBranch.start, nil
+	}
+
+	if !s.routed {
+		return id + 1, nil
+	}
+
+	return s.next, nil
 }
 
 type initContextImpl struct {
@@ -67,6 +173,18 @@ func (ctx *initContextImpl) HostName() string {
 
 func NewStage(config *StageConfig, mf mapper.Factory, resolver resolve.CompositeResolver) (*Stage, error) {
 
+	routes := len(config.Branches) > 0 || config.Split != ""
+
+	if config.Config == nil || (config.Ref == "" && config.Type == "" && routes) {
+		if !routes {
+			return nil, fmt.Errorf("activity not specified for stage")
+		}
+
+		//a stage without an activity only routes or splits the output of the previous stage
+		stage := &Stage{}
+		return stage, stage.setSplit(config, mf)
+	}
+
 	if config.Ref == "" && config.Type != "" {
 		log.RootLogger().Warnf("stage configuration 'type' deprecated, use 'ref' in the future")
 		config.Ref = "#" + config.Type
@@ -101,8 +219,19 @@ func NewStage(config *StageConfig, mf mapper.Factory, resolver resolve.Composite
 		act = pa
 	}
 
+	onError, err := newErrorPolicy(config.OnError)
+	if err != nil {
+		return nil, fmt.Errorf("invalid onError for stage '%s' : %s", config.Ref, err.Error())
+	}
+
+	if config.Timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout for stage '%s' : %d", config.Ref, config.Timeout)
+	}
+
 	stage := &Stage{}
 	stage.act = act
+	stage.onError = onError
+	stage.timeout = time.Duration(config.Timeout) * time.Millisecond
 
 	settingsMd := act.Metadata().Settings
 
@@ -144,7 +273,22 @@ func NewStage(config *StageConfig, mf mapper.Factory, resolver resolve.Composite
 		stage.outputMapper = outputMapper
 	}
 
-	return stage, nil
+	return stage, stage.setSplit(config, mf)
+}
+
+func (s *Stage) setSplit(config *StageConfig, mf mapper.Factory) error {
+
+	if config.Split == "" {
+		if config.Collect != "" {
+			return fmt.Errorf("collect requires a split")
+		}
+		return nil
+	}
+
+	var err error
+	s.split, err = newSplitter(config.Split, config.Collect, mf)
+
+	return err
 }
 
 func resolveSettingValue(resolver resolve.CompositeResolver, setting string, value interface{}) interface{} {
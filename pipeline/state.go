@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"container/list"
 	"fmt"
 	"sync"
 	"time"
@@ -11,6 +12,12 @@ import (
 
 type StateManager interface {
 	GetState(id string) State
+
+	// ForEach calls fn for the state of every group held by the manager
+	ForEach(fn func(id string, state State))
+
+	// Close releases all the states held by the manager
+	Close()
 }
 
 type State interface {
@@ -30,15 +37,35 @@ type State interface {
 	GetTimer(act activity.Activity) (*TimerHolder, bool)
 
 	RemoveTimer(act activity.Activity) bool
+
+	// Close stops all the tickers and timers associated with the state
+	Close()
+}
+
+// GroupSettings are the settings used to bound the states kept for a grouped pipeline
+type GroupSettings struct {
+	// IdleTimeout is how long a group can go without an event before its state is evicted, 0 disables idle eviction
+	IdleTimeout time.Duration
+
+	// MaxGroups is the maximum number of groups to keep state for, the least recently used group is evicted
+	// when it is exceeded, 0 means unbounded
+	MaxGroups int
+
+	// FlushOnEvict indicates that stages should emit their partial results before a group is evicted
+	FlushOnEvict bool
+
+	// DeleteStateOnEvict indicates that the persisted state of a group is deleted when it is evicted,
+	// otherwise it is kept and restored on restart
+	DeleteStateOnEvict bool
 }
 
+// EvictionHandler is called before the state of an evicted group is closed
+type EvictionHandler func(id string, state State)
+
 func NewSimpleStateManager() StateManager {
 
 	//tickers map[activity.Activity]*time.Ticker
-	//todo optimize so only created for activities that need it
-	state := &simpleState{scope: &SharedScope{}, sharedData: make(map[activity.Activity]map[string]interface{}), mutex: &sync.RWMutex{}}
-
-	return &singleStateManager{state: state}
+	return &singleStateManager{state: newSimpleState()}
 }
 
 type singleStateManager struct {
@@ -49,43 +76,256 @@ func (p *singleStateManager) GetState(id string) State {
 	return p.state
 }
 
-func NewMultiStateManager() StateManager {
-	return &multiStateManager{states: make(map[string]State)}
+func (p *singleStateManager) ForEach(fn func(id string, state State)) {
+	fn("", p.state)
+}
+
+func (p *singleStateManager) Close() {
+	p.state.Close()
+}
+
+// NewMultiStateManager creates a state manager that keeps a state per group, settings and onEvict are optional
+func NewMultiStateManager(settings *GroupSettings, onEvict EvictionHandler) StateManager {
+	sm := &multiStateManager{states: make(map[string]*groupEntry), onEvict: onEvict}
+
+	if settings != nil {
+		sm.maxGroups = settings.MaxGroups
+		sm.idleTimeout = settings.IdleTimeout
+	}
+
+	if sm.maxGroups > 0 || sm.idleTimeout > 0 {
+		sm.lru = list.New()
+	}
+
+	if sm.idleTimeout > 0 {
+		sm.stop = make(chan struct{})
+
+		interval := sm.idleTimeout / 2
+		if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+		go sm.sweep(interval)
+	}
+
+	return sm
 }
 
 type multiStateManager struct {
-	states map[string]State
+	states map[string]*groupEntry
 
 	//tickers map[activity.Activity]*time.Ticker
 	//repeating timer
 	// ticker with slice of callbacks
 	// add callback
 
+	// lru is only tracked when the manager is bounded, most recently used group is at the front
+	lru         *list.List
+	maxGroups   int
+	idleTimeout time.Duration
+	onEvict     EvictionHandler
+	stop        chan struct{}
+	closeOnce   sync.Once
+
 	rwMutex sync.RWMutex
 }
 
+type groupEntry struct {
+	id         string
+	state      State
+	lastAccess time.Time
+	element    *list.Element
+}
+
 func (p *multiStateManager) GetState(id string) State {
 
+	if p.lru != nil {
+		return p.getBoundedState(id)
+	}
+
 	p.rwMutex.RLock()
 	//fast path
-	if state, exist := p.states[id]; exist {
+	if entry, exist := p.states[id]; exist {
 		p.rwMutex.RUnlock()
-		return state
+		return entry.state
 	}
 	p.rwMutex.RUnlock()
 
 	p.rwMutex.Lock()
 	defer p.rwMutex.Unlock()
 
-	state, exist := p.states[id]
+	entry, exist := p.states[id]
+
+	if !exist {
+		entry = &groupEntry{id: id, state: newSimpleState()}
+		p.states[id] = entry
+	}
+
+	return entry.state
+}
+
+func (p *multiStateManager) getBoundedState(id string) State {
+
+	now := time.Now()
+
+	p.rwMutex.Lock()
+
+	entry, exist := p.states[id]
+	if exist {
+		entry.lastAccess = now
+		p.lru.MoveToFront(entry.element)
+		p.rwMutex.Unlock()
+
+		return entry.state
+	}
+
+	entry = &groupEntry{id: id, state: newSimpleState(), lastAccess: now}
+	entry.element = p.lru.PushFront(entry)
+	p.states[id] = entry
+
+	var evicted []*groupEntry
+	if p.maxGroups > 0 {
+		for len(p.states) > p.maxGroups {
+			evicted = append(evicted, p.remove(p.lru.Back()))
+		}
+	}
+
+	p.rwMutex.Unlock()
+
+	p.evict(evicted)
+
+	return entry.state
+}
+
+// getRestoredState gets the state a group is restored into, the group is added without evicting other groups
+// so that the restored groups don't evict each other, the limits apply once the groups are accessed
+func (p *multiStateManager) getRestoredState(id string) State {
+
+	p.rwMutex.Lock()
+	defer p.rwMutex.Unlock()
 
+	entry, exist := p.states[id]
 	if !exist {
-		//todo optimize so only created for activities that need it
-		state = &simpleState{scope: &SharedScope{}, sharedData: make(map[activity.Activity]map[string]interface{}), mutex: &sync.RWMutex{}}
-		p.states[id] = state
+		entry = &groupEntry{id: id, state: newSimpleState(), lastAccess: time.Now()}
+		if p.lru != nil {
+			entry.element = p.lru.PushFront(entry)
+		}
+		p.states[id] = entry
 	}
 
-	return state
+	return entry.state
+}
+
+// getRestoredState gets the state of the group from the manager to restore it, bounded managers don't evict
+// other groups to make room for it
+func getRestoredState(sm StateManager, id string) State {
+
+	switch m := sm.(type) {
+	case *persistentStateManager:
+		return getRestoredState(m.StateManager, id)
+	case *multiStateManager:
+		return m.getRestoredState(id)
+	}
+
+	return sm.GetState(id)
+}
+
+// sweep periodically evicts the groups that have been idle longer than the idle timeout
+func (p *multiStateManager) sweep(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.evictIdle(now)
+		}
+	}
+}
+
+func (p *multiStateManager) evictIdle(now time.Time) {
+
+	var evicted []*groupEntry
+
+	p.rwMutex.Lock()
+	for e := p.lru.Back(); e != nil; {
+		entry := e.Value.(*groupEntry)
+		if now.Sub(entry.lastAccess) < p.idleTimeout {
+			//the rest of the groups have been used more recently
+			break
+		}
+
+		prev := e.Prev()
+		evicted = append(evicted, p.remove(e))
+		e = prev
+	}
+	p.rwMutex.Unlock()
+
+	p.evict(evicted)
+}
+
+// remove removes the group from the manager, rwMutex must be held
+func (p *multiStateManager) remove(e *list.Element) *groupEntry {
+	entry := p.lru.Remove(e).(*groupEntry)
+	delete(p.states, entry.id)
+
+	return entry
+}
+
+func (p *multiStateManager) evict(entries []*groupEntry) {
+	for _, entry := range entries {
+
+		if logger.DebugEnabled() {
+			logger.Debugf("Evicting state for group '%s'", entry.id)
+		}
+
+		if p.onEvict != nil {
+			p.onEvict(entry.id, entry.state)
+		}
+		entry.state.Close()
+	}
+}
+
+func (p *multiStateManager) ForEach(fn func(id string, state State)) {
+
+	p.rwMutex.RLock()
+	entries := make([]*groupEntry, 0, len(p.states))
+	for _, entry := range p.states {
+		entries = append(entries, entry)
+	}
+	p.rwMutex.RUnlock()
+
+	for _, entry := range entries {
+		fn(entry.id, entry.state)
+	}
+}
+
+func (p *multiStateManager) Close() {
+
+	p.closeOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+		}
+	})
+
+	p.rwMutex.Lock()
+	states := p.states
+	p.states = make(map[string]*groupEntry)
+	if p.lru != nil {
+		p.lru.Init()
+	}
+	p.rwMutex.Unlock()
+
+	for _, entry := range states {
+		entry.state.Close()
+	}
+}
+
+func newSimpleState() *simpleState {
+	//todo optimize so only created for activities that need it
+	return &simpleState{scope: &SharedScope{}, sharedData: make(map[activity.Activity]map[string]interface{}), mutex: &sync.RWMutex{}}
 }
 
 type simpleState struct {
@@ -97,7 +337,93 @@ type simpleState struct {
 	tickers map[activity.Activity]*TickerHolder
 	timers  map[activity.Activity]*TimerHolder
 
+	// deadlines of restored timers, used to align the timers when they are recreated
+	tickerDeadlines map[activity.Activity]time.Time
+	timerDeadlines  map[activity.Activity]time.Time
+
 	mutex *sync.RWMutex
+
+	// execLock is held for reading by the executions of the group and for writing while the state is
+	// snapshotted or restored, so a snapshot never sees an execution half done
+	execLock sync.RWMutex
+
+	// abandoned are closed once the evaluations abandoned by the executions of the group complete
+	abandoned []chan struct{}
+}
+
+// lockExecution locks the state for an execution of its group, executions of the group can run concurrently
+func lockExecution(state State) (unlock func()) {
+
+	ss, ok := state.(*simpleState)
+	if !ok {
+		return func() {}
+	}
+
+	ss.execLock.RLock()
+	return ss.execLock.RUnlock
+}
+
+// lockSnapshot locks the state once the executions of its group are done, until it is unlocked no execution
+// of the group can start
+func lockSnapshot(state State) (unlock func()) {
+
+	ss, ok := state.(*simpleState)
+	if !ok {
+		return func() {}
+	}
+
+	ss.execLock.Lock()
+	waitAbandoned(ss)
+
+	return ss.execLock.Unlock
+}
+
+// abandonEval registers an evaluation abandoned by an execution of the group, completed is closed once it completes
+func abandonEval(state State, completed chan struct{}) {
+
+	ss, ok := state.(*simpleState)
+	if !ok {
+		return
+	}
+
+	ss.mutex.Lock()
+	ss.abandoned = append(ss.abandoned, completed)
+	ss.mutex.Unlock()
+}
+
+// waitAbandoned waits for the evaluations abandoned by the executions of the group to complete, so
+// they don't change the state of the group alongside the evaluations that follow them
+func waitAbandoned(state State) {
+
+	ss, ok := state.(*simpleState)
+	if !ok {
+		return
+	}
+
+	for {
+		ss.mutex.Lock()
+		for len(ss.abandoned) > 0 && isClosed(ss.abandoned[0]) {
+			ss.abandoned = ss.abandoned[1:]
+		}
+		if len(ss.abandoned) == 0 {
+			ss.abandoned = nil
+			ss.mutex.Unlock()
+			return
+		}
+		completed := ss.abandoned[0]
+		ss.mutex.Unlock()
+
+		<-completed
+	}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
 }
 
 func (s *simpleState) GetScope() data.Scope {
@@ -125,6 +451,9 @@ func (s *simpleState) GetSharedData(act activity.Activity) map[string]interface{
 
 func (s *simpleState) NewTicker(act activity.Activity, interval time.Duration) (*TickerHolder, error) {
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.tickers == nil {
 		s.tickers = make(map[activity.Activity]*TickerHolder)
 	} else {
@@ -134,8 +463,18 @@ func (s *simpleState) NewTicker(act activity.Activity, interval time.Duration) (
 		}
 	}
 
-	ticker := time.NewTicker(interval)
-	holder := &TickerHolder{mutex: &sync.RWMutex{}, ticker: ticker}
+	holder := &TickerHolder{mutex: &sync.RWMutex{}, interval: interval, done: make(chan struct{})}
+
+	if deadline, restored := s.tickerDeadlines[act]; restored {
+		//delay the start of the ticker so that it is aligned with its restored deadline
+		delete(s.tickerDeadlines, act)
+		holder.start = deadline
+		holder.delay = time.NewTimer(untilDeadline(deadline))
+	} else {
+		holder.start = time.Now()
+		holder.ticker = time.NewTicker(interval)
+	}
+
 	s.tickers[act] = holder
 
 	return holder, nil
@@ -143,6 +482,9 @@ func (s *simpleState) NewTicker(act activity.Activity, interval time.Duration) (
 
 func (s *simpleState) GetTicker(act activity.Activity) (*TickerHolder, bool) {
 
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	if s.tickers == nil {
 		return nil, false
 	}
@@ -154,13 +496,16 @@ func (s *simpleState) GetTicker(act activity.Activity) (*TickerHolder, bool) {
 
 func (s *simpleState) RemoveTicker(act activity.Activity) bool {
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.tickers == nil {
 		return false
 	}
 
 	holder, exists := s.tickers[act]
 	if exists {
-		holder.ticker.Stop()
+		holder.stop()
 		delete(s.tickers, act)
 		return true
 	}
@@ -170,17 +515,26 @@ func (s *simpleState) RemoveTicker(act activity.Activity) bool {
 
 func (s *simpleState) NewTimer(act activity.Activity, interval time.Duration) (*TimerHolder, error) {
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.timers == nil {
 		s.timers = make(map[activity.Activity]*TimerHolder)
 	} else {
-		_, exists := s.tickers[act]
+		_, exists := s.timers[act]
 		if exists {
 			return nil, fmt.Errorf("multiple timers not supported, timer already exists for this activity")
 		}
 	}
 
-	timer := time.NewTimer(interval)
-	holder := &TimerHolder{mutex: &sync.RWMutex{}, timer: timer}
+	deadline := time.Now().Add(interval)
+	if restored, exists := s.timerDeadlines[act]; exists {
+		delete(s.timerDeadlines, act)
+		deadline = restored
+	}
+
+	timer := time.NewTimer(untilDeadline(deadline))
+	holder := &TimerHolder{mutex: &sync.RWMutex{}, timer: timer, interval: interval, deadline: deadline, done: make(chan struct{})}
 	s.timers[act] = holder
 
 	return holder, nil
@@ -188,6 +542,9 @@ func (s *simpleState) NewTimer(act activity.Activity, interval time.Duration) (*
 
 func (s *simpleState) GetTimer(act activity.Activity) (*TimerHolder, bool) {
 
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	if s.timers == nil {
 		return nil, false
 	}
@@ -199,13 +556,16 @@ func (s *simpleState) GetTimer(act activity.Activity) (*TimerHolder, bool) {
 
 func (s *simpleState) RemoveTimer(act activity.Activity) bool {
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.timers == nil {
 		return false
 	}
 
 	holder, exists := s.timers[act]
 	if exists {
-		holder.GetTimer().Stop()
+		holder.stop()
 		delete(s.timers, act)
 		return true
 	}
@@ -213,16 +573,118 @@ func (s *simpleState) RemoveTimer(act activity.Activity) bool {
 	return false
 }
 
+func (s *simpleState) Close() {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for act, holder := range s.tickers {
+		holder.stop()
+		delete(s.tickers, act)
+	}
+
+	for act, holder := range s.timers {
+		holder.stop()
+		delete(s.timers, act)
+	}
+}
+
+// restoreDeadlines sets the deadlines the timers of the activity should be aligned to when they are recreated
+func (s *simpleState) restoreDeadlines(act activity.Activity, tickerDeadline, timerDeadline *time.Time) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if tickerDeadline != nil {
+		if s.tickerDeadlines == nil {
+			s.tickerDeadlines = make(map[activity.Activity]time.Time)
+		}
+		s.tickerDeadlines[act] = *tickerDeadline
+	}
+
+	if timerDeadline != nil {
+		if s.timerDeadlines == nil {
+			s.timerDeadlines = make(map[activity.Activity]time.Time)
+		}
+		s.timerDeadlines[act] = *timerDeadline
+	}
+}
+
+// untilDeadline returns the duration until the deadline, deadlines that have passed fire immediately
+func untilDeadline(deadline time.Time) time.Duration {
+	d := time.Until(deadline)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
 type TickerHolder struct {
-	ticker  *time.Ticker
-	execCtx *ExecutionContext
-	mutex   *sync.RWMutex
+	ticker   *time.Ticker
+	interval time.Duration
+	start    time.Time
+	execCtx  *ExecutionContext
+	mutex    *sync.RWMutex
+	done     chan struct{}
+
+	// delay is set if the start of the ticker is delayed to align it with a restored deadline
+	delay *time.Timer
 }
 
 func (t *TickerHolder) GetTicker() *time.Ticker {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.ticker
 }
 
+// Done is closed when the ticker has been stopped
+func (t *TickerHolder) Done() <-chan struct{} {
+	return t.done
+}
+
+// Deadline returns the time the ticker will fire next
+func (t *TickerHolder) Deadline() time.Time {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	elapsed := time.Since(t.start)
+	if elapsed < 0 {
+		return t.start
+	}
+
+	return t.start.Add((elapsed/t.interval + 1) * t.interval)
+}
+
+// startDelayed starts a delayed ticker, returns false if the ticker has been stopped
+func (t *TickerHolder) startDelayed() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.done:
+		return false
+	default:
+	}
+
+	t.start = time.Now()
+	t.ticker = time.NewTicker(t.interval)
+	return true
+}
+
+func (t *TickerHolder) stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.delay != nil {
+		t.delay.Stop()
+	}
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+	close(t.done)
+}
+
 func (t *TickerHolder) SetLastExecCtx(ctx *ExecutionContext) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -231,8 +693,8 @@ func (t *TickerHolder) SetLastExecCtx(ctx *ExecutionContext) {
 }
 
 func (t *TickerHolder) GetLastExecCtx() *ExecutionContext {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
 	ctx := t.execCtx
 	t.execCtx = nil
@@ -241,15 +703,33 @@ func (t *TickerHolder) GetLastExecCtx() *ExecutionContext {
 }
 
 type TimerHolder struct {
-	timer   *time.Timer
-	execCtx *ExecutionContext
-	mutex   *sync.RWMutex
+	timer    *time.Timer
+	interval time.Duration
+	deadline time.Time
+	execCtx  *ExecutionContext
+	mutex    *sync.RWMutex
+	done     chan struct{}
 }
 
 func (t *TimerHolder) GetTimer() *time.Timer {
 	return t.timer
 }
 
+// Deadline returns the time the timer fires
+func (t *TimerHolder) Deadline() time.Time {
+	return t.deadline
+}
+
+// Done is closed when the timer has been stopped
+func (t *TimerHolder) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *TimerHolder) stop() {
+	t.timer.Stop()
+	close(t.done)
+}
+
 func (t *TimerHolder) SetLastExecCtx(ctx *ExecutionContext) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
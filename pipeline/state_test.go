@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiStateManager_MaxGroups(t *testing.T) {
+
+	var evicted []string
+	sm := NewMultiStateManager(&GroupSettings{MaxGroups: 2}, func(id string, state State) {
+		evicted = append(evicted, id)
+	})
+	defer sm.Close()
+
+	s1 := sm.GetState("a")
+	sm.GetState("b")
+
+	//touch a, so b is the least recently used
+	assert.True(t, s1 == sm.GetState("a"))
+
+	sm.GetState("c")
+	assert.Equal(t, []string{"b"}, evicted)
+
+	//a is retained
+	assert.True(t, s1 == sm.GetState("a"))
+
+	sm.GetState("b")
+	assert.Equal(t, []string{"b", "c"}, evicted)
+}
+
+func TestMultiStateManager_IdleTimeout(t *testing.T) {
+
+	var mutex sync.Mutex
+	var evicted []string
+
+	sm := NewMultiStateManager(&GroupSettings{IdleTimeout: 20 * time.Millisecond}, func(id string, state State) {
+		mutex.Lock()
+		evicted = append(evicted, id)
+		mutex.Unlock()
+	})
+	defer sm.Close()
+
+	s1 := sm.GetState("a")
+	holder, err := s1.NewTicker(nil, time.Hour)
+	assert.Nil(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, []string{"a"}, evicted)
+	mutex.Unlock()
+
+	//evicting the state stops its tickers
+	select {
+	case <-holder.Done():
+	default:
+		assert.Fail(t, "ticker not stopped")
+	}
+
+	//a new state is created for the group
+	assert.False(t, s1 == sm.GetState("a"))
+}
+
+func TestMultiStateManager_Unbounded(t *testing.T) {
+
+	sm := NewMultiStateManager(nil, nil)
+	defer sm.Close()
+
+	s1 := sm.GetState("a")
+	assert.True(t, s1 == sm.GetState("a"))
+	assert.False(t, s1 == sm.GetState("b"))
+}
+
+func TestExecutionContext_PipelineState(t *testing.T) {
+
+	inst := NewInstance(&Definition{}, "1", &GroupSettings{}, nil, nil)
+	defer inst.Stop()
+
+	//a context created without its state gets the state of its group
+	ctx := &ExecutionContext{pipeline: inst, discriminator: "a"}
+	assert.True(t, inst.sm.GetState("a") == ctx.pipelineState())
+	assert.True(t, ctx.state == ctx.pipelineState())
+}
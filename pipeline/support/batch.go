@@ -0,0 +1,13 @@
+package support
+
+import (
+	"github.com/project-flogo/core/activity"
+)
+
+// BatchActivity is implemented by activities that can evaluate the events of a micro-batch at once, the
+// contexts of the events all belong to the same group. Activities that don't implement it are evaluated
+// for each event of the batch.
+type BatchActivity interface {
+	// EvalBatch evaluates the events of the batch, returns for each event if the pipeline should proceed
+	EvalBatch(ctxs []activity.Context) (done []bool, err error)
+}
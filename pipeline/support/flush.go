@@ -0,0 +1,12 @@
+package support
+
+import (
+	"github.com/project-flogo/core/activity"
+)
+
+// Flusher is implemented by activities that hold partial results for a group, it is used to emit
+// those results before the state of the group is discarded
+type Flusher interface {
+	// Flush sets the partial results as the activity outputs, returns true if the pipeline should proceed
+	Flush(ctx activity.Context) (proceed bool)
+}
@@ -0,0 +1,45 @@
+package support
+
+import (
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+)
+
+// sharedStateMutexes are the locks guarding the creation of the states each activity keeps in the shared temp data
+var sharedStateMutexes sync.Map
+
+// GetSharedState gets the state the activity keeps in the shared temp data of the context under the name,
+// creating it using newState if it doesn't exist, concurrent executions get the same state
+func GetSharedState(act activity.Activity, ctx activity.Context, name string, newState func() interface{}) interface{} {
+
+	sharedData := ctx.GetSharedTempData()
+
+	m, _ := sharedStateMutexes.LoadOrStore(act, &sync.RWMutex{})
+	mutex := m.(*sync.RWMutex)
+
+	mutex.RLock()
+	state, exists := sharedData[name]
+	mutex.RUnlock()
+
+	if exists {
+		return state
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state, exists = sharedData[name]
+	if !exists {
+		state = newState()
+		sharedData[name] = state
+	}
+
+	return state
+}
+
+// NowMillis returns the current time in millis since the epoch
+func NowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,11 @@
+package support
+
+// Stateful is implemented by activities that can persist the shared data they keep for a group,
+// it is used to restore the activity's state after a restart
+type Stateful interface {
+	// SaveState returns the serialized form of the activity's shared data, nil if there is nothing to save
+	SaveState(sharedData map[string]interface{}) ([]byte, error)
+
+	// RestoreState restores the activity's shared data from its serialized form
+	RestoreState(sharedData map[string]interface{}, state []byte) error
+}
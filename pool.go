@@ -0,0 +1,252 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/project-flogo/core/action"
+)
+
+const (
+	// ModeUnbounded executes each event in its own goroutine
+	ModeUnbounded = "unbounded"
+	// ModePool executes the events using a bounded pool of workers sharing a queue
+	ModePool = "pool"
+	// ModeOrdered executes the events using a bounded pool of workers, the events of a group are
+	// always executed by the same worker so they are executed serially in the order they arrived
+	ModeOrdered = "ordered"
+
+	// QueueFullBlock blocks the trigger until there is room in the queue
+	QueueFullBlock = "block"
+	// QueueFullDropOldest drops the oldest queued event to make room for the new event, in ordered mode
+	// the oldest queued event of the same group
+	QueueFullDropOldest = "dropOldest"
+
+	defaultQueueSize = 100
+)
+
+var (
+	errPoolStopped  = errors.New("stream stopped, event not executed")
+	errEventDropped = errors.New("execution queue full, event dropped")
+)
+
+// task is an event waiting to be executed, or a micro-batch of events of a group
+type task struct {
+	ctx           context.Context
+	discriminator string
+	inputs        map[string]interface{}
+	handler       action.ResultHandler
+
+	batch []*task
+}
+
+// reject completes the task without executing it
+func (t *task) reject(err error) {
+	if t.batch != nil {
+		for _, bt := range t.batch {
+			bt.reject(err)
+		}
+		return
+	}
+
+	t.handler.HandleResult(nil, err)
+	t.handler.Done()
+}
+
+// workerPool executes tasks using a fixed number of workers. If ordered, each worker has its own queue and
+// the tasks are assigned to the workers by discriminator, otherwise the workers share a single queue.
+type workerPool struct {
+	queues     []chan *task
+	ordered    bool
+	dropOldest bool
+	exec       func(t *task)
+
+	// dropMutexes serialize the submissions to each queue when the oldest task of a group is dropped
+	dropMutexes []sync.Mutex
+
+	// mutex prevents tasks from being queued while the queues are drained on stop
+	mutex    sync.RWMutex
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int, ordered, dropOldest bool, exec func(t *task)) *workerPool {
+
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	p := &workerPool{ordered: ordered, dropOldest: dropOldest, exec: exec, done: make(chan struct{})}
+
+	if ordered {
+		p.queues = make([]chan *task, workers)
+		for i := range p.queues {
+			p.queues[i] = make(chan *task, queueSize)
+		}
+		p.dropMutexes = make([]sync.Mutex, workers)
+	} else {
+		p.queues = []chan *task{make(chan *task, queueSize)}
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work(p.queues[i%len(p.queues)])
+	}
+
+	return p
+}
+
+func (p *workerPool) work(queue chan *task) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case t := <-queue:
+			//don't execute queued tasks once stopped
+			select {
+			case <-p.done:
+				t.reject(errPoolStopped)
+				return
+			default:
+			}
+			p.exec(t)
+		}
+	}
+}
+
+// submit queues the task, if the queue is full it either blocks until there is room in the queue or
+// the context of the task is done, or drops the oldest queued task. In ordered mode the oldest queued task
+// of the same group is dropped, or the task itself if there is none.
+func (p *workerPool) submit(t *task) error {
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	select {
+	case <-p.done:
+		return errPoolStopped
+	default:
+	}
+
+	i := 0
+	if len(p.queues) > 1 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(t.discriminator))
+		i = int(h.Sum32() % uint32(len(p.queues)))
+	}
+	queue := p.queues[i]
+
+	if !p.dropOldest {
+		select {
+		case queue <- t:
+			return nil
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		case <-p.done:
+			return errPoolStopped
+		}
+	}
+
+	if p.ordered {
+		return p.submitDropOldestOfGroup(i, t)
+	}
+
+	for {
+		select {
+		case queue <- t:
+			return nil
+		default:
+		}
+
+		select {
+		case oldest := <-queue:
+			logger.Warnf("Execution queue full, dropping event of group '%s'", oldest.discriminator)
+			oldest.reject(errEventDropped)
+		default:
+		}
+	}
+}
+
+// submitDropOldestOfGroup queues the task to the i-th queue, if the queue is full the oldest queued task of the
+// group of the task is dropped so the groups sharing the queue don't drop each other's tasks. If no task of the
+// group is queued the task itself is dropped and errEventDropped returned.
+func (p *workerPool) submitDropOldestOfGroup(i int, t *task) error {
+
+	p.dropMutexes[i].Lock()
+	defer p.dropMutexes[i].Unlock()
+
+	queue := p.queues[i]
+
+	select {
+	case queue <- t:
+		return nil
+	default:
+	}
+
+	//only the worker takes tasks while the queue is drained, the tasks are queued again in the same order
+	queued := make([]*task, 0, cap(queue))
+	for drained := false; !drained; {
+		select {
+		case qt := <-queue:
+			queued = append(queued, qt)
+		default:
+			drained = true
+		}
+	}
+
+	var dropped *task
+	if len(queued) == cap(queue) {
+		dropped = t
+		for j, qt := range queued {
+			if qt.discriminator == t.discriminator {
+				dropped = qt
+				queued = append(queued[:j], queued[j+1:]...)
+				break
+			}
+		}
+	}
+
+	if dropped != t {
+		queued = append(queued, t)
+	}
+	for _, qt := range queued {
+		queue <- qt
+	}
+
+	if dropped == nil {
+		return nil
+	}
+
+	logger.Warnf("Execution queue full, dropping event of group '%s'", dropped.discriminator)
+	if dropped == t {
+		return errEventDropped
+	}
+	dropped.reject(errEventDropped)
+
+	return nil
+}
+
+// stop stops the workers once their current tasks are executed, the queued tasks are rejected
+func (p *workerPool) stop() {
+
+	p.stopOnce.Do(func() {
+		close(p.done)
+
+		//wait for the tasks being submitted
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		p.wg.Wait()
+
+		for _, queue := range p.queues {
+			for len(queue) > 0 {
+				(<-queue).reject(errPoolStopped)
+			}
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	//the logger is set when the action factory is initialized
+	if logger == nil {
+		logger = log.ChildLogger(log.RootLogger(), "stream")
+	}
+}
+
+// testHandler records the result of a task
+type testHandler struct {
+	results map[string]interface{}
+	err     error
+	done    chan struct{}
+}
+
+func (h *testHandler) HandleResult(results map[string]interface{}, err error) {
+	h.results, h.err = results, err
+}
+
+func (h *testHandler) Done() {
+	close(h.done)
+}
+
+func newTestTask(discriminator string, id int) *task {
+	return &task{ctx: context.Background(), discriminator: discriminator, inputs: map[string]interface{}{"id": id},
+		handler: &testHandler{done: make(chan struct{})}}
+}
+
+func waitTask(t *testing.T, tk *task) error {
+	h := tk.handler.(*testHandler)
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "task not done")
+	}
+	return h.err
+}
+
+// gatedExec executes the tasks once the gate is opened, recording the ids of the executed tasks
+type gatedExec struct {
+	mutex    sync.Mutex
+	started  chan struct{}
+	gate     chan struct{}
+	executed []interface{}
+}
+
+func newGatedExec() *gatedExec {
+	return &gatedExec{started: make(chan struct{}, 10), gate: make(chan struct{})}
+}
+
+func (e *gatedExec) exec(t *task) {
+	e.started <- struct{}{}
+	<-e.gate
+
+	e.mutex.Lock()
+	e.executed = append(e.executed, t.inputs["id"])
+	e.mutex.Unlock()
+
+	t.handler.HandleResult(nil, nil)
+	t.handler.Done()
+}
+
+func TestWorkerPool_Ordered(t *testing.T) {
+
+	var mutex sync.Mutex
+	executed := make(map[string][]int)
+
+	exec := func(tk *task) {
+		time.Sleep(time.Duration(tk.inputs["id"].(int)%3) * time.Millisecond)
+
+		mutex.Lock()
+		executed[tk.discriminator] = append(executed[tk.discriminator], tk.inputs["id"].(int))
+		mutex.Unlock()
+
+		tk.handler.Done()
+	}
+
+	pool := newWorkerPool(4, 10, true, false, exec)
+	defer pool.stop()
+
+	var tasks []*task
+	for i := 0; i < 100; i++ {
+		tk := newTestTask(fmt.Sprint("d", i%5), i)
+		tasks = append(tasks, tk)
+		assert.Nil(t, pool.submit(tk))
+	}
+
+	for _, tk := range tasks {
+		assert.Nil(t, waitTask(t, tk))
+	}
+
+	//the events of each group are executed in the order they were submitted
+	assert.Len(t, executed, 5)
+	for discriminator, ids := range executed {
+		assert.Len(t, ids, 20)
+		for i := 1; i < len(ids); i++ {
+			assert.True(t, ids[i-1] < ids[i], "events of group '%s' out of order: %v", discriminator, ids)
+		}
+	}
+}
+
+func TestWorkerPool_DropOldest(t *testing.T) {
+
+	e := newGatedExec()
+	pool := newWorkerPool(1, 2, false, true, e.exec)
+	defer pool.stop()
+
+	tasks := []*task{newTestTask("", 0), newTestTask("", 1), newTestTask("", 2), newTestTask("", 3)}
+
+	assert.Nil(t, pool.submit(tasks[0]))
+	<-e.started
+
+	//the queue is full once the third task is submitted
+	for _, tk := range tasks[1:] {
+		assert.Nil(t, pool.submit(tk))
+	}
+
+	close(e.gate)
+
+	assert.Nil(t, waitTask(t, tasks[0]))
+	assert.Equal(t, errEventDropped, waitTask(t, tasks[1]))
+	assert.Nil(t, waitTask(t, tasks[2]))
+	assert.Nil(t, waitTask(t, tasks[3]))
+	assert.Equal(t, []interface{}{0, 2, 3}, e.executed)
+}
+
+func TestWorkerPool_DropOldestOrdered(t *testing.T) {
+
+	e := newGatedExec()
+	pool := newWorkerPool(1, 2, true, true, e.exec)
+	defer pool.stop()
+
+	tasks := []*task{newTestTask("a", 0), newTestTask("a", 1), newTestTask("b", 2), newTestTask("b", 3)}
+
+	assert.Nil(t, pool.submit(tasks[0]))
+	<-e.started
+
+	//the queue is full once the fourth task is submitted, the oldest task of its group is dropped
+	for _, tk := range tasks[1:] {
+		assert.Nil(t, pool.submit(tk))
+	}
+
+	//the task is dropped itself if no task of its group is queued
+	assert.Equal(t, errEventDropped, pool.submit(newTestTask("c", 4)))
+
+	close(e.gate)
+
+	assert.Nil(t, waitTask(t, tasks[0]))
+	assert.Nil(t, waitTask(t, tasks[1]))
+	assert.Equal(t, errEventDropped, waitTask(t, tasks[2]))
+	assert.Nil(t, waitTask(t, tasks[3]))
+	assert.Equal(t, []interface{}{0, 1, 3}, e.executed)
+}
+
+func TestWorkerPool_Block(t *testing.T) {
+
+	e := newGatedExec()
+	pool := newWorkerPool(1, 1, false, false, e.exec)
+
+	assert.Nil(t, pool.submit(newTestTask("", 0)))
+	<-e.started
+	assert.Nil(t, pool.submit(newTestTask("", 1)))
+
+	//the queue is full, the submit blocks until the context is done
+	blocked := newTestTask("", 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	blocked.ctx = ctx
+
+	assert.Equal(t, context.DeadlineExceeded, pool.submit(blocked))
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.stop()
+		close(stopped)
+	}()
+
+	//the current task completes, the queued task is rejected
+	<-pool.done
+	close(e.gate)
+	<-stopped
+
+	assert.Equal(t, []interface{}{0}, e.executed)
+	assert.Equal(t, errPoolStopped, pool.submit(newTestTask("", 3)))
+}